@@ -1,26 +1,79 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
 	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
+	_ "time/tzdata" // User time zones must load on hosts without tzdata.
 
 	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/events"
 	"github.com/romshark/todostar/server"
+	"github.com/romshark/todostar/server/oidc"
 )
 
 func main() {
 	fDebug := flag.Bool("debug", false, "enable debug logs")
 	fAccessLog := flag.Bool("logaccess", true, "enables access logs")
 	fHost := flag.String("host", "localhost:8080", "server host address")
-	flag.Parse()
+	fDataDir := flag.String("data-dir", "",
+		"data directory to persist todos in (in-memory if empty)")
+	fBackend := flag.String("backend", "journal",
+		"store backend used with -data-dir: journal or bolt")
+	fSnapshotInterval := flag.Duration("snapshot-interval", 10*time.Minute,
+		"interval at which the journal is compacted into a snapshot")
+	fDiskIndex := flag.Bool("disk-index", false,
+		"keep the search index on disk in -data-dir instead of in memory")
+	fUndoDeleteWindow := flag.Duration("undo-delete-window", 30*time.Second,
+		"grace window within which moving todos to the trash can be undone")
+	fTrashRetention := flag.Duration("trash-retention", 30*24*time.Hour,
+		"time after which todos in the trash are deleted permanently (0 keeps them)")
+	fTrashPurgeInterval := flag.Duration("trash-purge-interval", time.Hour,
+		"interval at which todos exceeding -trash-retention are purged")
+	fBlobGCInterval := flag.Duration("blob-gc-interval", time.Hour,
+		"interval at which attachments no todo references anymore are deleted")
+	fSessionTTL := flag.Duration("session-ttl", 7*24*time.Hour,
+		"time after which inactive login sessions expire")
+	fInsecureCookies := flag.Bool("insecure-cookies", false,
+		"send the session cookie over plain HTTP (for hosts other than localhost)")
+	fOIDCIssuer := flag.String("oidc-issuer", "",
+		"OpenID Connect issuer URL enabling single sign-on (disabled if empty)")
+	fOIDCClientID := flag.String("oidc-client-id", "", "OpenID Connect client ID")
+	fOIDCClientSecret := flag.String("oidc-client-secret",
+		os.Getenv("TODOSTAR_OIDC_CLIENT_SECRET"),
+		"OpenID Connect client secret (defaults to $TODOSTAR_OIDC_CLIENT_SECRET)")
+	fOIDCScopes := flag.String("oidc-scopes", "openid,profile,email",
+		"comma separated OpenID Connect scopes")
+	fOIDCRedirectURL := flag.String("oidc-redirect-url", "",
+		"OpenID Connect callback URL (defaults to http://<host>/login/oidc/callback/)")
+	fPasswordLogin := flag.Bool("password-login", true,
+		"allow logging in with a password (disable to only allow single sign-on)")
+	fRefreshWindow := flag.Duration("refresh-window", 50*time.Millisecond,
+		"window within which changes to todos are merged into one refresh of open views")
+
+	// "reindex" rebuilds the on-disk search index from the store and exits.
+	// "adduser" adds the user named by the first argument with the password
+	// read from stdin and exits.
+	var subcommand string
+	args := os.Args[1:]
+	if len(args) > 0 && (args[0] == "reindex" || args[0] == "adduser") {
+		subcommand, args = args[0], args[1:]
+	}
+	reindex := subcommand == "reindex"
+	_ = flag.CommandLine.Parse(args) // Exits on error.
 
 	var slogHandler slog.Handler
 	if *fDebug {
@@ -38,15 +91,114 @@ func main() {
 	slog.SetDefault(logger)
 	slog.Debug("debug mode enabled")
 
-	store := domain.New()
+	opts := domain.Options{Reindex: reindex}
+	if *fDiskIndex && *fDataDir != "" {
+		opts.IndexPath = filepath.Join(*fDataDir, "index.bleve")
+	}
+	if reindex && opts.IndexPath == "" {
+		slog.Error("reindex requires -data-dir and -disk-index")
+		os.Exit(1)
+	}
+
+	users, err := openUsers(*fDataDir)
+	if err != nil {
+		slog.Error("opening users", slog.Any("err", err))
+		os.Exit(1)
+	}
+	if subcommand == "adduser" {
+		if err := addUser(users, flag.Arg(0), os.Stdin); err != nil {
+			slog.Error("adding user", slog.Any("err", err))
+			os.Exit(1)
+		}
+		slog.Info("added user", slog.String("name", flag.Arg(0)))
+		return
+	}
+	if !reindex && *fPasswordLogin {
+		if err := ensureUser(users); err != nil {
+			slog.Error("adding initial user", slog.Any("err", err))
+			os.Exit(1)
+		}
+	}
 
-	writeMockData(store)
+	store, err := openStore(*fDataDir, *fBackend, opts)
+	if errors.Is(err, domain.ErrIndexOutOfSync) {
+		slog.Error("opening store, run the reindex subcommand to rebuild the index",
+			slog.Any("err", err))
+		os.Exit(1)
+	}
+	if err != nil {
+		slog.Error("opening store", slog.Any("err", err))
+		os.Exit(1)
+	}
+	if reindex {
+		if err := store.Close(); err != nil {
+			slog.Error("closing store", slog.Any("err", err))
+			os.Exit(1)
+		}
+		slog.Info("rebuilt search index", slog.String("path", opts.IndexPath))
+		return
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			slog.Error("closing store", slog.Any("err", err))
+		}
+	}()
 
-	srv := server.New(store, *fAccessLog)
+	if isEmpty(store) {
+		writeMockData(store)
+	}
+	workspaces, err := openWorkspaces(*fDataDir)
+	if err != nil {
+		slog.Error("opening workspaces", slog.Any("err", err))
+		os.Exit(1)
+	}
+	if err := assignWorkspace(store, users, workspaces); err != nil {
+		slog.Error("assigning todos to workspace", slog.Any("err", err))
+		os.Exit(1)
+	}
+	blobs, err := openBlobs(*fDataDir)
+	if err != nil {
+		slog.Error("opening attachments", slog.Any("err", err))
+		os.Exit(1)
+	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
+	var provider *oidc.Provider
+	if *fOIDCIssuer != "" {
+		redirectURL := *fOIDCRedirectURL
+		if redirectURL == "" {
+			redirectURL = "http://" + *fHost + "/login/oidc/callback/"
+		}
+		provider, err = oidc.New(ctx, oidc.Config{
+			Issuer:       *fOIDCIssuer,
+			ClientID:     *fOIDCClientID,
+			ClientSecret: *fOIDCClientSecret,
+			Scopes:       strings.Split(*fOIDCScopes, ","),
+			RedirectURL:  redirectURL,
+		})
+		if err != nil {
+			slog.Error("setting up OIDC", slog.Any("err", err))
+			os.Exit(1)
+		}
+	} else if !*fPasswordLogin {
+		slog.Error("-password-login=false requires -oidc-issuer")
+		os.Exit(1)
+	}
+
+	srv := server.New(store, users, workspaces, blobs, server.Config{
+		AccessLog:        *fAccessLog,
+		UndoDeleteWindow: *fUndoDeleteWindow,
+		TrashRetention:   *fTrashRetention,
+		SessionTTL:       *fSessionTTL,
+		InsecureCookies:  *fInsecureCookies,
+		OIDC:             provider,
+		RefreshWindow:    *fRefreshWindow,
+
+		DisablePasswordLogin: !*fPasswordLogin,
+	})
+
 	s := &http.Server{
 		Addr:        *fHost,
 		Handler:     srv,
@@ -54,6 +206,47 @@ func main() {
 	}
 
 	var wg sync.WaitGroup
+	wg.Go(func() {
+		t := time.NewTicker(*fSnapshotInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				compact(store)
+			}
+		}
+	})
+	if *fTrashRetention > 0 {
+		wg.Go(func() {
+			// Janitor permanently deleting todos from the trash.
+			t := time.NewTicker(*fTrashPurgeInterval)
+			defer t.Stop()
+			for {
+				purgeTrash(ctx, store, *fTrashRetention)
+				select {
+				case <-ctx.Done():
+					return
+				case <-t.C:
+				}
+			}
+		})
+	}
+	wg.Go(func() {
+		// Attachments are unreferenced by editing todos too,
+		// not only by purging them.
+		t := time.NewTicker(*fBlobGCInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				collectBlobs(ctx, store, blobs)
+			}
+		}
+	})
 	wg.Go(func() {
 		slog.Info("listening", slog.String("host", *fHost))
 		if err := s.ListenAndServe(); err != nil {
@@ -69,22 +262,216 @@ func main() {
 	}
 
 	wg.Wait()
+
+	compact(store)
+}
+
+// openStore opens the store backend in dataDir.
+// Returns an in-memory store if dataDir is empty.
+func openStore(dataDir, backend string, opts domain.Options) (domain.Store, error) {
+	if dataDir == "" {
+		return domain.New(), nil
+	}
+	slog.Info("opening store",
+		slog.String("dir", dataDir), slog.String("backend", backend))
+	switch backend {
+	case "journal":
+		return domain.Open(dataDir, opts)
+	case "bolt":
+		if err := os.MkdirAll(dataDir, 0o755); err != nil {
+			return nil, err
+		}
+		return domain.OpenBolt(filepath.Join(dataDir, "todos.db"), opts)
+	}
+	return nil, fmt.Errorf("unknown backend: %q", backend)
+}
+
+// openUsers opens the user store in dataDir.
+// Returns an in-memory user store if dataDir is empty.
+func openUsers(dataDir string) (*domain.MemUsers, error) {
+	if dataDir == "" {
+		return domain.NewUsers(), nil
+	}
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return nil, err
+	}
+	return domain.OpenUsers(filepath.Join(dataDir, "users.json"))
+}
+
+// openWorkspaces opens the workspace store in dataDir.
+// Returns an in-memory workspace store if dataDir is empty.
+func openWorkspaces(dataDir string) (*domain.MemWorkspaces, error) {
+	if dataDir == "" {
+		return domain.NewWorkspaces(), nil
+	}
+	return domain.OpenWorkspaces(filepath.Join(dataDir, "workspaces.json"))
+}
+
+// openBlobs opens the attachment store in dataDir.
+// Returns an in-memory attachment store if dataDir is empty.
+func openBlobs(dataDir string) (domain.BlobStore, error) {
+	if dataDir == "" {
+		return domain.NewBlobs(), nil
+	}
+	return domain.OpenBlobs(filepath.Join(dataDir, "attachments"))
 }
 
-func writeMockData(s *domain.Store) {
-	add := func(
-		title, description string, now, due time.Time, edit func(*domain.Todo) error,
-	) (id int64) {
+// assignWorkspace assigns all todos without a workspace, like the mock data
+// and todos created before workspaces existed, to the first workspace.
+// If there's none, it's created with all users as admins
+// so that they keep the access they had.
+// Todos are left unassigned while there are no users.
+func assignWorkspace(
+	store domain.Store, users domain.UserStore, workspaces domain.WorkspaceStore,
+) error {
+	ctx := domain.WithActor(context.Background(), "migration")
+	var unassigned []int64
+	for _, f := range []domain.SearchFilters{
+		{}, {Archived: true}, {Trashed: true},
+	} {
+		l, err := store.Search(ctx, f)
+		if err != nil {
+			return err
+		}
+		for _, t := range l {
+			if t.Workspace == 0 {
+				unassigned = append(unassigned, t.ID)
+			}
+		}
+	}
+	if len(unassigned) == 0 {
+		return nil
+	}
+
+	all, err := users.Users(ctx)
+	if err != nil || len(all) == 0 {
+		return err
+	}
+	id := int64(1)
+	if _, err := workspaces.GetWorkspace(ctx, id); errors.Is(err, domain.ErrNotExists) {
+		if id, err = workspaces.AddWorkspace(ctx, "Shared", all[0].ID); err != nil {
+			return err
+		}
+		for _, u := range all[1:] {
+			if err := workspaces.SetRole(ctx, id, u.ID, domain.RoleAdmin); err != nil {
+				return err
+			}
+		}
+	} else if err != nil {
+		return err
+	}
+
+	for _, todoID := range unassigned {
+		if err := store.Edit(ctx, todoID, 0, func(t *domain.Todo) error {
+			t.Workspace = id
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	slog.Info("assigned todos to workspace",
+		slog.Int64("workspace", id), slog.Int("todos", len(unassigned)))
+	return nil
+}
+
+// addUser adds user name with the password read from the first line of r.
+func addUser(users domain.UserStore, name string, r io.Reader) error {
+	password, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("reading password: %w", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+	_, err = users.AddUser(context.Background(), domain.User{Name: name}, password)
+	var errValidation domain.ErrorValidationUser
+	if errors.As(err, &errValidation) {
+		return fmt.Errorf("the name must be a lower case user name "+
+			"and the password %d to %d bytes long: %w",
+			domain.PasswordMinLength, domain.PasswordMaxLength, err)
+	}
+	return err
+}
+
+// ensureUser adds the user "admin" with a random password
+// if there are no users yet so that it's possible to log in.
+func ensureUser(users domain.UserStore) error {
+	ctx := context.Background()
+	n, err := users.CountUsers(ctx)
+	if err != nil || n > 0 {
+		return err
+	}
+	password := rand.Text()
+	if _, err := users.AddUser(ctx, domain.User{
+		Name: "admin", DisplayName: "Admin",
+	}, password); err != nil {
+		return err
+	}
+	slog.Warn("no users, added initial user", slog.String("name", "admin"))
+	// The password is kept out of the log that may be collected elsewhere.
+	_, err = fmt.Fprintf(os.Stderr, "initial user: admin, password: %s\n", password)
+	return err
+}
+
+// compact compacts the store if its backend supports compaction.
+func compact(s domain.Store) {
+	c, ok := s.(interface{ Compact() error })
+	if !ok {
+		return
+	}
+	if err := c.Compact(); err != nil {
+		slog.Error("compacting store", slog.Any("err", err))
+	}
+}
+
+// purgeTrash permanently deletes todos that have been in the trash
+// for longer than retention.
+func purgeTrash(ctx context.Context, s domain.Store, retention time.Duration) {
+	ctx = domain.WithActor(ctx, "janitor")
+	n, err := s.Purge(ctx, 0, time.Now().Add(-retention))
+	if err != nil {
+		slog.Error("purging trash", slog.Any("err", err))
+	}
+	if n > 0 {
+		slog.Info("purged trash", slog.Int("purged", n))
+		events.NotifyTodosChanged(0)
+	}
+}
+
+// collectBlobs deletes the attachments no todo of s references anymore.
+func collectBlobs(ctx context.Context, s domain.Store, blobs domain.BlobStore) {
+	n, err := blobs.GC(ctx, s, time.Now().Add(-domain.BlobGracePeriod))
+	if err != nil {
+		slog.Error("collecting attachments", slog.Any("err", err))
+	}
+	if n > 0 {
+		slog.Info("collected attachments", slog.Int("deleted", n))
+	}
+}
+
+func isEmpty(s domain.Store) bool {
+	ctx := context.Background()
+	for _, f := range []domain.SearchFilters{
+		{}, {Archived: true}, {Trashed: true},
+	} {
+		l, err := s.Search(ctx, f)
+		if err != nil {
+			panic(err)
+		}
+		if len(l) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func writeMockData(s domain.Store) {
+	add := func(t domain.Todo, edit func(*domain.Todo) error) (id int64) {
 		ctx := context.Background()
-		id, err := s.Add(
-			ctx, title, description,
-			now, due,
-		)
+		id, err := s.Add(ctx, t)
 		if err != nil {
 			panic(err)
 		}
 		if edit != nil {
-			if err = s.Edit(ctx, id, edit); err != nil {
+			if err = s.Edit(ctx, id, 0, edit); err != nil {
 				panic(err)
 			}
 		}
@@ -93,44 +480,76 @@ func writeMockData(s *domain.Store) {
 
 	now := time.Now()
 
-	add("Release the D* demo", "ship it. ship it. ship it.",
-		now.Add(time.Hour), time.Time{},
-		func(t *domain.Todo) error {
-			t.Status = domain.StatusDone
-			return nil
-		},
-	)
+	add(domain.Todo{
+		Title:       "Release the D* demo",
+		Description: "ship it. ship it. ship it.",
+		Tags:        []string{"release"},
+		Priority:    domain.PriorityHigh,
+		Created:     now.Add(time.Hour),
+	}, func(t *domain.Todo) error {
+		t.Status = domain.StatusDone
+		return nil
+	})
 
-	add("Do the laundries", "",
-		now.Add(-time.Hour), now.Add(-time.Hour), nil,
-	)
+	add(domain.Todo{
+		Title:      "Do the laundries",
+		Tags:       []string{"home"},
+		Priority:   domain.PriorityLow,
+		Created:    now.Add(-time.Hour),
+		Due:        now.Add(-time.Hour),
+		Recurrence: "FREQ=WEEKLY",
+	}, nil)
 
-	add("Go shopping", "- onions\n- sausages\n- bananas\n- a new broom",
-		now.Add(-24*time.Minute), now.Add(2*time.Second), nil,
-	)
+	add(domain.Todo{
+		Title:    "Go shopping",
+		Tags:     []string{"home", "errands"},
+		Priority: domain.PriorityMedium,
+		Created:  now.Add(-24 * time.Minute),
+		Due:      now.Add(2 * time.Second),
+		Checklist: []domain.ChecklistItem{
+			{Title: "onions", Done: true},
+			{Title: "sausages"},
+			{Title: "bananas"},
+			{Title: "a new broom"},
+		},
+	}, nil)
 
-	add("Check emails", "",
-		now.Add(-10*time.Second), now.Add(4*24*time.Hour), nil,
-	)
+	add(domain.Todo{
+		Title:      "Check emails",
+		Tags:       []string{"work"},
+		Priority:   domain.PriorityUrgent,
+		Created:    now.Add(-10 * time.Second),
+		Due:        now.Add(4 * 24 * time.Hour),
+		Recurrence: "FREQ=DAILY",
+	}, nil)
 
-	add("Add more Lorem Ipsum text",
-		`Lorem ipsum dolor sit amet, consectetur adipiscing elit. Ut eu interdum leo, et lobortis purus. Nullam eget mi placerat, ultricies mauris quis, pulvinar magna. Phasellus ornare nulla tempor nulla tincidunt feugiat. Praesent nec molestie leo, porta tempor nibh. Quisque quis pellentesque ligula. Nunc nec diam a nisi tempor facilisis in sit amet ex. Sed in enim ut est egestas ultrices et ut massa. Praesent mattis quam ut pretium commodo. Nullam eget scelerisque est, semper viverra enim. Nam id egestas sem. Duis et pharetra tortor. Sed cursus bibendum eros, ac suscipit ante rhoncus at. Praesent ut ligula a est pharetra dapibus a a libero. Etiam fermentum quam sit amet augue pharetra scelerisque. Integer finibus sed urna quis finibus.
+	add(domain.Todo{
+		Title: "Add more Lorem Ipsum text",
+		Description: `Lorem ipsum dolor sit amet, consectetur adipiscing elit. Ut eu interdum leo, et lobortis purus. Nullam eget mi placerat, ultricies mauris quis, pulvinar magna. Phasellus ornare nulla tempor nulla tincidunt feugiat. Praesent nec molestie leo, porta tempor nibh. Quisque quis pellentesque ligula. Nunc nec diam a nisi tempor facilisis in sit amet ex. Sed in enim ut est egestas ultrices et ut massa. Praesent mattis quam ut pretium commodo. Nullam eget scelerisque est, semper viverra enim. Nam id egestas sem. Duis et pharetra tortor. Sed cursus bibendum eros, ac suscipit ante rhoncus at. Praesent ut ligula a est pharetra dapibus a a libero. Etiam fermentum quam sit amet augue pharetra scelerisque. Integer finibus sed urna quis finibus.
 
 Mauris sapien mauris, hendrerit et purus nec, mollis blandit tellus. In metus tortor, auctor eu imperdiet ac, pharetra quis quam. In at malesuada nibh. Donec iaculis id elit dignissim maximus. Fusce dolor tortor, accumsan eu urna quis, bibendum egestas tellus. Suspendisse vulputate fringilla condimentum. Proin interdum finibus laoreet. Morbi odio sem, fringilla venenatis lorem facilisis, pulvinar molestie augue.`,
-		now.Add(-12*24*time.Hour), now.Add(60*24*time.Hour), nil,
-	)
+		Tags:    []string{"work", "docs"},
+		Created: now.Add(-12 * 24 * time.Hour),
+		Due:     now.Add(60 * 24 * time.Hour),
+	}, nil)
 
 	// Archive
-	add("A very old task long done", "",
-		now.Add(-(100 * 24 * time.Hour)), now.Add(-(98 * 24 * time.Hour)),
-		func(t *domain.Todo) error {
-			t.Status, t.Archived = domain.StatusDone, true
-			return nil
-		})
-	add("Old task that has never been done", "",
-		now.Add(-(30 * 24 * time.Hour)), now.Add(-(10 * 24 * time.Hour)),
-		func(t *domain.Todo) error {
-			t.Archived = true
-			return nil
-		})
+	add(domain.Todo{
+		Title:   "A very old task long done",
+		Created: now.Add(-(100 * 24 * time.Hour)),
+		Due:     now.Add(-(98 * 24 * time.Hour)),
+	}, func(t *domain.Todo) error {
+		t.Status, t.Archived = domain.StatusDone, true
+		return nil
+	})
+	add(domain.Todo{
+		Title:    "Old task that has never been done",
+		Tags:     []string{"work"},
+		Priority: domain.PriorityHigh,
+		Created:  now.Add(-(30 * 24 * time.Hour)),
+		Due:      now.Add(-(10 * 24 * time.Hour)),
+	}, func(t *domain.Todo) error {
+		t.Archived = true
+		return nil
+	})
 }
@@ -0,0 +1,21 @@
+package domain
+
+import "slices"
+
+// AssigneesMaxCount is the maximum number of users a todo can be assigned to.
+const AssigneesMaxCount = 8
+
+// ValidateAssignees checks the number of assignees
+// and that every assignee is a valid user ID listed once.
+func ValidateAssignees(ids []int64) ErrorValidation {
+	invalid := len(ids) > AssigneesMaxCount
+	for i, id := range ids {
+		if id < 1 || slices.Contains(ids[:i], id) {
+			invalid = true
+		}
+	}
+	return ErrorValidation{AssigneesInvalid: invalid}
+}
+
+// AssignedTo returns true if user is among the assignees of t.
+func (t *Todo) AssignedTo(user int64) bool { return slices.Contains(t.Assignees, user) }
@@ -0,0 +1,344 @@
+package domain
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	AttachmentMaxSize       = 10 << 20 // 10 MiB
+	AttachmentsMaxCount     = 16
+	AttachmentNameMaxLength = 255
+)
+
+// BlobGracePeriod is how long blobs are kept after they were stored
+// before they're garbage-collected, see BlobStore.GC.
+// It leaves the time to attach uploaded blobs to a todo.
+const BlobGracePeriod = time.Hour
+
+// AttachmentTypes are the media types of the files that can be attached.
+// Types browsers render as active content, like HTML and SVG, aren't allowed.
+var AttachmentTypes = []string{
+	"image/png", "image/jpeg", "image/gif", "image/webp",
+	"text/plain", "application/pdf", "application/zip", "application/x-gzip",
+}
+
+// Attachment is a file attached to a todo.
+// Its contents are kept in a BlobStore.
+type Attachment struct {
+	// Hash is the hex encoded SHA-256 hash of the contents.
+	Hash string
+	Name string
+	// ContentType is the media type of the contents, see AttachmentTypes.
+	ContentType string
+	Size        int64
+}
+
+// IsImage returns true if a can be rendered as an image.
+func (a Attachment) IsImage() bool { return strings.HasPrefix(a.ContentType, "image/") }
+
+// ValidateAttachments checks the number of attachments, that every one
+// of them is of an allowed type, at most AttachmentMaxSize bytes large,
+// attached once and has a name of at most AttachmentNameMaxLength bytes
+// without path separators and control characters.
+func ValidateAttachments(l []Attachment) ErrorValidation {
+	v := ErrorValidation{AttachmentsTooMany: len(l) > AttachmentsMaxCount}
+	for i, a := range l {
+		v.AttachmentTooLarge = v.AttachmentTooLarge || a.Size > AttachmentMaxSize
+		v.AttachmentTypeInvalid = v.AttachmentTypeInvalid ||
+			!slices.Contains(AttachmentTypes, a.ContentType)
+		if !validBlobHash(a.Hash) || !validAttachmentName(a.Name) || a.Size < 0 ||
+			slices.ContainsFunc(l[:i], func(x Attachment) bool { return x.Hash == a.Hash }) {
+			v.AttachmentInvalid = true
+		}
+	}
+	return v
+}
+
+func validAttachmentName(n string) bool {
+	return n != "" && len(n) <= AttachmentNameMaxLength && utf8.ValidString(n) &&
+		!strings.ContainsFunc(n, func(r rune) bool {
+			return unicode.IsControl(r) || r == '/' || r == '\\'
+		})
+}
+
+// AttachmentName turns the name of an uploaded file into a valid
+// attachment name by dropping its directory and invalid characters
+// and shortening it. Returns "file" if nothing is left.
+func AttachmentName(filename string) string {
+	if i := strings.LastIndexAny(filename, `/\`); i >= 0 {
+		filename = filename[i+1:]
+	}
+	n := strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, filename))
+	for len(n) > AttachmentNameMaxLength {
+		_, size := utf8.DecodeLastRuneInString(n)
+		n = n[:len(n)-size]
+	}
+	if n == "" || n == "." || n == ".." {
+		return "file"
+	}
+	return n
+}
+
+// Attachment returns the attachment of t with the given hash.
+func (t *Todo) Attachment(hash string) (Attachment, bool) {
+	i := slices.IndexFunc(t.Attachments, func(a Attachment) bool { return a.Hash == hash })
+	if i < 0 {
+		return Attachment{}, false
+	}
+	return t.Attachments[i], true
+}
+
+// BlobStore is a content-addressed store of the contents of attachments.
+// MemBlobs and DiskBlobs are the available backends.
+type BlobStore interface {
+	// Put stores the contents read from r and returns their hash and size.
+	// Storing contents that are already stored keeps them,
+	// but renews the time they were stored.
+	// Returns ErrorValidation if r holds more than AttachmentMaxSize bytes.
+	Put(ctx context.Context, r io.Reader) (hash string, size int64, err error)
+
+	// Open returns the contents with the given hash.
+	// Returns ErrNotExists if no such contents are stored.
+	Open(ctx context.Context, hash string) (io.ReadSeekCloser, error)
+
+	// GC permanently deletes all contents stored before the given time
+	// that aren't attached to any todo in s, including the ones
+	// in the archive and the trash, and returns the number deleted.
+	GC(ctx context.Context, s Store, before time.Time) (deleted int, err error)
+}
+
+// readBlob reads at most AttachmentMaxSize bytes from r into w
+// and returns their hash and size.
+func readBlob(w io.Writer, r io.Reader) (hash string, size int64, err error) {
+	h := sha256.New()
+	size, err = io.Copy(io.MultiWriter(w, h), io.LimitReader(r, AttachmentMaxSize+1))
+	if err != nil {
+		return "", 0, err
+	}
+	if size > AttachmentMaxSize {
+		return "", 0, ErrorValidation{AttachmentTooLarge: true}
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+func validBlobHash(h string) bool {
+	if len(h) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(h)
+	return err == nil && strings.ToLower(h) == h
+}
+
+// attachedBlobs returns the hashes of the attachments of all todos in s.
+func attachedBlobs(ctx context.Context, s Store) (map[string]bool, error) {
+	hashes := make(map[string]bool)
+	for _, f := range []SearchFilters{{}, {Archived: true}, {Trashed: true}} {
+		l, err := s.Search(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range l {
+			for _, a := range t.Attachments {
+				hashes[a.Hash] = true
+			}
+		}
+	}
+	return hashes, nil
+}
+
+// MemBlobs is a BlobStore keeping all contents in memory.
+type MemBlobs struct {
+	lock  sync.Mutex
+	blobs map[string]memBlob
+}
+
+type memBlob struct {
+	data   []byte
+	stored time.Time
+}
+
+var _ BlobStore = new(MemBlobs)
+
+// NewBlobs creates a new in-memory blob store.
+func NewBlobs() *MemBlobs { return &MemBlobs{blobs: make(map[string]memBlob)} }
+
+func (b *MemBlobs) Put(_ context.Context, r io.Reader) (hash string, size int64, err error) {
+	var buf bytes.Buffer
+	if hash, size, err = readBlob(&buf, r); err != nil {
+		return "", 0, err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.blobs[hash] = memBlob{data: buf.Bytes(), stored: time.Now()}
+	return hash, size, nil
+}
+
+func (b *MemBlobs) Open(_ context.Context, hash string) (io.ReadSeekCloser, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	blob, ok := b.blobs[hash]
+	if !ok {
+		return nil, ErrNotExists
+	}
+	return nopCloser{bytes.NewReader(blob.data)}, nil
+}
+
+type nopCloser struct{ io.ReadSeeker }
+
+func (nopCloser) Close() error { return nil }
+
+func (b *MemBlobs) GC(
+	ctx context.Context, s Store, before time.Time,
+) (deleted int, err error) {
+	attached, err := attachedBlobs(ctx, s)
+	if err != nil {
+		return 0, err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for hash, blob := range b.blobs {
+		if !attached[hash] && blob.stored.Before(before) {
+			delete(b.blobs, hash)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// DiskBlobs is a BlobStore keeping every blob in a file named by its hash
+// in a subdirectory named by the first two characters of the hash.
+// The modification time of a file is the time it was stored.
+type DiskBlobs struct {
+	// lock keeps GC from deleting blobs that are being stored again.
+	lock sync.Mutex
+	dir  string
+}
+
+var _ BlobStore = new(DiskBlobs)
+
+// tempBlobPattern matches the files blobs are written to before they're
+// moved to their path, see DiskBlobs.Put.
+const tempBlobPattern = ".put-*"
+
+// OpenBlobs opens the blob store in dir and creates dir if necessary.
+func OpenBlobs(dir string) (*DiskBlobs, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DiskBlobs{dir: dir}, nil
+}
+
+func (b *DiskBlobs) path(hash string) string {
+	return filepath.Join(b.dir, hash[:2], hash)
+}
+
+func (b *DiskBlobs) Put(_ context.Context, r io.Reader) (hash string, size int64, err error) {
+	f, err := os.CreateTemp(b.dir, tempBlobPattern)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+	if hash, size, err = readBlob(f, r); err != nil {
+		return "", 0, err
+	}
+	if err = f.Sync(); err != nil {
+		return "", 0, err
+	}
+	if err = f.Close(); err != nil {
+		return "", 0, err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	p := b.path(hash)
+	now := time.Now()
+	if err = os.Chtimes(p, now, now); err == nil {
+		// Already stored.
+		return hash, size, os.Remove(f.Name())
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", 0, err
+	}
+	if err = os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", 0, err
+	}
+	if err = os.Rename(f.Name(), p); err != nil {
+		return "", 0, err
+	}
+	return hash, size, nil
+}
+
+func (b *DiskBlobs) Open(_ context.Context, hash string) (io.ReadSeekCloser, error) {
+	if !validBlobHash(hash) {
+		return nil, ErrNotExists
+	}
+	f, err := os.Open(b.path(hash))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotExists
+	}
+	return f, err
+}
+
+func (b *DiskBlobs) GC(
+	ctx context.Context, s Store, before time.Time,
+) (deleted int, err error) {
+	attached, err := attachedBlobs(ctx, s)
+	if err != nil {
+		return 0, err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	err = filepath.WalkDir(b.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name := d.Name()
+		temp, _ := filepath.Match(tempBlobPattern, name)
+		if !temp && (!validBlobHash(name) || attached[name]) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.ModTime().Before(before) {
+			return err
+		}
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+		if !temp {
+			deleted++
+		}
+		return nil
+	})
+	return deleted, err
+}
@@ -0,0 +1,158 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// BlockersMaxCount is the maximum number of todos a todo can be blocked by.
+const BlockersMaxCount = 16
+
+// ErrDependencyCycle is returned by Store.Edit when a todo
+// would directly or transitively be blocked by itself.
+var ErrDependencyCycle = errors.New("dependency cycle")
+
+// ValidateBlockers checks the number of blockers
+// and that every blocker is a valid todo ID listed once.
+func ValidateBlockers(ids []int64) ErrorValidation {
+	invalid := len(ids) > BlockersMaxCount
+	for i, id := range ids {
+		if id < 1 || slices.Contains(ids[:i], id) {
+			invalid = true
+		}
+	}
+	return ErrorValidation{BlockedByInvalid: invalid}
+}
+
+// ParseTodoIDs parses a comma separated list of todo IDs
+// optionally prefixed with "#". Duplicates are dropped.
+func ParseTodoIDs(s string) ([]int64, error) {
+	var ids []int64
+	for v := range strings.SplitSeq(s, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "#")
+		if v == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("invalid todo ID: %q", v)
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// FormatTodoIDs formats ids as a comma separated list, see ParseTodoIDs.
+func FormatTodoIDs(ids []int64) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = "#" + strconv.FormatInt(id, 10)
+	}
+	return strings.Join(s, ", ")
+}
+
+// OpenBlockers returns the IDs of the open todos blocking each of todos
+// by todo ID. Todos that aren't blocked are omitted.
+func OpenBlockers(
+	ctx context.Context, s Store, todos []*Todo,
+) (map[int64][]int64, error) {
+	status := map[int64]Status{}
+	get := func(id int64) (*Todo, error) {
+		if st, ok := status[id]; ok {
+			return &Todo{ID: id, Status: st}, nil
+		}
+		t, err := s.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		status[id] = t.Status
+		return t, nil
+	}
+	blockers := map[int64][]int64{}
+	for _, t := range todos {
+		ids, err := openBlockers(t, get)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) > 0 {
+			blockers[t.ID] = ids
+		}
+	}
+	return blockers, nil
+}
+
+// openBlockers returns the IDs of the open todos blocking t.
+// get returns the todo by ID, blockers that don't exist are ignored.
+func openBlockers(t *Todo, get func(id int64) (*Todo, error)) ([]int64, error) {
+	var ids []int64
+	for _, id := range t.BlockedBy {
+		b, err := get(id)
+		if errors.Is(err, ErrNotExists) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if b.Status != StatusDone {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// checkBlockers checks that all blockers of t exist in the same workspace
+// outside of the archive and the trash and that t isn't transitively
+// blocked by itself.
+// get returns the todo by ID. Returns ErrorValidation for invalid blockers
+// and ErrDependencyCycle for cycles.
+func checkBlockers(t *Todo, get func(id int64) (*Todo, error)) error {
+	for _, id := range t.BlockedBy {
+		b, err := get(id)
+		if errors.Is(err, ErrNotExists) || (err == nil &&
+			(b.Archived || b.InTrash() || b.Workspace != t.Workspace)) {
+			return ErrorValidation{BlockedByInvalid: true}
+		} else if err != nil {
+			return err
+		}
+	}
+	visited := map[int64]bool{}
+	next := slices.Clone(t.BlockedBy)
+	for len(next) > 0 {
+		id := next[len(next)-1]
+		next = next[:len(next)-1]
+		if id == t.ID {
+			return ErrDependencyCycle
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		b, err := get(id)
+		if errors.Is(err, ErrNotExists) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		next = append(next, b.BlockedBy...)
+	}
+	return nil
+}
+
+// unblock returns a copy of t at the next version without blocker
+// or nil if t isn't blocked by it.
+func unblock(t *Todo, blocker int64) *Todo {
+	if !slices.Contains(t.BlockedBy, blocker) {
+		return nil
+	}
+	updated := *t
+	updated.BlockedBy = slices.DeleteFunc(
+		slices.Clone(t.BlockedBy), func(id int64) bool { return id == blocker },
+	)
+	updated.Version++
+	return &updated
+}
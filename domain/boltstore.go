@@ -0,0 +1,799 @@
+package domain
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketTodos    = []byte("todos")
+	bucketUIDs     = []byte("uids")     // UID -> ID
+	bucketHistory  = []byte("history")  // Generation -> HistoryEntry
+	bucketComments = []byte("comments") // TodoID + ID -> Comment
+	bucketRanks    = []byte("ranks")    // Rank + 0 + ID -> ID
+	bucketMeta     = []byte("meta")
+
+	// keyGeneration is incremented on every mutation.
+	keyGeneration = []byte("generation")
+)
+
+// BoltStore is a Store persisted in an embedded bbolt database.
+type BoltStore struct {
+	db          *bolt.DB
+	searchIndex bleve.Index
+}
+
+var _ Store = new(BoltStore)
+
+// OpenBolt opens or creates the bbolt database at path.
+func OpenBolt(path string, opts Options) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening bolt database: %w", err)
+	}
+	idx, freshIndex, err := openIndex(opts)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	s := &BoltStore{db: db, searchIndex: idx}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketTodos)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketUIDs); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketHistory); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketComments); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketMeta); err != nil {
+			return err
+		}
+		if tx.Bucket(bucketRanks) == nil {
+			if err := createRanks(tx); err != nil {
+				return err
+			}
+		}
+		gen := generation(tx)
+		if !freshIndex {
+			return checkIndex(idx, uint64(b.Stats().KeyN), gen)
+		}
+		var todos []*Todo
+		if err := b.ForEach(func(_, v []byte) error {
+			t, err := decodeTodo(v)
+			if err != nil {
+				return err
+			}
+			todos = append(todos, t)
+			return nil
+		}); err != nil {
+			return err
+		}
+		comments := make(map[int64][]*Comment)
+		if err := tx.Bucket(bucketComments).ForEach(func(_, v []byte) error {
+			c, err := decodeComment(v)
+			if err != nil {
+				return err
+			}
+			comments[c.TodoID] = append(comments[c.TodoID], c)
+			return nil
+		}); err != nil {
+			return err
+		}
+		return rebuildIndex(idx, todos, comments, gen)
+	})
+	if err != nil {
+		_ = idx.Close()
+		_ = db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the database and the search index.
+func (s *BoltStore) Close() error {
+	return errors.Join(s.searchIndex.Close(), s.db.Close())
+}
+
+func generation(tx *bolt.Tx) uint64 {
+	v := tx.Bucket(bucketMeta).Get(keyGeneration)
+	if len(v) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+// nextGeneration increments and returns the store generation.
+func nextGeneration(tx *bolt.Tx) (uint64, error) {
+	gen := generation(tx) + 1
+	err := tx.Bucket(bucketMeta).Put(
+		keyGeneration, binary.BigEndian.AppendUint64(nil, gen),
+	)
+	return gen, err
+}
+
+func boltKey(id int64) []byte { return binary.BigEndian.AppendUint64(nil, uint64(id)) }
+
+func decodeTodo(v []byte) (*Todo, error) {
+	t := new(Todo)
+	if err := json.Unmarshal(v, t); err != nil {
+		return nil, fmt.Errorf("decoding todo: %w", err)
+	}
+	if t.Rank == "" {
+		t.Rank = legacyRank(t.ID)
+	}
+	return t, nil
+}
+
+// createRanks creates the rank index of all todos
+// including those added before it existed.
+func createRanks(tx *bolt.Tx) error {
+	ranks, err := tx.CreateBucket(bucketRanks)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucketTodos).ForEach(func(_, v []byte) error {
+		t, err := decodeTodo(v)
+		if err != nil {
+			return err
+		}
+		return ranks.Put(rankKey(t), boltKey(t.ID))
+	})
+}
+
+// rankKey returns the key of t in the rank index which orders todos
+// like compareRanks since rank digits sort after the separator.
+func rankKey(t *Todo) []byte {
+	return append(append([]byte(t.Rank), 0), boltKey(t.ID)...)
+}
+
+// rankOf returns the rank in rank index key k.
+func rankOf(k []byte) string {
+	rank, _, _ := bytes.Cut(k, []byte{0})
+	return string(rank)
+}
+
+// lastRankTx returns the rank of a todo added after all todos, see lastRank.
+func lastRankTx(tx *bolt.Tx) string {
+	k, _ := tx.Bucket(bucketRanks).Cursor().Last()
+	return rankBetween(rankOf(k), "")
+}
+
+// rankAfterTx returns the rank of todo when moved right after todo after
+// or before all todos if after is 0, see rankAfter.
+// Returns ErrNotExists if there's no todo after.
+func rankAfterTx(tx *bolt.Tx, todo *Todo, after int64) (string, error) {
+	if after == todo.ID {
+		// Moving a todo after itself keeps it in place.
+		return todo.Rank, nil
+	}
+	c := tx.Bucket(bucketRanks).Cursor()
+	var lo string
+	k, _ := c.First()
+	if after != 0 {
+		a, err := getTodo(tx.Bucket(bucketTodos), after)
+		if err != nil {
+			return "", err
+		}
+		lo = a.Rank
+		c.Seek(rankKey(a))
+		k, _ = c.Next()
+	}
+	if k != nil && bytes.Equal(k, rankKey(todo)) {
+		k, _ = c.Next() // Skip the moved todo.
+	}
+	return rankBetween(lo, rankOf(k)), nil
+}
+
+// boltTx is a read-write transaction that rolls back the changes
+// made to the search index within it if it fails, see BoltStore.write.
+type boltTx struct {
+	*bolt.Tx
+	rollback []func()
+}
+
+// write calls fn in a read-write transaction.
+func (s *BoltStore) write(fn func(tx *boltTx) error) error {
+	tx := new(boltTx)
+	err := s.db.Update(func(btx *bolt.Tx) error {
+		tx.Tx = btx
+		return fn(tx)
+	})
+	if err != nil {
+		// Roll back in case of failure or commit failure.
+		for _, r := range slices.Backward(tx.rollback) {
+			r()
+		}
+	}
+	return err
+}
+
+func putTodo(b *bolt.Bucket, t *Todo) error {
+	v, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("encoding todo: %w", err)
+	}
+	return b.Put(boltKey(t.ID), v)
+}
+
+func putHistoryEntry(tx *bolt.Tx, gen uint64, e *HistoryEntry) error {
+	v, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding history entry: %w", err)
+	}
+	return tx.Bucket(bucketHistory).Put(binary.BigEndian.AppendUint64(nil, gen), v)
+}
+
+func commentKey(todoID, id int64) []byte {
+	return binary.BigEndian.AppendUint64(boltKey(todoID), uint64(id))
+}
+
+func decodeComment(v []byte) (*Comment, error) {
+	c := new(Comment)
+	if err := json.Unmarshal(v, c); err != nil {
+		return nil, fmt.Errorf("decoding comment: %w", err)
+	}
+	return c, nil
+}
+
+func putComment(b *bolt.Bucket, c *Comment) error {
+	v, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("encoding comment: %w", err)
+	}
+	return b.Put(commentKey(c.TodoID, c.ID), v)
+}
+
+// todoComments returns the comments on todo id, oldest first.
+func todoComments(tx *bolt.Tx, id int64) (comments []*Comment, err error) {
+	prefix := boltKey(id)
+	c := tx.Bucket(bucketComments).Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		cm, err := decodeComment(v)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, cm)
+	}
+	return comments, nil
+}
+
+func getTodo(b *bolt.Bucket, id int64) (*Todo, error) {
+	v := b.Get(boltKey(id))
+	if v == nil {
+		return nil, ErrNotExists
+	}
+	return decodeTodo(v)
+}
+
+func (s *BoltStore) Add(ctx context.Context, todo Todo) (id int64, err error) {
+	err = s.write(func(tx *boltTx) error {
+		id, err = s.add(ctx, tx, todo)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// add adds todo within tx and returns its ID.
+func (s *BoltStore) add(ctx context.Context, tx *boltTx, todo Todo) (int64, error) {
+	if err := validate(&todo); err.IsErr() {
+		return 0, err
+	}
+	b := tx.Bucket(bucketTodos)
+	seq, err := b.NextSequence()
+	if err != nil {
+		return 0, err
+	}
+	gen, err := nextGeneration(tx.Tx)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkBlockers(&todo, func(id int64) (*Todo, error) {
+		return getTodo(b, id)
+	}); err != nil {
+		return 0, err
+	}
+	t := newTodo(ctx, int64(seq), lastRankTx(tx.Tx), todo)
+	if err := putTodo(b, t); err != nil {
+		return 0, err
+	}
+	if err := tx.Bucket(bucketUIDs).Put([]byte(t.UID), boltKey(t.ID)); err != nil {
+		return 0, err
+	}
+	if err := tx.Bucket(bucketRanks).Put(rankKey(t), boltKey(t.ID)); err != nil {
+		return 0, err
+	}
+	entry := newHistoryEntry(ctx, MutationAdd, nil, t)
+	if err := putHistoryEntry(tx.Tx, gen, entry); err != nil {
+		return 0, err
+	}
+	if err := indexTodo(s.searchIndex, t, nil, gen); err != nil {
+		return 0, err
+	}
+	tx.rollback = append(tx.rollback, func() {
+		// Resetting the index generation makes sure the index is
+		// detected as out of sync on next open in case this fails.
+		_ = unindexTodo(s.searchIndex, t.ID, 0)
+	})
+	return t.ID, nil
+}
+
+func (s *BoltStore) Get(_ context.Context, id int64) (t *Todo, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		t, err = getTodo(tx.Bucket(bucketTodos), id)
+		return err
+	})
+	return t, err
+}
+
+func (s *BoltStore) GetByUID(_ context.Context, uid string) (t *Todo, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		k := tx.Bucket(bucketUIDs).Get([]byte(uid))
+		if k == nil {
+			return ErrNotExists
+		}
+		t, err = getTodo(tx.Bucket(bucketTodos), int64(binary.BigEndian.Uint64(k)))
+		return err
+	})
+	return t, err
+}
+
+func (s *BoltStore) Search(_ context.Context, filters SearchFilters) (res []*Todo, err error) {
+	var scores map[int64]float64
+	err = s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketTodos)
+		get := func(id int64) (*Todo, error) { return getTodo(b, id) }
+
+		if strings.TrimSpace(filters.TextMatch) == "" {
+			// Fast search with simple filters.
+			return b.ForEach(func(_, v []byte) error {
+				t, err := decodeTodo(v)
+				if err != nil {
+					return err
+				}
+				if !filters.match(t) {
+					return nil
+				}
+				if ok, err := filters.matchBlocked(t, get); !ok || err != nil {
+					return err
+				}
+				res = append(res, t)
+				return nil
+			})
+		}
+
+		// Slow search by text match.
+		n, err := s.searchIndex.DocCount()
+		if err != nil {
+			return fmt.Errorf("counting indexed documents: %w", err)
+		}
+		scores, err = searchIndex(s.searchIndex, filters, int(n))
+		if err != nil {
+			return err
+		}
+		for id := range scores {
+			t, err := getTodo(b, id)
+			if errors.Is(err, ErrNotExists) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if !filters.match(t) {
+				continue
+			}
+			if ok, err := filters.matchBlocked(t, get); err != nil {
+				return err
+			} else if ok {
+				res = append(res, t)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortTodos(res, filters, scores)
+	return res, nil
+}
+
+func (s *BoltStore) TagCounts(
+	_ context.Context, filters SearchFilters,
+) ([]TagCount, error) {
+	return tagFacets(s.searchIndex, filters)
+}
+
+func (s *BoltStore) Edit(
+	ctx context.Context, id int64, version int64, mutate func(*Todo) error,
+) error {
+	var nextID int64
+	err := s.write(func(tx *boltTx) error {
+		var next *Todo
+		var unblock bool
+		err := s.update(ctx, tx, MutationEdit, id,
+			func(b *bolt.Bucket, todo *Todo) (*Todo, error) {
+				updated, err := editTodo(todo, version, mutate)
+				if err != nil {
+					return nil, err
+				}
+				if !slices.Equal(todo.BlockedBy, updated.BlockedBy) {
+					if err := checkBlockers(updated, func(id int64) (*Todo, error) {
+						return getTodo(b, id)
+					}); err != nil {
+						return nil, err
+					}
+				}
+				next = nextOccurrence(ctx, todo, updated)
+				unblock = detached(todo, updated)
+				return updated, nil
+			})
+		if err != nil {
+			return err
+		}
+		if unblock {
+			if err := s.unblockAll(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+		if next != nil {
+			nextID, err = s.add(ctx, tx, *next)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if nextID != 0 {
+		setNextOccurrence(ctx, nextID)
+	}
+	return nil
+}
+
+func (s *BoltStore) Archive(ctx context.Context, id int64) error {
+	return s.write(func(tx *boltTx) error {
+		err := s.update(ctx, tx, MutationArchive, id,
+			func(_ *bolt.Bucket, todo *Todo) (*Todo, error) {
+				updated := *todo
+				updated.Archived = true
+				updated.BlockedBy = nil
+				updated.Version++
+				return &updated, nil
+			})
+		if err != nil {
+			return err
+		}
+		return s.unblockAll(ctx, tx, id)
+	})
+}
+
+// unblockAll removes blocker from the blockers of all todos within tx.
+func (s *BoltStore) unblockAll(ctx context.Context, tx *boltTx, blocker int64) error {
+	var blocked []int64
+	err := tx.Bucket(bucketTodos).ForEach(func(_, v []byte) error {
+		t, err := decodeTodo(v)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(t.BlockedBy, blocker) {
+			blocked = append(blocked, t.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range blocked {
+		err := s.update(ctx, tx, MutationEdit, id,
+			func(_ *bolt.Bucket, todo *Todo) (*Todo, error) {
+				return unblock(todo, blocker), nil
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// update replaces todo id with the result of fn within tx and reindexes it.
+// fn is passed the todos bucket and may return nil to keep the todo.
+// The actor of ctx is recorded as the last to update it.
+func (s *BoltStore) update(
+	ctx context.Context, tx *boltTx, m Mutation, id int64,
+	fn func(b *bolt.Bucket, todo *Todo) (*Todo, error),
+) error {
+	b := tx.Bucket(bucketTodos)
+	todo, err := getTodo(b, id)
+	if err != nil {
+		return err
+	}
+	comments, err := todoComments(tx.Tx, id)
+	if err != nil {
+		return err
+	}
+	updated, err := fn(b, todo)
+	if err != nil || updated == nil {
+		return err
+	}
+	updated.UpdatedBy = ActorFrom(ctx)
+	gen, err := nextGeneration(tx.Tx)
+	if err != nil {
+		return err
+	}
+	if err := putTodo(b, updated); err != nil {
+		return err
+	}
+	if updated.Rank != todo.Rank {
+		ranks := tx.Bucket(bucketRanks)
+		if err := ranks.Delete(rankKey(todo)); err != nil {
+			return err
+		}
+		if err := ranks.Put(rankKey(updated), boltKey(id)); err != nil {
+			return err
+		}
+	}
+	entry := newHistoryEntry(ctx, m, todo, updated)
+	if err := putHistoryEntry(tx.Tx, gen, entry); err != nil {
+		return err
+	}
+	if err := indexTodo(s.searchIndex, updated, comments, gen); err != nil {
+		return err
+	}
+	tx.rollback = append(tx.rollback, func() {
+		_ = indexTodo(s.searchIndex, todo, comments, 0) // See add.
+	})
+	return nil
+}
+
+func (s *BoltStore) Delete(ctx context.Context, id int64) error {
+	return s.write(func(tx *boltTx) error {
+		err := s.update(ctx, tx, MutationTrash, id,
+			func(_ *bolt.Bucket, todo *Todo) (*Todo, error) {
+				if todo.InTrash() {
+					return nil, ErrNotExists
+				}
+				updated := *todo
+				updated.Trashed = time.Now()
+				updated.BlockedBy = nil
+				updated.Version++
+				return &updated, nil
+			})
+		if err != nil {
+			return err
+		}
+		return s.unblockAll(ctx, tx, id)
+	})
+}
+
+func (s *BoltStore) Restore(ctx context.Context, id int64) error {
+	return s.write(func(tx *boltTx) error {
+		return s.update(ctx, tx, MutationRestore, id,
+			func(_ *bolt.Bucket, todo *Todo) (*Todo, error) {
+				if !todo.InTrash() {
+					return nil, ErrNotExists
+				}
+				updated := *todo
+				updated.Trashed = time.Time{}
+				updated.Version++
+				return &updated, nil
+			})
+	})
+}
+
+func (s *BoltStore) Move(ctx context.Context, id, after int64) error {
+	return s.write(func(tx *boltTx) error {
+		return s.update(ctx, tx, MutationMove, id,
+			func(_ *bolt.Bucket, todo *Todo) (*Todo, error) {
+				rank, err := rankAfterTx(tx.Tx, todo, after)
+				if err != nil {
+					return nil, err
+				}
+				updated := *todo
+				updated.Rank = rank
+				updated.Version++
+				return &updated, nil
+			})
+	})
+}
+
+func (s *BoltStore) Purge(
+	ctx context.Context, workspace int64, before time.Time,
+) (purged int, err error) {
+	err = s.write(func(tx *boltTx) error {
+		var expired []*Todo
+		err := tx.Bucket(bucketTodos).ForEach(func(_, v []byte) error {
+			t, err := decodeTodo(v)
+			if err != nil {
+				return err
+			}
+			if purgeable(t, workspace, before) {
+				expired = append(expired, t)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, t := range expired {
+			if err := s.delete(ctx, tx, t); err != nil {
+				return err
+			}
+		}
+		purged = len(expired)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// delete permanently deletes todo within tx.
+func (s *BoltStore) delete(ctx context.Context, tx *boltTx, todo *Todo) error {
+	gen, err := nextGeneration(tx.Tx)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketTodos).Delete(boltKey(todo.ID)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketRanks).Delete(rankKey(todo)); err != nil {
+		return err
+	}
+	entry := newHistoryEntry(ctx, MutationDelete, todo, nil)
+	if err := putHistoryEntry(tx.Tx, gen, entry); err != nil {
+		return err
+	}
+	if todo.UID != "" {
+		if err := tx.Bucket(bucketUIDs).Delete([]byte(todo.UID)); err != nil {
+			return err
+		}
+	}
+	comments, err := todoComments(tx.Tx, todo.ID)
+	if err != nil {
+		return err
+	}
+	for _, c := range comments {
+		if err := tx.Bucket(bucketComments).Delete(commentKey(c.TodoID, c.ID)); err != nil {
+			return err
+		}
+	}
+	if err := unindexTodo(s.searchIndex, todo.ID, gen); err != nil {
+		return err
+	}
+	tx.rollback = append(tx.rollback, func() {
+		_ = indexTodo(s.searchIndex, todo, comments, 0) // See add.
+	})
+	return nil
+}
+
+func (s *BoltStore) History(
+	_ context.Context, filter HistoryFilter,
+) (res []HistoryEntry, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketHistory).ForEach(func(_, v []byte) error {
+			var e HistoryEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("decoding history entry: %w", err)
+			}
+			if filter.match(&e) {
+				res = append(res, e)
+			}
+			return nil
+		})
+	})
+	return res, err
+}
+
+func (s *BoltStore) AddComment(_ context.Context, c Comment) (id int64, err error) {
+	if err := ValidateComment(c.Text); err.IsErr() {
+		return 0, err
+	}
+	err = s.updateComments(c.TodoID, func(b *bolt.Bucket, _ []*Comment) error {
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		added := newComment(int64(seq), c)
+		id = added.ID
+		return putComment(b, added)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *BoltStore) EditComment(_ context.Context, todoID, id int64, text string) error {
+	if err := ValidateComment(text); err.IsErr() {
+		return err
+	}
+	return s.updateComments(todoID, func(b *bolt.Bucket, comments []*Comment) error {
+		_, edited, err := editComment(comments, id, text)
+		if err != nil {
+			return err
+		}
+		return putComment(b, edited)
+	})
+}
+
+func (s *BoltStore) DeleteComment(_ context.Context, todoID, id int64) error {
+	return s.updateComments(todoID, func(b *bolt.Bucket, comments []*Comment) error {
+		_, deleted, err := deleteComment(comments, id)
+		if err != nil {
+			return err
+		}
+		return b.Delete(commentKey(todoID, deleted.ID))
+	})
+}
+
+// updateComments calls fn with the comments bucket and the comments
+// on todo todoID and reindexes the todo with its comments afterwards.
+func (s *BoltStore) updateComments(
+	todoID int64, fn func(b *bolt.Bucket, comments []*Comment) error,
+) error {
+	var todo *Todo
+	var before []*Comment
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		t, err := getTodo(tx.Bucket(bucketTodos), todoID)
+		if err != nil {
+			return err
+		}
+		if err := commentable(t); err != nil {
+			return err
+		}
+		comments, err := todoComments(tx, todoID)
+		if err != nil {
+			return err
+		}
+		if err := fn(tx.Bucket(bucketComments), comments); err != nil {
+			return err
+		}
+		gen, err := nextGeneration(tx)
+		if err != nil {
+			return err
+		}
+		after, err := todoComments(tx, todoID)
+		if err != nil {
+			return err
+		}
+		if err := indexTodo(s.searchIndex, t, after, gen); err != nil {
+			return err
+		}
+		todo, before = t, comments
+		return nil
+	})
+	if err != nil && todo != nil {
+		// Roll back in case of commit failure, see Add.
+		_ = indexTodo(s.searchIndex, todo, before, 0)
+	}
+	return err
+}
+
+func (s *BoltStore) Comments(_ context.Context, todoID int64) (res []*Comment, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		if _, err := getTodo(tx.Bucket(bucketTodos), todoID); err != nil {
+			return err
+		}
+		res, err = todoComments(tx, todoID)
+		return err
+	})
+	return res, err
+}
@@ -0,0 +1,94 @@
+package domain
+
+import (
+	"slices"
+	"strings"
+)
+
+const (
+	ChecklistMaxItems      = 64
+	ChecklistItemMaxLength = 256
+)
+
+// ChecklistItem is a subtask of a todo.
+type ChecklistItem struct {
+	Title string
+	Done  bool
+}
+
+// ValidateChecklist checks the number of items and that every item
+// has a title of at most ChecklistItemMaxLength bytes.
+func ValidateChecklist(items []ChecklistItem) ErrorValidation {
+	return ErrorValidation{
+		ChecklistTooLong: len(items) > ChecklistMaxItems,
+		ChecklistItemInvalid: slices.ContainsFunc(items, func(i ChecklistItem) bool {
+			return i.Title == "" || len(i.Title) > ChecklistItemMaxLength
+		}),
+	}
+}
+
+// ParseChecklist parses a checklist with one item per line.
+// Lines may be bulleted with "-" or "*" and items prefixed with "[x]"
+// are done. Items are trimmed and empty lines are dropped.
+func ParseChecklist(s string) []ChecklistItem {
+	var items []ChecklistItem
+	for line := range strings.Lines(s) {
+		line = strings.TrimSpace(line)
+		for _, bullet := range []string{"- ", "* "} {
+			line = strings.TrimPrefix(line, bullet)
+		}
+		var done bool
+		switch {
+		case strings.HasPrefix(line, "[x]"), strings.HasPrefix(line, "[X]"):
+			done, line = true, line[len("[x]"):]
+		case strings.HasPrefix(line, "[ ]"):
+			line = line[len("[ ]"):]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			items = append(items, ChecklistItem{Title: line, Done: done})
+		}
+	}
+	return items
+}
+
+// FormatChecklist formats items with one item per line, see ParseChecklist.
+func FormatChecklist(items []ChecklistItem) string {
+	var b strings.Builder
+	for i, item := range items {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		if item.Done {
+			b.WriteString("[x] ")
+		}
+		b.WriteString(item.Title)
+	}
+	return b.String()
+}
+
+// ResetChecklist returns a copy of items with all items not done.
+func ResetChecklist(items []ChecklistItem) []ChecklistItem {
+	reset := slices.Clone(items)
+	for i := range reset {
+		reset[i].Done = false
+	}
+	return reset
+}
+
+// Progress returns the share of t that is done between 0 and 1.
+// Open todos with a checklist are as far as their done items.
+func (t *Todo) Progress() float64 {
+	if t.Status == StatusDone {
+		return 1
+	}
+	if len(t.Checklist) == 0 {
+		return 0
+	}
+	var done int
+	for _, item := range t.Checklist {
+		if item.Done {
+			done++
+		}
+	}
+	return float64(done) / float64(len(t.Checklist))
+}
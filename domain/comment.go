@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// CommentMaxLength is the maximum length of the text of a comment in bytes.
+const CommentMaxLength = 4 * 1024 // 4 KiB
+
+// Comment is a message in the discussion of a todo.
+// Comments are kept apart from the todo they're on so that discussing a todo
+// neither changes its version nor its history, but their text is searchable
+// like the description of the todo.
+type Comment struct {
+	// ID is allocated sequentially by the store it was added to.
+	ID     int64
+	TodoID int64
+	// Author is the ID of the user who wrote the comment, see UserStore.
+	Author int64
+	// Text is markdown-lite, see package mdlite.
+	Text    string
+	Created time.Time
+	// Edited is the time the text was last changed, zero if it never was.
+	Edited time.Time
+}
+
+// Journal operations on comments. They aren't todo mutations
+// and hence not recorded in the history.
+const (
+	opComment       Mutation = "comment"
+	opDeleteComment Mutation = "delete-comment"
+)
+
+// ValidateComment checks that text isn't blank and at most
+// CommentMaxLength bytes long.
+func ValidateComment(text string) ErrorValidation {
+	return ErrorValidation{
+		CommentEmpty:   strings.TrimSpace(text) == "",
+		CommentTooLong: len(text) > CommentMaxLength,
+	}
+}
+
+// newComment returns a copy of c added as comment id.
+func newComment(id int64, c Comment) *Comment {
+	c.ID, c.Created, c.Edited = id, time.Now(), time.Time{}
+	return &c
+}
+
+// editComment returns comments with comment id replaced by a copy with text
+// and the edited copy. Returns ErrNotExists if there's no such comment.
+func editComment(
+	comments []*Comment, id int64, text string,
+) ([]*Comment, *Comment, error) {
+	i := slices.IndexFunc(comments, func(c *Comment) bool { return c.ID == id })
+	if i < 0 {
+		return nil, nil, ErrNotExists
+	}
+	c := *comments[i]
+	c.Text, c.Edited = text, time.Now()
+	comments = slices.Clone(comments)
+	comments[i] = &c
+	return comments, &c, nil
+}
+
+// deleteComment returns comments without comment id and the deleted comment.
+// Returns ErrNotExists if there's no such comment.
+func deleteComment(comments []*Comment, id int64) ([]*Comment, *Comment, error) {
+	i := slices.IndexFunc(comments, func(c *Comment) bool { return c.ID == id })
+	if i < 0 {
+		return nil, nil, ErrNotExists
+	}
+	return slices.Delete(slices.Clone(comments), i, i+1), comments[i], nil
+}
+
+// commentable returns ErrNotExists if comments on t can't be changed
+// because it's in the trash.
+func commentable(t *Todo) error {
+	if t.InTrash() {
+		return ErrNotExists
+	}
+	return nil
+}
@@ -5,87 +5,243 @@ import (
 	"errors"
 	"fmt"
 	"slices"
-	"strconv"
 	"strings"
-	"sync"
-	"sync/atomic"
 	"time"
-
-	"github.com/blevesearch/bleve/v2"
-	blevequery "github.com/blevesearch/bleve/v2/search/query"
+	"unicode"
 )
 
-func New() *Store {
-	return &Store{
-		indexByID:   make(map[int64]*Todo),
-		searchIndex: mustMakeBleveIndex(),
-	}
+// Store is a todo repository.
+// MemStore and BoltStore are the available backends.
+type Store interface {
+	// Todos returned by the store are copies owned by the caller
+	// that don't change with later mutations.
+
+	// Add creates a new open todo with the fields of t and returns its ID.
+	// ID, UID, Version, Status, Archived, Trashed, Rank, CreatedBy and UpdatedBy
+	// are set by the store.
+	// New todos are ranked after all other todos.
+	// Returns ErrorValidation if a blocker doesn't exist or isn't active.
+	Add(ctx context.Context, t Todo) (id int64, err error)
+
+	// Get returns todo id.
+	// Returns ErrNotExists if no such todo exists.
+	Get(ctx context.Context, id int64) (*Todo, error)
+
+	// GetByUID returns the todo with the given UID.
+	// Returns ErrNotExists if no such todo exists.
+	GetByUID(ctx context.Context, uid string) (*Todo, error)
+
+	// Search returns all todos matching filters.
+	Search(ctx context.Context, filters SearchFilters) ([]*Todo, error)
+
+	// TagCounts returns the number of todos matching filters per tag
+	// ordered by count, most used tags first.
+	TagCounts(ctx context.Context, filters SearchFilters) ([]TagCount, error)
+
+	// Edit calls mutate on a copy of todo id and saves it.
+	// If version isn't 0 and doesn't match the current version of the todo
+	// ErrConflict is returned. Use version 0 for unconditional edits.
+	// Marking a recurring todo done adds its next occurrence
+	// with the due date computed in the location set by WithLocation,
+	// see WithNextOccurrence.
+	// Archiving a todo removes its blocked-by links, see Archive.
+	// Returns ErrDependencyCycle if the todo would be blocked by itself
+	// and ErrorValidation if a blocker doesn't exist or isn't active.
+	// Returns ErrNotExists if no such todo exists.
+	Edit(
+		ctx context.Context, id int64, version int64, mutate func(*Todo) error,
+	) error
+
+	// Archive moves todo id to the archive.
+	// Archived todos neither block nor are blocked by other todos,
+	// all blocked-by links from and to todo id are removed.
+	// Returns ErrNotExists if no such todo exists.
+	Archive(ctx context.Context, id int64) error
+
+	// Delete moves todo id to the trash.
+	// Like Archive it removes all blocked-by links from and to todo id.
+	// Returns ErrNotExists if no such todo exists outside of the trash.
+	Delete(ctx context.Context, id int64) error
+
+	// Restore moves todo id out of the trash.
+	// Returns ErrNotExists if no such todo exists in the trash.
+	Restore(ctx context.Context, id int64) error
+
+	// Move ranks todo id right after todo after,
+	// or before all todos if after is 0, without changing other todos.
+	// Moving a todo after itself keeps it in place.
+	// Returns ErrNotExists if either todo doesn't exist.
+	Move(ctx context.Context, id, after int64) error
+
+	// Purge permanently deletes all todos of workspace, or of all workspaces
+	// if workspace is 0, moved to the trash before the given time
+	// and returns the number of deleted todos.
+	Purge(ctx context.Context, workspace int64, before time.Time) (purged int, err error)
+
+	// AddComment adds comment c to todo c.TodoID and returns its ID.
+	// ID, Created and Edited are set by the store.
+	// Returns ErrorValidation if the text is invalid, see ValidateComment.
+	// Returns ErrNotExists if no such todo exists outside of the trash.
+	AddComment(ctx context.Context, c Comment) (id int64, err error)
+
+	// EditComment replaces the text of comment id on todo todoID.
+	// Returns ErrorValidation if the text is invalid, see ValidateComment.
+	// Returns ErrNotExists if no such comment exists
+	// or the todo is in the trash.
+	EditComment(ctx context.Context, todoID, id int64, text string) error
+
+	// DeleteComment permanently deletes comment id on todo todoID.
+	// Returns ErrNotExists if no such comment exists
+	// or the todo is in the trash.
+	DeleteComment(ctx context.Context, todoID, id int64) error
+
+	// Comments returns the comments on todo id, oldest first.
+	// Comments are deleted along with their todo, see Purge.
+	// Returns ErrNotExists if no such todo exists.
+	Comments(ctx context.Context, todoID int64) ([]*Comment, error)
+
+	// History returns the history entries matching filter in chronological order.
+	// Every mutation records an entry with the actor set by WithActor.
+	// The history of deleted todos is retained.
+	History(ctx context.Context, filter HistoryFilter) ([]HistoryEntry, error)
+
+	// Close releases all resources held by the store.
+	Close() error
 }
 
-func mustMakeBleveIndex() bleve.Index {
-	doc := bleve.NewDocumentMapping()
+type Status int8
 
-	title := bleve.NewTextFieldMapping()
-	title.Store = false
-	title.Analyzer = "en"
-	doc.AddFieldMappingsAt("Title", title)
+const (
+	_ Status = iota
+	StatusOpen
+	StatusDone
+)
 
-	desc := bleve.NewTextFieldMapping()
-	desc.Store = false
-	desc.Analyzer = "en"
-	doc.AddFieldMappingsAt("Description", desc)
+// Priority is the urgency of a todo.
+type Priority int8
 
-	arch := bleve.NewBooleanFieldMapping()
-	arch.Store = false
-	doc.AddFieldMappingsAt("Archived", arch)
+const (
+	PriorityNone Priority = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+	PriorityUrgent
+)
 
-	m := bleve.NewIndexMapping()
-	m.DefaultAnalyzer = "en"
-	m.DefaultMapping = doc
+// Priorities lists all priorities from lowest to highest.
+var Priorities = []Priority{
+	PriorityNone, PriorityLow, PriorityMedium, PriorityHigh, PriorityUrgent,
+}
 
-	idx, err := bleve.NewMemOnly(m)
-	if err != nil {
-		panic(err)
+func (p Priority) String() string {
+	switch p {
+	case PriorityNone:
+		return "none"
+	case PriorityLow:
+		return "low"
+	case PriorityMedium:
+		return "medium"
+	case PriorityHigh:
+		return "high"
+	case PriorityUrgent:
+		return "urgent"
 	}
-	return idx
+	return "unknown"
 }
 
-type Status int8
-
-const (
-	_ Status = iota
-	StatusOpen
-	StatusDone
-)
+// ParsePriority parses the string representation of a priority.
+// "" is parsed as PriorityNone.
+func ParsePriority(s string) (Priority, error) {
+	if s == "" {
+		return PriorityNone, nil
+	}
+	for _, p := range Priorities {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid priority: %q", s)
+}
 
 type Todo struct {
-	ID          int64
+	// ID is allocated sequentially by the store it was added to.
+	ID int64
+	// UID is a UUIDv7 that is safe to expose in URLs
+	// and unique across store instances.
+	UID string
+	// Version is incremented by one on every mutation.
+	Version int64
+	// Workspace is the ID of the workspace the todo belongs to,
+	// see WorkspaceStore. Todos can't be moved between workspaces,
+	// only todos without a workspace can be assigned one.
+	Workspace   int64
 	Title       string
 	Description string
 	Status      Status
 	Archived    bool
 	Created     time.Time
 	Due         time.Time
+	Tags        []string
+	Priority    Priority
+	Checklist   []ChecklistItem
+	// BlockedBy are the IDs of the todos that must be done
+	// before this one can start. A todo blocks all todos listing it.
+	BlockedBy []int64
+	// Assignees are the IDs of the users responsible for the todo,
+	// see UserStore.
+	Assignees []int64
+	// Attachments are the files attached to the todo, oldest first.
+	Attachments []Attachment
+	// Recurrence is the RRULE the todo repeats by, see ParseRecurrence.
+	// It's empty for todos that don't recur.
+	Recurrence string
+	// Trashed is the time the todo was moved to the trash,
+	// zero if it isn't in the trash.
+	Trashed time.Time
+	// Rank orders todos manually, see Store.Move.
+	// Ranks are compared lexicographically.
+	Rank string
+	// CreatedBy and UpdatedBy are the actors, see WithActor,
+	// that added the todo and last mutated it.
+	CreatedBy string
+	UpdatedBy string
 }
 
-type Store struct {
-	lock        sync.Mutex
-	todos       []*Todo
-	indexByID   map[int64]*Todo
-	searchIndex bleve.Index
-}
+// InTrash returns true if t was moved to the trash.
+func (t *Todo) InTrash() bool { return !t.Trashed.IsZero() }
 
-var idCounter atomic.Int64
+// purgeable returns true if t was moved to the trash of workspace before
+// the given time, see Store.Purge.
+func purgeable(t *Todo, workspace int64, before time.Time) bool {
+	return t.InTrash() && t.Trashed.Before(before) &&
+		(workspace == 0 || t.Workspace == workspace)
+}
 
 const (
 	TitleMaxLength       = 1024      // 1 KiB
 	DescriptionMaxLength = 16 * 1024 // 16 KiB
+	TagMaxLength         = 32
+	TagsMaxCount         = 16
 )
 
 type ErrorValidation struct {
-	TitleEmpty         bool
-	TitleTooLong       bool
-	DescriptionTooLong bool
+	TitleEmpty            bool
+	TitleTooLong          bool
+	DescriptionTooLong    bool
+	TagsTooMany           bool
+	TagInvalid            bool
+	PriorityInvalid       bool
+	ChecklistTooLong      bool
+	ChecklistItemInvalid  bool
+	RecurrenceInvalid     bool
+	BlockedByInvalid      bool
+	AssigneesInvalid      bool
+	AttachmentsTooMany    bool
+	AttachmentTooLarge    bool
+	AttachmentTypeInvalid bool
+	AttachmentInvalid     bool
+	CommentEmpty          bool
+	CommentTooLong        bool
 }
 
 func Validate(title, description string) ErrorValidation {
@@ -96,246 +252,214 @@ func Validate(title, description string) ErrorValidation {
 	}
 }
 
+// ValidateTags checks the number of tags and that every tag is at most
+// TagMaxLength bytes long and only consists of lower case letters, digits
+// and any of "-_./:+#".
+func ValidateTags(tags []string) ErrorValidation {
+	return ErrorValidation{
+		TagsTooMany: len(tags) > TagsMaxCount,
+		TagInvalid:  slices.ContainsFunc(tags, func(t string) bool { return !validTag(t) }),
+	}
+}
+
+func validTag(t string) bool {
+	if t == "" || len(t) > TagMaxLength {
+		return false
+	}
+	for _, r := range t {
+		switch {
+		case unicode.IsLetter(r) && !unicode.IsUpper(r):
+		case unicode.IsDigit(r):
+		case strings.ContainsRune("-_./:+#", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ParseTags parses a comma separated list of tags.
+// Tags are trimmed and lower cased, empty tags and duplicates are dropped.
+func ParseTags(s string) []string {
+	var tags []string
+	for t := range strings.SplitSeq(s, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t != "" && !slices.Contains(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// validate validates all fields of t.
+func validate(t *Todo) ErrorValidation {
+	v := Validate(t.Title, t.Description)
+	vt := ValidateTags(t.Tags)
+	v.TagsTooMany, v.TagInvalid = vt.TagsTooMany, vt.TagInvalid
+	v.PriorityInvalid = t.Priority < PriorityNone || t.Priority > PriorityUrgent
+	vc := ValidateChecklist(t.Checklist)
+	v.ChecklistTooLong, v.ChecklistItemInvalid = vc.ChecklistTooLong, vc.ChecklistItemInvalid
+	v.RecurrenceInvalid = ValidateRecurrence(t.Recurrence).RecurrenceInvalid
+	v.BlockedByInvalid = ValidateBlockers(t.BlockedBy).BlockedByInvalid
+	v.AssigneesInvalid = ValidateAssignees(t.Assignees).AssigneesInvalid
+	va := ValidateAttachments(t.Attachments)
+	v.AttachmentsTooMany, v.AttachmentTooLarge = va.AttachmentsTooMany, va.AttachmentTooLarge
+	v.AttachmentTypeInvalid, v.AttachmentInvalid = va.AttachmentTypeInvalid, va.AttachmentInvalid
+	return v
+}
+
 func (v ErrorValidation) IsErr() bool {
 	return v.TitleEmpty ||
 		v.TitleTooLong ||
-		v.DescriptionTooLong
+		v.DescriptionTooLong ||
+		v.TagsTooMany ||
+		v.TagInvalid ||
+		v.PriorityInvalid ||
+		v.ChecklistTooLong ||
+		v.ChecklistItemInvalid ||
+		v.RecurrenceInvalid ||
+		v.BlockedByInvalid ||
+		v.AssigneesInvalid ||
+		v.AttachmentsTooMany ||
+		v.AttachmentTooLarge ||
+		v.AttachmentTypeInvalid ||
+		v.AttachmentInvalid ||
+		v.CommentEmpty ||
+		v.CommentTooLong
 }
 
 func (v ErrorValidation) Error() string { return "invalid" }
 
-func (s *Store) Add(
-	_ context.Context, title, description string, now, due time.Time,
-) (id int64, err error) {
-	if err := Validate(title, description); err.IsErr() {
-		return 0, err
-	}
-
-	s.lock.Lock()
-	defer s.lock.Unlock()
-	newID := idCounter.Add(1)
-	t := &Todo{
-		ID:          newID,
-		Title:       title,
-		Description: description,
-		Status:      StatusOpen,
-		Created:     now,
-		Due:         due,
-	}
-
-	if err := s.searchIndex.Index(strconv.FormatInt(newID, 10), map[string]any{
-		"Title":       t.Title,
-		"Description": t.Description,
-		"Archived":    t.Archived,
-	}); err != nil {
-		// Roll back in case of index failure.
-		return 0, err
-	}
+var ErrNotExists = errors.New("not exists")
 
-	s.todos = append(s.todos, t)
-	s.indexByID[newID] = t
-	return newID, nil
+// ErrConflict is returned by Store.Edit when the todo was changed
+// by someone else since the expected version.
+type ErrConflict struct {
+	// Current is the current state of the todo.
+	Current Todo
 }
 
-func (s *Store) findByID(id int64) (*Todo, error) {
-	t, ok := s.indexByID[id]
-	if !ok {
-		return nil, ErrNotExists
-	}
-	return t, nil
+func (e ErrConflict) Error() string {
+	return fmt.Sprintf("conflict: todo %d is at version %d",
+		e.Current.ID, e.Current.Version)
 }
 
 type SearchFilters struct {
-	Archived  bool
+	// Workspace selects the todos of a workspace. 0 selects all todos.
+	Workspace int64
+	// Assignee selects the todos assigned to a user. 0 selects all todos.
+	Assignee int64
+	// Unassigned selects the todos without assignees.
+	Unassigned bool
+	Archived   bool
+	// Trashed selects the todos in the trash, archived or not,
+	// instead of the ones outside of it.
+	Trashed   bool
 	TextMatch string
+	// Tags selects todos having all of the tags.
+	Tags []string
+	// ExcludeTags selects todos having none of the tags.
+	ExcludeTags []string
+	Sort        SortKey
+	SortDesc    bool // Reverses the order of Sort.
+	// HideBlocked excludes todos blocked by open todos.
+	HideBlocked bool
 }
 
-func (s *Store) Search(_ context.Context, filters SearchFilters) (res []*Todo, err error) {
-	s.lock.Lock()
-	defer s.lock.Unlock()
-
-	if strings.TrimSpace(filters.TextMatch) == "" {
-		// Fast search with simple filters.
-		for _, t := range s.todos {
-			if !filters.Archived && t.Archived || filters.Archived && !t.Archived {
-				continue
-			}
-			res = append(res, t)
-		}
-		return res, nil
+func (f SearchFilters) match(t *Todo) bool {
+	if f.Workspace != 0 && f.Workspace != t.Workspace {
+		return false
 	}
-
-	// Slow search by text match.
-	q := buildBleveQuery(filters)
-	req := bleve.NewSearchRequest(q)
-	req.Size = len(s.todos)
-	idxRes, err := s.searchIndex.Search(req)
-	if err != nil {
-		return nil, fmt.Errorf("searching index: %w", err)
+	if f.Assignee != 0 && !t.AssignedTo(f.Assignee) ||
+		f.Unassigned && len(t.Assignees) > 0 {
+		return false
 	}
-
-	byID := make(map[int64]*Todo, len(s.todos))
-	for _, t := range s.todos {
-		byID[t.ID] = t
+	if f.Trashed != t.InTrash() || (!f.Trashed && f.Archived != t.Archived) {
+		return false
 	}
-
-	for _, h := range idxRes.Hits {
-		id64, err := strconv.ParseInt(h.ID, 10, 64)
-		if err != nil {
-			continue
-		}
-		t := byID[id64]
-		if t == nil {
-			continue
-		}
-		if !filters.Archived && t.Archived || filters.Archived && !t.Archived {
-			continue
+	for _, tag := range f.Tags {
+		if !slices.Contains(t.Tags, tag) {
+			return false
 		}
-		res = append(res, t)
 	}
-	return res, nil
-}
-
-func buildBleveQuery(f SearchFilters) blevequery.Query {
-	terms := strings.Fields(strings.TrimSpace(f.TextMatch))
-
-	var archQ blevequery.Query
-	if !f.Archived {
-		q := blevequery.NewBoolFieldQuery(false)
-		q.SetField("Archived")
-		archQ = q
-	}
-
-	if len(terms) == 0 {
-		if archQ != nil {
-			return bleve.NewConjunctionQuery(archQ)
+	for _, tag := range f.ExcludeTags {
+		if slices.Contains(t.Tags, tag) {
+			return false
 		}
-		return bleve.NewMatchAllQuery()
-	}
-
-	// Strategy 1: Try exact phrase match first (highest priority)
-	var exactQueries []blevequery.Query
-	fullText := strings.Join(terms, " ")
-
-	titlePhraseQuery := bleve.NewMatchPhraseQuery(fullText)
-	titlePhraseQuery.SetField("Title")
-	titlePhraseQuery.SetBoost(10.0) // High boost for exact title matches
-	exactQueries = append(exactQueries, titlePhraseQuery)
-
-	descPhraseQuery := bleve.NewMatchPhraseQuery(fullText)
-	descPhraseQuery.SetField("Description")
-	descPhraseQuery.SetBoost(2.0) // Lower boost for description matches
-	exactQueries = append(exactQueries, descPhraseQuery)
-
-	// Strategy 2: Individual term matches (for partial matches)
-	var termQueries []blevequery.Query
-	for _, term := range terms {
-		titleMatch := bleve.NewMatchQuery(term)
-		titleMatch.SetField("Title")
-		titleMatch.SetBoost(3.0) // Boost title matches
-
-		descMatch := bleve.NewMatchQuery(term)
-		descMatch.SetField("Description")
-		descMatch.SetBoost(1.0) // Normal boost for description
-
-		termQueries = append(termQueries, titleMatch, descMatch)
 	}
+	return true
+}
 
-	// Strategy 3: Fuzzy matching for typos
-	var fuzzyQueries []blevequery.Query
-	for _, term := range terms {
-		if len(term) > 3 { // Only fuzzy match longer terms
-			titleFuzzy := bleve.NewFuzzyQuery(term)
-			titleFuzzy.SetField("Title")
-			titleFuzzy.SetFuzziness(1) // Allow 1 character difference
-			titleFuzzy.SetBoost(0.5)   // Lower boost for fuzzy matches
-
-			descFuzzy := bleve.NewFuzzyQuery(term)
-			descFuzzy.SetField("Description")
-			descFuzzy.SetFuzziness(1)
-			descFuzzy.SetBoost(0.3)
-
-			fuzzyQueries = append(fuzzyQueries, titleFuzzy, descFuzzy)
-		}
+// matchBlocked returns false if f hides blocked todos and t is blocked.
+// get returns the todo by ID.
+func (f SearchFilters) matchBlocked(
+	t *Todo, get func(id int64) (*Todo, error),
+) (bool, error) {
+	if !f.HideBlocked {
+		return true, nil
 	}
+	blockers, err := openBlockers(t, get)
+	return len(blockers) == 0, err
+}
 
-	// Combine all strategies with OR (disjunction)
-	var allQueries []blevequery.Query
-	allQueries = append(allQueries, exactQueries...)
-	allQueries = append(allQueries, termQueries...)
-	allQueries = append(allQueries, fuzzyQueries...)
-
-	contentQuery := bleve.NewDisjunctionQuery(allQueries...)
-
-	// Apply archive filter if needed
-	if archQ != nil {
-		return bleve.NewConjunctionQuery(contentQuery, archQ)
-	}
+// TagCount is the number of todos having a tag.
+type TagCount struct {
+	Tag   string
+	Count int
+}
 
-	return contentQuery
+// newTodo returns a new open todo with ID id and the fields of t
+// added by the actor of ctx, see Store.Add.
+func newTodo(ctx context.Context, id int64, rank string, t Todo) *Todo {
+	t.ID, t.UID, t.Version, t.Rank = id, newUID(), 1, rank
+	t.CreatedBy, t.UpdatedBy = ActorFrom(ctx), ActorFrom(ctx)
+	t.Status, t.Archived, t.Trashed = StatusOpen, false, time.Time{}
+	return t.Clone()
 }
 
-var ErrNotExists = errors.New("not exists")
+// Clone returns a copy of t that doesn't share any slices with t.
+func (t *Todo) Clone() *Todo {
+	c := *t
+	c.Tags = slices.Clone(t.Tags)
+	c.Checklist = slices.Clone(t.Checklist)
+	c.BlockedBy = slices.Clone(t.BlockedBy)
+	c.Assignees = slices.Clone(t.Assignees)
+	c.Attachments = slices.Clone(t.Attachments)
+	return &c
+}
 
-func (s *Store) Edit(_ context.Context, id int64, mutate func(*Todo) error) error {
-	s.lock.Lock()
-	defer s.lock.Unlock()
+// detached returns true if before was archived or moved to the trash
+// into after which removes all of its blocked-by links.
+func detached(before, after *Todo) bool {
+	return (!before.Archived && after.Archived) || (!before.InTrash() && after.InTrash())
+}
 
-	todo, err := s.findByID(id)
-	if err != nil {
-		return err
+// editTodo calls mutate on a copy of todo and returns the validated copy
+// at the next version. See Store.Edit.
+func editTodo(todo *Todo, version int64, mutate func(*Todo) error) (*Todo, error) {
+	if version != 0 && version != todo.Version {
+		return nil, ErrConflict{Current: *todo.Clone()}
 	}
-	original := *todo
-	if err := mutate(todo); err != nil {
-		return err
+	updated := *todo.Clone() // Don't let mutate alias todo.
+	if err := mutate(&updated); err != nil {
+		return nil, err
 	}
-	if todo.ID != id {
-		panic("don't mutate todo IDs")
+	if detached(todo, &updated) {
+		// See Store.Archive.
+		updated.BlockedBy = nil
 	}
-	if err := Validate(todo.Title, todo.Description); err.IsErr() {
-		// Rollback
-		*todo = original
-		return err
+	if updated.ID != todo.ID || updated.UID != todo.UID {
+		panic("don't mutate todo IDs")
 	}
-
-	return s.searchIndex.Index(strconv.FormatInt(id, 10), map[string]any{
-		"Title":       todo.Title,
-		"Description": todo.Description,
-		"Archived":    todo.Archived,
-	})
-}
-
-func (s *Store) Archive(_ context.Context, id int64) error {
-	s.lock.Lock()
-	defer s.lock.Unlock()
-
-	todo, err := s.findByID(id)
-	if err != nil {
-		return err
+	if todo.Workspace != 0 && updated.Workspace != todo.Workspace {
+		panic("don't move todos between workspaces")
 	}
-	if err := s.searchIndex.Index(strconv.FormatInt(id, 10), map[string]any{
-		"Title":       todo.Title,
-		"Description": todo.Description,
-		"Archived":    todo.Archived,
-	}); err != nil {
-		return err
+	if updated.Rank != todo.Rank {
+		panic("use Store.Move to rank todos")
 	}
-	todo.Archived = true
-
-	return nil
-}
-
-func (s *Store) Delete(_ context.Context, id int64) error {
-	s.lock.Lock()
-	defer s.lock.Unlock()
-
-	todo, err := s.findByID(id)
-	if err != nil {
-		return err
+	if err := validate(&updated); err.IsErr() {
+		return nil, err
 	}
-	todo.Archived = true
-
-	s.todos = slices.DeleteFunc(s.todos, func(t *Todo) bool { return t.ID == id })
-	delete(s.indexByID, id)
-	return s.searchIndex.Delete(strconv.FormatInt(id, 10))
+	updated.Version = todo.Version + 1
+	return &updated, nil
 }
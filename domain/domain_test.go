@@ -2,6 +2,12 @@ package domain_test
 
 import (
 	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -9,33 +15,114 @@ import (
 	"github.com/romshark/todostar/domain"
 
 	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
 )
 
+// backends lists all Store implementations the conformance suite runs against.
+var backends = []struct {
+	name       string
+	persistent bool
+	open       func(t *testing.T, dir string) domain.Store
+}{
+	{
+		name: "mem",
+		open: func(t *testing.T, dir string) domain.Store { return domain.New() },
+	},
+	{
+		name:       "journal",
+		persistent: true,
+		open: func(t *testing.T, dir string) domain.Store {
+			s, err := domain.Open(dir, domain.Options{})
+			require.NoError(t, err)
+			return s
+		},
+	},
+	{
+		name:       "bolt",
+		persistent: true,
+		open: func(t *testing.T, dir string) domain.Store {
+			s, err := domain.OpenBolt(filepath.Join(dir, "todos.db"), domain.Options{})
+			require.NoError(t, err)
+			return s
+		},
+	},
+	{
+		name:       "journal_diskindex",
+		persistent: true,
+		open: func(t *testing.T, dir string) domain.Store {
+			s, err := domain.Open(dir, diskIndex(dir))
+			require.NoError(t, err)
+			return s
+		},
+	},
+	{
+		name:       "bolt_diskindex",
+		persistent: true,
+		open: func(t *testing.T, dir string) domain.Store {
+			s, err := domain.OpenBolt(filepath.Join(dir, "todos.db"), diskIndex(dir))
+			require.NoError(t, err)
+			return s
+		},
+	},
+}
+
+func diskIndex(dir string) domain.Options {
+	return domain.Options{IndexPath: filepath.Join(dir, "index.bleve")}
+}
+
+// forEachBackend runs test against a new empty store of every backend.
+func forEachBackend(t *testing.T, test func(t *testing.T, s domain.Store)) {
+	t.Helper()
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			s := b.open(t, t.TempDir())
+			t.Cleanup(func() { require.NoError(t, s.Close()) })
+			test(t, s)
+		})
+	}
+}
+
 func TestStore(t *testing.T) {
-	s := domain.New()
+	forEachBackend(t, testStore)
+}
 
+func testStore(t *testing.T, s domain.Store) {
 	c := collectAll(t, s, domain.SearchFilters{})
 	require.Len(t, c, 0)
 
-	now := time.Now()
+	// Strip the monotonic clock reading and location,
+	// persistent backends don't preserve them.
+	now := time.Now().Round(0).UTC()
 
-	id, err := s.Add(t.Context(), "New Todo", "some description", now, now.Add(time.Hour))
+	id, err := s.Add(t.Context(), domain.Todo{
+		Title:       "New Todo",
+		Description: "some description",
+		Created:     now,
+		Due:         now.Add(time.Hour),
+	})
 	require.NoError(t, err)
 	require.Equal(t, int64(1), id)
 
 	c = collectAll(t, s, domain.SearchFilters{})
+	require.Len(t, c, 1)
+	uid, rank := c[0].UID, c[0].Rank
+	require.Regexp(t, uuidV7, uid)
+	require.NotEmpty(t, rank)
 	require.Equal(t, []*domain.Todo{
 		{
 			ID:          id,
+			UID:         uid,
+			Version:     1,
 			Title:       "New Todo",
 			Description: "some description",
 			Status:      domain.StatusOpen,
 			Created:     now,
 			Due:         now.Add(time.Hour),
+			Rank:        rank,
 		},
 	}, c)
 
-	err = s.Edit(t.Context(), id, func(t *domain.Todo) error {
+	err = s.Edit(t.Context(), id, 0, func(t *domain.Todo) error {
 		t.Status = domain.StatusDone
 		return nil
 	})
@@ -45,11 +132,14 @@ func TestStore(t *testing.T) {
 	require.Equal(t, []*domain.Todo{
 		{
 			ID:          id,
+			UID:         uid,
+			Version:     2, // changed.
 			Title:       "New Todo",
 			Description: "some description",
 			Status:      domain.StatusDone, // changed.
 			Created:     now,
 			Due:         now.Add(time.Hour),
+			Rank:        rank,
 		},
 	}, c)
 
@@ -64,20 +154,206 @@ func TestStore(t *testing.T) {
 
 	c = collectAll(t, s, domain.SearchFilters{Archived: true})
 	require.Len(t, c, 0)
+
+	c = collectAll(t, s, domain.SearchFilters{Trashed: true})
+	require.Len(t, c, 1)
+	require.Equal(t, id, c[0].ID)
+}
+
+var uuidV7 = `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`
+
+func TestIDsPerStore(t *testing.T) {
+	now := time.Now()
+	s1, s2 := domain.New(), domain.New()
+
+	id, err := s1.Add(t.Context(), domain.Todo{Title: "First in s1", Created: now})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), id)
+
+	id, err = s2.Add(t.Context(), domain.Todo{Title: "First in s2", Created: now})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), id, "stores must not share an ID sequence")
+}
+
+func TestGetByUID(t *testing.T) {
+	forEachBackend(t, testGetByUID)
+}
+
+func testGetByUID(t *testing.T, s domain.Store) {
+	now := time.Now()
+	id1, err := s.Add(t.Context(), domain.Todo{Title: "First", Created: now})
+	require.NoError(t, err)
+	id2, err := s.Add(t.Context(), domain.Todo{Title: "Second", Created: now})
+	require.NoError(t, err)
+
+	c := collectAll(t, s, domain.SearchFilters{})
+	require.Len(t, c, 2)
+	require.NotEqual(t, c[0].UID, c[1].UID)
+
+	for i, id := range []int64{id1, id2} {
+		todo, err := s.GetByUID(t.Context(), c[i].UID)
+		require.NoError(t, err)
+		require.Equal(t, id, todo.ID)
+	}
+
+	// Todos in the trash are still found.
+	require.NoError(t, s.Delete(t.Context(), id1))
+	_, err = s.GetByUID(t.Context(), c[0].UID)
+	require.NoError(t, err)
+
+	_, err = s.Purge(t.Context(), 0, time.Now())
+	require.NoError(t, err)
+	_, err = s.GetByUID(t.Context(), c[0].UID)
+	require.ErrorIs(t, err, domain.ErrNotExists)
+
+	_, err = s.GetByUID(t.Context(), "unknown")
+	require.ErrorIs(t, err, domain.ErrNotExists)
+}
+
+func TestReturnedTodosAreCopies(t *testing.T) {
+	forEachBackend(t, testReturnedTodosAreCopies)
+}
+
+func testReturnedTodosAreCopies(t *testing.T, s domain.Store) {
+	id, err := s.Add(t.Context(), domain.Todo{
+		Title:     "Original",
+		Tags:      []string{"a"},
+		Checklist: []domain.ChecklistItem{{Title: "item"}},
+	})
+	require.NoError(t, err)
+
+	got, err := s.Get(t.Context(), id)
+	require.NoError(t, err)
+	byUID, err := s.GetByUID(t.Context(), got.UID)
+	require.NoError(t, err)
+	found := collectAll(t, s, domain.SearchFilters{})
+	require.Len(t, found, 1)
+	matched := collectAll(t, s, domain.SearchFilters{TextMatch: "Original"})
+	require.Len(t, matched, 1)
+	snapshot := *got
+
+	err = s.Edit(t.Context(), id, 0, func(t *domain.Todo) error {
+		t.Title = "Edited"
+		t.Tags[0] = "b"
+		t.Checklist[0].Done = true
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.Delete(t.Context(), id))
+
+	for _, todo := range []*domain.Todo{got, byUID, found[0], matched[0]} {
+		require.Equal(t, &snapshot, todo)
+	}
+
+	// Mutating returned todos doesn't change the store either.
+	got.Title, got.Tags[0] = "Mutated", "c"
+	current, err := s.Get(t.Context(), id)
+	require.NoError(t, err)
+	require.Equal(t, "Edited", current.Title)
+	require.Equal(t, []string{"b"}, current.Tags)
+	require.True(t, current.InTrash())
+}
+
+func TestTrash(t *testing.T) {
+	forEachBackend(t, testTrash)
+}
+
+func testTrash(t *testing.T, s domain.Store) {
+	now := time.Now()
+	id1, err := s.Add(t.Context(), domain.Todo{Title: "First", Created: now})
+	require.NoError(t, err)
+	id2, err := s.Add(t.Context(), domain.Todo{
+		Title:       "Second",
+		Description: "unique needle",
+		Created:     now,
+	})
+	require.NoError(t, err)
+	id3, err := s.Add(t.Context(), domain.Todo{
+		Title:       "Third",
+		Description: "archived needle",
+		Created:     now,
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.Archive(t.Context(), id3))
+
+	require.ErrorIs(t, s.Restore(t.Context(), id2), domain.ErrNotExists)
+	require.NoError(t, s.Delete(t.Context(), id2))
+	require.ErrorIs(t, s.Delete(t.Context(), id2), domain.ErrNotExists)
+	require.NoError(t, s.Delete(t.Context(), id3))
+
+	// Trashed todos are neither listed nor found outside of the trash.
+	c := collectAll(t, s, domain.SearchFilters{})
+	require.Len(t, c, 1)
+	require.Equal(t, id1, c[0].ID)
+	c = collectAll(t, s, domain.SearchFilters{Archived: true})
+	require.Len(t, c, 0)
+	c = collectAll(t, s, domain.SearchFilters{TextMatch: "needle"})
+	require.Len(t, c, 0)
+
+	// The trash contains archived and unarchived todos.
+	c = collectAll(t, s, domain.SearchFilters{Trashed: true})
+	require.Len(t, c, 2)
+	require.Equal(t, id2, c[0].ID)
+	require.False(t, c[0].Trashed.Before(now))
+	require.Equal(t, id3, c[1].ID)
+	require.True(t, c[1].Archived)
+	c = collectAll(t, s, domain.SearchFilters{Trashed: true, TextMatch: "needle"})
+	require.Len(t, c, 2)
+
+	require.NoError(t, s.Restore(t.Context(), id2))
+	restored, err := s.Get(t.Context(), id2)
+	require.NoError(t, err)
+	require.False(t, restored.InTrash())
+	require.Equal(t, int64(3), restored.Version)
+	c = collectAll(t, s, domain.SearchFilters{TextMatch: "needle"})
+	require.Len(t, c, 1)
+	require.Equal(t, id2, c[0].ID)
+
+	// Only todos trashed before the given time are purged.
+	n, err := s.Purge(t.Context(), 0, now)
+	require.NoError(t, err)
+	require.Zero(t, n)
+	n, err = s.Purge(t.Context(), 0, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	_, err = s.Get(t.Context(), id3)
+	require.ErrorIs(t, err, domain.ErrNotExists)
+	c = collectAll(t, s, domain.SearchFilters{Trashed: true})
+	require.Len(t, c, 0)
+
+	h, err := s.History(t.Context(), domain.HistoryFilter{TodoID: id3})
+	require.NoError(t, err)
+	require.Len(t, h, 4)
+	require.Equal(t, domain.MutationTrash, h[2].Mutation)
+	require.Equal(t, domain.MutationDelete, h[3].Mutation)
 }
 
 func TestSearch(t *testing.T) {
-	s := domain.New()
+	forEachBackend(t, testSearch)
+}
+
+func testSearch(t *testing.T, s domain.Store) {
 	now := time.Now()
 
-	_, err := s.Add(t.Context(),
-		"New Todo", "some description", now, now.Add(time.Hour))
+	_, err := s.Add(t.Context(), domain.Todo{
+		Title:       "New Todo",
+		Description: "some description",
+		Created:     now,
+		Due:         now.Add(time.Hour),
+	})
 	require.NoError(t, err)
-	_, err = s.Add(t.Context(),
-		"Won't match", "this will not match by text", now, now.Add(time.Hour))
+	_, err = s.Add(t.Context(), domain.Todo{
+		Title:       "Won't match",
+		Description: "this will not match by text",
+		Created:     now,
+		Due:         now.Add(time.Hour),
+	})
 	require.NoError(t, err)
-	_, err = s.Add(t.Context(),
-		"Another New Todo", "", now, now.Add(time.Hour))
+	_, err = s.Add(t.Context(), domain.Todo{
+		Title:   "Another New Todo",
+		Created: now,
+		Due:     now.Add(time.Hour),
+	})
 	require.NoError(t, err)
 
 	c := collectAll(t, s, domain.SearchFilters{
@@ -89,8 +365,11 @@ func TestSearch(t *testing.T) {
 }
 
 func TestStoreChangeStatusErrNotExist(t *testing.T) {
-	s := domain.New()
-	err := s.Edit(t.Context(), 1, func(t *domain.Todo) error {
+	forEachBackend(t, testStoreChangeStatusErrNotExist)
+}
+
+func testStoreChangeStatusErrNotExist(t *testing.T, s domain.Store) {
+	err := s.Edit(t.Context(), 1, 0, func(t *domain.Todo) error {
 		t.Status = domain.StatusDone
 		t.Due = t.Due.Add(2 * time.Hour)
 		return nil
@@ -98,41 +377,1888 @@ func TestStoreChangeStatusErrNotExist(t *testing.T) {
 	require.ErrorIs(t, err, domain.ErrNotExists)
 }
 
-func TestValidate(t *testing.T) {
-	s := domain.New()
+func TestEditConflict(t *testing.T) {
+	forEachBackend(t, testEditConflict)
+}
 
-	{ // Title
-		id, err := s.Add(t.Context(), "", "", time.Now(), time.Now().Add(time.Minute))
-		var v domain.ErrorValidation
-		require.ErrorAs(t, err, &v)
-		require.Zero(t, id)
-		require.Equal(t, domain.ErrorValidation{
-			TitleEmpty: true,
-		}, v)
-		c := collectAll(t, s, domain.SearchFilters{})
-		require.Len(t, c, 0)
+func testEditConflict(t *testing.T, s domain.Store) {
+	id, err := s.Add(t.Context(), domain.Todo{Title: "Original", Created: time.Now()})
+	require.NoError(t, err)
+
+	// Alice and Bob both start editing version 1.
+	err = s.Edit(t.Context(), id, 1, func(t *domain.Todo) error {
+		t.Title = "Alice's title"
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = s.Edit(t.Context(), id, 1, func(t *domain.Todo) error {
+		t.Title = "Bob's title"
+		return nil
+	})
+	var errConflict domain.ErrConflict
+	require.ErrorAs(t, err, &errConflict)
+	require.Equal(t, int64(2), errConflict.Current.Version)
+	require.Equal(t, "Alice's title", errConflict.Current.Title)
+
+	c := collectAll(t, s, domain.SearchFilters{})
+	require.Len(t, c, 1)
+	require.Equal(t, "Alice's title", c[0].Title, "must not be overwritten")
+
+	// Bob retries at the current version.
+	err = s.Edit(t.Context(), id, 2, func(t *domain.Todo) error {
+		t.Title = "Bob's title"
+		return nil
+	})
+	require.NoError(t, err)
+
+	// Unconditional edits and archiving always succeed and bump the version.
+	err = s.Edit(t.Context(), id, 0, func(t *domain.Todo) error {
+		t.Status = domain.StatusDone
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.Archive(t.Context(), id))
+
+	c = collectAll(t, s, domain.SearchFilters{Archived: true})
+	require.Len(t, c, 1)
+	require.Equal(t, "Bob's title", c[0].Title)
+	require.Equal(t, int64(5), c[0].Version)
+}
+
+func TestHistory(t *testing.T) {
+	forEachBackend(t, testHistory)
+}
+
+func testHistory(t *testing.T, s domain.Store) {
+	alice := domain.WithActor(t.Context(), "alice")
+	bob := domain.WithActor(t.Context(), "bob")
+	start := time.Now()
+	due := time.Date(2030, 1, 2, 3, 4, 0, 0, time.UTC)
+
+	id, err := s.Add(alice, domain.Todo{Title: "Buy milk", Created: start})
+	require.NoError(t, err)
+	otherID, err := s.Add(alice, domain.Todo{Title: "Unrelated", Created: start})
+	require.NoError(t, err)
+
+	err = s.Edit(bob, id, 0, func(t *domain.Todo) error {
+		t.Title, t.Status, t.Due = "Buy oat milk", domain.StatusDone, due
+		return nil
+	})
+	require.NoError(t, err)
+	todo, err := s.Get(t.Context(), id)
+	require.NoError(t, err)
+	require.Equal(t, "alice", todo.CreatedBy)
+	require.Equal(t, "bob", todo.UpdatedBy)
+	require.NoError(t, s.Archive(alice, id))
+	require.NoError(t, s.Delete(bob, id))
+	_, err = s.Purge(alice, 0, time.Now())
+	require.NoError(t, err)
+
+	h, err := s.History(t.Context(), domain.HistoryFilter{TodoID: id})
+	require.NoError(t, err)
+	require.Len(t, h, 5)
+	for i, e := range h {
+		require.Equal(t, id, e.TodoID)
+		require.False(t, e.Time.Before(start))
+		if i > 0 {
+			require.False(t, e.Time.Before(h[i-1].Time), "must be chronological")
+		}
 	}
 
-	{ // Title and description too long
-		title := strings.Repeat("x", domain.TitleMaxLength+1)
-		desc := strings.Repeat("x", domain.DescriptionMaxLength+1)
-		id, err := s.Add(
-			t.Context(), title, desc, time.Now(), time.Now().Add(time.Minute),
-		)
-		var v domain.ErrorValidation
-		require.ErrorAs(t, err, &v)
-		require.Zero(t, id)
-		require.Equal(t, domain.ErrorValidation{
-			TitleTooLong:       true,
-			DescriptionTooLong: true,
-		}, v)
-		c := collectAll(t, s, domain.SearchFilters{})
-		require.Len(t, c, 0)
+	require.Equal(t, domain.MutationAdd, h[0].Mutation)
+	require.Equal(t, "alice", h[0].Actor)
+	require.Equal(t, int64(1), h[0].Version)
+	require.Equal(t, []domain.FieldChange{
+		{Field: "Title", Old: "", New: "Buy milk"},
+		{Field: "Status", Old: "", New: "open"},
+	}, h[0].Changes)
+
+	require.Equal(t, domain.MutationEdit, h[1].Mutation)
+	require.Equal(t, "bob", h[1].Actor)
+	require.Equal(t, int64(2), h[1].Version)
+	require.Equal(t, []domain.FieldChange{
+		{Field: "Title", Old: "Buy milk", New: "Buy oat milk"},
+		{Field: "Status", Old: "open", New: "done"},
+		{Field: "Due", Old: "", New: "2030-01-02T03:04:00Z"},
+	}, h[1].Changes)
+
+	require.Equal(t, domain.MutationArchive, h[2].Mutation)
+	require.Equal(t, "alice", h[2].Actor)
+	require.Equal(t, []domain.FieldChange{
+		{Field: "Archived", Old: "", New: "true"},
+	}, h[2].Changes)
+
+	require.Equal(t, domain.MutationTrash, h[3].Mutation)
+	require.Equal(t, "bob", h[3].Actor)
+	require.Equal(t, int64(4), h[3].Version)
+
+	require.Equal(t, domain.MutationDelete, h[4].Mutation)
+	require.Equal(t, "alice", h[4].Actor)
+	require.Equal(t, int64(4), h[4].Version)
+
+	// Query across todos for reports.
+	h, err = s.History(t.Context(), domain.HistoryFilter{Actor: "alice"})
+	require.NoError(t, err)
+	require.Len(t, h, 4)
+	require.Equal(t, otherID, h[1].TodoID)
+
+	h, err = s.History(t.Context(), domain.HistoryFilter{Until: start})
+	require.NoError(t, err)
+	require.Len(t, h, 0)
+
+	h, err = s.History(t.Context(), domain.HistoryFilter{Since: start})
+	require.NoError(t, err)
+	require.Len(t, h, 6)
+}
+
+func TestUsers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	s, err := domain.OpenUsers(path)
+	require.NoError(t, err)
+
+	id, err := s.AddUser(t.Context(), domain.User{
+		Name: "alice", DisplayName: "Alice", Email: "alice@example.com",
+	}, "correct horse")
+	require.NoError(t, err)
+
+	_, err = s.AddUser(t.Context(), domain.User{Name: "alice"}, "battery staple")
+	require.ErrorIs(t, err, domain.ErrUserExists)
+
+	_, err = s.AddUser(t.Context(), domain.User{Name: "Bob"}, "battery staple")
+	require.Equal(t, domain.ErrorValidationUser{NameInvalid: true}, err)
+	_, err = s.AddUser(t.Context(), domain.User{Name: "bob"}, "short")
+	require.Equal(t, domain.ErrorValidationUser{PasswordTooWeak: true}, err)
+
+	_, err = s.Authenticate(t.Context(), "alice", "wrong password")
+	require.ErrorIs(t, err, domain.ErrInvalidCredentials)
+	_, err = s.Authenticate(t.Context(), "nobody", "correct horse")
+	require.ErrorIs(t, err, domain.ErrInvalidCredentials)
+
+	// Users must survive reopening.
+	s, err = domain.OpenUsers(path)
+	require.NoError(t, err)
+	n, err := s.CountUsers(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	u, err := s.Authenticate(t.Context(), "alice", "correct horse")
+	require.NoError(t, err)
+	require.Equal(t, id, u.ID)
+	require.Equal(t, "Alice", u.DisplayName)
+	require.Equal(t, "alice@example.com", u.Email)
+	require.NotContains(t, string(u.PasswordHash), "correct horse")
+
+	_, err = s.GetUser(t.Context(), id+1)
+	require.ErrorIs(t, err, domain.ErrNotExists)
+
+	ctx := domain.WithUser(t.Context(), u)
+	require.Equal(t, u, domain.UserFrom(ctx))
+	require.Equal(t, "alice", domain.ActorFrom(ctx))
+}
+
+func TestProvisionUser(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	s, err := domain.OpenUsers(path)
+	require.NoError(t, err)
+	_, err = s.AddUser(t.Context(), domain.User{Name: "jane"}, "correct horse")
+	require.NoError(t, err)
+
+	const issuer = "https://sso.example.com"
+	u, err := s.ProvisionUser(t.Context(), issuer, "sub1", domain.User{
+		Name: "Jane", DisplayName: "Jane Doe", Email: "jane@example.com",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "jane2", u.Name, "names must be unique")
+	require.Equal(t, "Jane Doe", u.DisplayName)
+	require.Equal(t, issuer, u.Issuer)
+	require.Equal(t, "sub1", u.Subject)
+	require.Empty(t, u.PasswordHash)
+
+	other, err := s.ProvisionUser(t.Context(), "https://other.example.com", "sub1",
+		domain.User{Name: "Jäne Doe!"})
+	require.NoError(t, err)
+	require.NotEqual(t, u.ID, other.ID, "subjects are scoped to the issuer")
+	require.Equal(t, "jänedoe", other.Name)
+
+	nameless, err := s.ProvisionUser(t.Context(), issuer, "sub2", domain.User{})
+	require.NoError(t, err)
+	require.Equal(t, "user", nameless.Name)
+
+	// Provisioned users can't log in with a password.
+	_, err = s.Authenticate(t.Context(), "jane2", "")
+	require.ErrorIs(t, err, domain.ErrInvalidCredentials)
+
+	// Later logins update the claims, also after reopening.
+	s, err = domain.OpenUsers(path)
+	require.NoError(t, err)
+	again, err := s.ProvisionUser(t.Context(), issuer, "sub1", domain.User{
+		Name: "janed", DisplayName: "Jane Smith", Email: "smith@example.com",
+	})
+	require.NoError(t, err)
+	require.Equal(t, u.ID, again.ID)
+	require.Equal(t, "jane2", again.Name)
+	require.Equal(t, "Jane Smith", again.DisplayName)
+	require.Equal(t, "smith@example.com", again.Email)
+	n, err := s.CountUsers(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+}
+
+func TestWorkspaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "workspaces.json")
+	s, err := domain.OpenWorkspaces(path)
+	require.NoError(t, err)
+
+	const alice, bob, carol = 1, 2, 3
+	_, err = s.AddWorkspace(t.Context(), " ", alice)
+	require.Equal(t, domain.ErrorValidationWorkspace{NameEmpty: true}, err)
+
+	team, err := s.AddWorkspace(t.Context(), "Team", alice)
+	require.NoError(t, err)
+	private, err := s.AddWorkspace(t.Context(), "Private", bob)
+	require.NoError(t, err)
+
+	require.NoError(t, s.SetRole(t.Context(), team, bob, domain.RoleEditor))
+	require.NoError(t, s.SetRole(t.Context(), team, carol, domain.RoleViewer))
+	require.ErrorIs(t, s.SetRole(t.Context(), team, alice, domain.RoleEditor),
+		domain.ErrLastAdmin)
+	require.ErrorIs(t, s.SetRole(t.Context(), team, alice, domain.RoleNone),
+		domain.ErrLastAdmin)
+	require.ErrorIs(t, s.SetRole(t.Context(), 42, alice, domain.RoleViewer),
+		domain.ErrNotExists)
+
+	// Admins can step down once there's another admin.
+	require.NoError(t, s.SetRole(t.Context(), team, bob, domain.RoleAdmin))
+	require.NoError(t, s.SetRole(t.Context(), team, alice, domain.RoleNone))
+
+	// Workspaces must survive reopening.
+	s, err = domain.OpenWorkspaces(path)
+	require.NoError(t, err)
+	ws, err := s.GetWorkspace(t.Context(), team)
+	require.NoError(t, err)
+	require.Equal(t, "Team", ws.Name)
+	require.Equal(t, domain.RoleNone, ws.Role(alice))
+	require.Equal(t, domain.RoleAdmin, ws.Role(bob))
+	require.Equal(t, domain.RoleViewer, ws.Role(carol))
+
+	l, err := s.Workspaces(t.Context(), bob)
+	require.NoError(t, err)
+	require.Len(t, l, 2)
+	require.Equal(t, team, l[0].ID)
+	require.Equal(t, private, l[1].ID)
+	l, err = s.Workspaces(t.Context(), alice)
+	require.NoError(t, err)
+	require.Empty(t, l)
+
+	// Returned workspaces are copies.
+	ws.Members[alice] = domain.RoleAdmin
+	ws, err = s.GetWorkspace(t.Context(), team)
+	require.NoError(t, err)
+	require.Equal(t, domain.RoleNone, ws.Role(alice))
+
+	for _, r := range append(domain.Roles, domain.RoleNone) {
+		parsed, err := domain.ParseRole(r.String())
+		require.NoError(t, err)
+		require.Equal(t, r, parsed)
+	}
+	_, err = domain.ParseRole("owner")
+	require.Error(t, err)
+}
+
+func TestWorkspaceTodos(t *testing.T) {
+	forEachBackend(t, testWorkspaceTodos)
+}
+
+func testWorkspaceTodos(t *testing.T, s domain.Store) {
+	ctx := t.Context()
+	add := func(workspace int64, title string, blockedBy ...int64) (int64, error) {
+		return s.Add(ctx, domain.Todo{
+			Workspace: workspace, Title: title, Tags: []string{"shared"},
+			BlockedBy: blockedBy,
+		})
+	}
+	a1, err := add(1, "A1")
+	require.NoError(t, err)
+	a2, err := add(1, "A2", a1)
+	require.NoError(t, err)
+	b1, err := add(2, "B1")
+	require.NoError(t, err)
+
+	// Todos can only be blocked by todos of the same workspace.
+	_, err = add(2, "B2", a1)
+	require.ErrorAs(t, err, new(domain.ErrorValidation))
+	require.ErrorAs(t, s.Edit(ctx, b1, 0, func(t *domain.Todo) error {
+		t.BlockedBy = []int64{a2}
+		return nil
+	}), new(domain.ErrorValidation))
+
+	ids := func(filters domain.SearchFilters) (ids []int64) {
+		t.Helper()
+		for _, todo := range collectAll(t, s, filters) {
+			ids = append(ids, todo.ID)
+		}
+		return ids
+	}
+	require.Equal(t, []int64{a1, a2}, ids(domain.SearchFilters{Workspace: 1}))
+	require.Equal(t, []int64{b1}, ids(domain.SearchFilters{Workspace: 2}))
+	require.Equal(t, []int64{b1}, ids(domain.SearchFilters{
+		Workspace: 2, TextMatch: "B1",
+	}))
+	require.Empty(t, ids(domain.SearchFilters{Workspace: 2, TextMatch: "A1"}))
+	require.Len(t, ids(domain.SearchFilters{}), 3)
+
+	tags, err := s.TagCounts(ctx, domain.SearchFilters{Workspace: 1})
+	require.NoError(t, err)
+	require.Equal(t, []domain.TagCount{{Tag: "shared", Count: 2}}, tags)
+
+	// Next occurrences of recurring todos stay in their workspace.
+	require.NoError(t, s.Edit(ctx, b1, 0, func(t *domain.Todo) error {
+		t.Recurrence = "FREQ=DAILY"
+		return nil
+	}))
+	require.NoError(t, s.Edit(ctx, b1, 0, func(t *domain.Todo) error {
+		t.Status = domain.StatusDone
+		return nil
+	}))
+	require.Len(t, ids(domain.SearchFilters{Workspace: 2}), 2)
+
+	// Purging the trash of one workspace leaves the others untouched.
+	require.NoError(t, s.Delete(ctx, a1))
+	require.NoError(t, s.Delete(ctx, b1))
+	n, err := s.Purge(ctx, 2, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, []int64{a1}, ids(domain.SearchFilters{Trashed: true}))
+}
+
+func TestAssignees(t *testing.T) {
+	forEachBackend(t, testAssignees)
+}
+
+func testAssignees(t *testing.T, s domain.Store) {
+	ctx := t.Context()
+	const alice, bob = 1, 2
+	add := func(title string, tag string, assignees ...int64) int64 {
+		t.Helper()
+		id, err := s.Add(ctx, domain.Todo{
+			Title: title, Tags: []string{tag}, Assignees: assignees,
+		})
+		require.NoError(t, err)
+		return id
+	}
+	both := add("Plan the offsite", "team", alice, bob)
+	mine := add("Book the venue", "venue", alice)
+	nobody := add("Order snacks", "food")
+
+	_, err := s.Add(ctx, domain.Todo{Title: "Twice", Assignees: []int64{bob, bob}})
+	require.Equal(t, domain.ErrorValidation{AssigneesInvalid: true}, err)
+	require.Equal(t, domain.ErrorValidation{AssigneesInvalid: true},
+		domain.ValidateAssignees(make([]int64, domain.AssigneesMaxCount+1)))
+
+	ids := func(filters domain.SearchFilters) (ids []int64) {
+		t.Helper()
+		for _, todo := range collectAll(t, s, filters) {
+			ids = append(ids, todo.ID)
+		}
+		return ids
 	}
+	require.Equal(t, []int64{both, mine}, ids(domain.SearchFilters{Assignee: alice}))
+	require.Equal(t, []int64{both}, ids(domain.SearchFilters{Assignee: bob}))
+	require.Equal(t, []int64{nobody}, ids(domain.SearchFilters{Unassigned: true}))
+	require.Equal(t, []int64{mine}, ids(domain.SearchFilters{
+		Assignee: alice, TextMatch: "venue",
+	}))
+
+	tags, err := s.TagCounts(ctx, domain.SearchFilters{Assignee: bob})
+	require.NoError(t, err)
+	require.Equal(t, []domain.TagCount{{Tag: "team", Count: 1}}, tags)
+	tags, err = s.TagCounts(ctx, domain.SearchFilters{Unassigned: true})
+	require.NoError(t, err)
+	require.Equal(t, []domain.TagCount{{Tag: "food", Count: 1}}, tags)
+
+	// Reassigning is recorded in the history.
+	require.NoError(t, s.Edit(ctx, nobody, 0, func(t *domain.Todo) error {
+		t.Assignees = []int64{bob}
+		return nil
+	}))
+	require.Equal(t, []int64{both, nobody}, ids(domain.SearchFilters{Assignee: bob}))
+	require.Empty(t, ids(domain.SearchFilters{Unassigned: true}))
+	entries, err := s.History(ctx, domain.HistoryFilter{TodoID: nobody})
+	require.NoError(t, err)
+	require.Equal(t, []domain.FieldChange{{Field: "Assignees", New: "2"}},
+		entries[len(entries)-1].Changes)
+
+	// Next occurrences of recurring todos keep their assignees.
+	require.NoError(t, s.Edit(ctx, mine, 0, func(t *domain.Todo) error {
+		t.Recurrence = "FREQ=WEEKLY"
+		t.Status = domain.StatusDone
+		return nil
+	}))
+	l := ids(domain.SearchFilters{Assignee: alice})
+	require.Len(t, l, 3)
+	require.Equal(t, []int64{both, mine}, l[:2])
+}
+
+func TestComments(t *testing.T) {
+	forEachBackend(t, testComments)
+}
+
+func testComments(t *testing.T, s domain.Store) {
+	ctx := t.Context()
+	const alice, bob = 1, 2
+	id, err := s.Add(ctx, domain.Todo{Title: "Plan the offsite"})
+	require.NoError(t, err)
+	other, err := s.Add(ctx, domain.Todo{Title: "Order snacks"})
+	require.NoError(t, err)
+
+	c1, err := s.AddComment(ctx, domain.Comment{
+		TodoID: id, Author: alice, Text: "How about the lighthouse?",
+	})
+	require.NoError(t, err)
+	c2, err := s.AddComment(ctx, domain.Comment{
+		TodoID: id, Author: bob, Text: "Too far, let's *stay* in town",
+	})
+	require.NoError(t, err)
+	require.Greater(t, c2, c1)
+
+	_, err = s.AddComment(ctx, domain.Comment{TodoID: id, Author: bob, Text: " \n"})
+	require.Equal(t, domain.ErrorValidation{CommentEmpty: true}, err)
+	_, err = s.AddComment(ctx, domain.Comment{
+		TodoID: id, Author: bob, Text: strings.Repeat("x", domain.CommentMaxLength+1),
+	})
+	require.Equal(t, domain.ErrorValidation{CommentTooLong: true}, err)
+	_, err = s.AddComment(ctx, domain.Comment{TodoID: 999, Author: bob, Text: "?"})
+	require.ErrorIs(t, err, domain.ErrNotExists)
+
+	l, err := s.Comments(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, l, 2)
+	require.Equal(t, c1, l[0].ID)
+	require.Equal(t, int64(alice), l[0].Author)
+	require.Equal(t, "How about the lighthouse?", l[0].Text)
+	require.False(t, l[0].Created.IsZero())
+	require.True(t, l[0].Edited.IsZero())
+	require.Equal(t, c2, l[1].ID)
+
+	// Comments neither change the version nor the history of the todo.
+	todo, err := s.Get(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), todo.Version)
+	h, err := s.History(ctx, domain.HistoryFilter{TodoID: id})
+	require.NoError(t, err)
+	require.Len(t, h, 1)
+
+	// The discussion is searchable.
+	c := collectAll(t, s, domain.SearchFilters{TextMatch: "lighthouse"})
+	require.Len(t, c, 1)
+	require.Equal(t, id, c[0].ID)
+
+	require.NoError(t, s.EditComment(ctx, id, c1, "How about the harbor?"))
+	require.ErrorIs(t, s.EditComment(ctx, other, c1, "Wrong todo"), domain.ErrNotExists)
+	require.Equal(t,
+		domain.ErrorValidation{CommentEmpty: true}, s.EditComment(ctx, id, c1, ""))
+	l, err = s.Comments(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, "How about the harbor?", l[0].Text)
+	require.False(t, l[0].Edited.IsZero())
+	require.Empty(t, collectAll(t, s, domain.SearchFilters{TextMatch: "lighthouse"}))
+	require.Len(t, collectAll(t, s, domain.SearchFilters{TextMatch: "harbor"}), 1)
+
+	require.NoError(t, s.DeleteComment(ctx, id, c2))
+	require.ErrorIs(t, s.DeleteComment(ctx, id, c2), domain.ErrNotExists)
+	l, err = s.Comments(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, l, 1)
+	l, err = s.Comments(ctx, other)
+	require.NoError(t, err)
+	require.Empty(t, l)
+
+	// Editing the todo keeps its comments searchable.
+	require.NoError(t, s.Edit(ctx, id, 0, func(t *domain.Todo) error {
+		t.Title = "Plan the retreat"
+		return nil
+	}))
+	require.Len(t, collectAll(t, s, domain.SearchFilters{TextMatch: "harbor"}), 1)
+
+	// Comments on todos in the trash can't be changed
+	// and are deleted along with their todo.
+	require.NoError(t, s.Delete(ctx, id))
+	_, err = s.AddComment(ctx, domain.Comment{TodoID: id, Author: bob, Text: "?"})
+	require.ErrorIs(t, err, domain.ErrNotExists)
+	require.ErrorIs(t, s.EditComment(ctx, id, c1, "?"), domain.ErrNotExists)
+	_, err = s.Purge(ctx, 0, time.Now())
+	require.NoError(t, err)
+	_, err = s.Comments(ctx, id)
+	require.ErrorIs(t, err, domain.ErrNotExists)
+}
+
+func TestCommentsReopen(t *testing.T) {
+	for _, b := range backends {
+		if !b.persistent {
+			continue
+		}
+		t.Run(b.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := b.open(t, dir)
+			id, err := s.Add(t.Context(), domain.Todo{Title: "Plan the offsite"})
+			require.NoError(t, err)
+			c1, err := s.AddComment(t.Context(), domain.Comment{
+				TodoID: id, Author: 1, Text: "How about the lighthouse?",
+			})
+			require.NoError(t, err)
+			c2, err := s.AddComment(t.Context(), domain.Comment{
+				TodoID: id, Author: 2, Text: "Too far",
+			})
+			require.NoError(t, err)
+			require.NoError(t, s.EditComment(t.Context(), id, c1, "How about the harbor?"))
+			require.NoError(t, s.DeleteComment(t.Context(), id, c2))
+			if j, ok := s.(*domain.MemStore); ok {
+				// Half of the comments are in the snapshot.
+				require.NoError(t, j.Compact())
+			}
+			c3, err := s.AddComment(t.Context(), domain.Comment{
+				TodoID: id, Author: 2, Text: "Fine by me",
+			})
+			require.NoError(t, err)
+			require.NoError(t, s.Close())
+
+			s = b.open(t, dir)
+			defer func() { require.NoError(t, s.Close()) }()
+			l, err := s.Comments(t.Context(), id)
+			require.NoError(t, err)
+			require.Len(t, l, 2)
+			require.Equal(t, c1, l[0].ID)
+			require.Equal(t, "How about the harbor?", l[0].Text)
+			require.Equal(t, c3, l[1].ID)
+			require.Len(t, collectAll(t, s, domain.SearchFilters{TextMatch: "harbor"}), 1)
+
+			// New IDs must not collide with persisted ones.
+			c4, err := s.AddComment(t.Context(), domain.Comment{
+				TodoID: id, Author: 1, Text: "Booked",
+			})
+			require.NoError(t, err)
+			require.Greater(t, c4, c3)
+		})
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	forEachBackend(t, testAttachments)
+}
+
+func testAttachments(t *testing.T, s domain.Store) {
+	ctx := t.Context()
+	screenshot := domain.Attachment{
+		Hash:        strings.Repeat("ab", 32),
+		Name:        "screenshot.png",
+		ContentType: "image/png",
+		Size:        1024,
+	}
+	log := domain.Attachment{
+		Hash:        strings.Repeat("cd", 32),
+		Name:        "server.log",
+		ContentType: "text/plain",
+		Size:        42,
+	}
+	id, err := s.Add(ctx, domain.Todo{
+		Title: "Fix the crash", Attachments: []domain.Attachment{screenshot},
+	})
+	require.NoError(t, err)
+
+	attach := func(a ...domain.Attachment) error {
+		t.Helper()
+		return s.Edit(ctx, id, 0, func(t *domain.Todo) error {
+			t.Attachments = append(t.Attachments, a...)
+			return nil
+		})
+	}
+	require.NoError(t, attach(log))
+	todo, err := s.Get(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, []domain.Attachment{screenshot, log}, todo.Attachments)
+	a, ok := todo.Attachment(log.Hash)
+	require.True(t, ok)
+	require.Equal(t, log, a)
+	require.False(t, a.IsImage())
+	_, ok = todo.Attachment(strings.Repeat("ef", 32))
+	require.False(t, ok)
+
+	entries, err := s.History(ctx, domain.HistoryFilter{TodoID: id})
+	require.NoError(t, err)
+	require.Equal(t, []domain.FieldChange{{
+		Field: "Attachments", Old: "screenshot.png", New: "screenshot.png, server.log",
+	}}, entries[len(entries)-1].Changes)
+
+	svg := log
+	svg.Hash, svg.ContentType = strings.Repeat("ef", 32), "image/svg+xml"
+	require.Equal(t, domain.ErrorValidation{AttachmentTypeInvalid: true}, attach(svg))
+	huge := log
+	huge.Hash, huge.Size = strings.Repeat("ef", 32), domain.AttachmentMaxSize+1
+	require.Equal(t, domain.ErrorValidation{AttachmentTooLarge: true}, attach(huge))
+	require.Equal(t, domain.ErrorValidation{AttachmentInvalid: true}, attach(log))
+	badHash := log
+	badHash.Hash = "../../etc/passwd"
+	require.Equal(t, domain.ErrorValidation{AttachmentInvalid: true}, attach(badHash))
+	badName := log
+	badName.Hash, badName.Name = strings.Repeat("ef", 32), "logs/server.log"
+	require.Equal(t, domain.ErrorValidation{AttachmentInvalid: true}, attach(badName))
+	many := make([]domain.Attachment, domain.AttachmentsMaxCount+1)
+	for i := range many {
+		many[i] = log
+		many[i].Hash = fmt.Sprintf("%064x", i)
+	}
+	require.Equal(t, domain.ErrorValidation{AttachmentsTooMany: true},
+		domain.ValidateAttachments(many))
+}
+
+func TestAttachmentName(t *testing.T) {
+	for input, expect := range map[string]string{
+		"screenshot.png":         "screenshot.png",
+		`C:\Users\me\crash.log`:  "crash.log",
+		"../../etc/passwd":       "passwd",
+		" \tbad\x00name.txt ":    "badname.txt",
+		"":                       "file",
+		"..":                     "file",
+		strings.Repeat("ü", 200): strings.Repeat("ü", domain.AttachmentNameMaxLength/2),
+	} {
+		require.Equal(t, expect, domain.AttachmentName(input), "%q", input)
+	}
+}
+
+func TestBlobs(t *testing.T) {
+	for _, b := range []struct {
+		name string
+		open func(t *testing.T) domain.BlobStore
+	}{
+		{
+			name: "mem",
+			open: func(t *testing.T) domain.BlobStore { return domain.NewBlobs() },
+		},
+		{
+			name: "disk",
+			open: func(t *testing.T) domain.BlobStore {
+				b, err := domain.OpenBlobs(filepath.Join(t.TempDir(), "attachments"))
+				require.NoError(t, err)
+				return b
+			},
+		},
+	} {
+		t.Run(b.name, func(t *testing.T) { testBlobs(t, b.open(t)) })
+	}
+}
+
+func testBlobs(t *testing.T, b domain.BlobStore) {
+	ctx := t.Context()
+	s := domain.New()
+	t.Cleanup(func() { require.NoError(t, s.Close()) })
+
+	read := func(hash string) string {
+		t.Helper()
+		f, err := b.Open(ctx, hash)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, f.Close()) }()
+		data, err := io.ReadAll(f)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	logHash, size, err := b.Put(ctx, strings.NewReader("panic: oh no"))
+	require.NoError(t, err)
+	require.Equal(t, int64(len("panic: oh no")), size)
+	// The SHA-256 hash of the contents.
+	require.Equal(t,
+		"d208e8b838c34d7da14879c86b014b1fb6cc80d802b454bda391397bfba2d26c", logHash)
+	require.Equal(t, "panic: oh no", read(logHash))
+
+	again, _, err := b.Put(ctx, strings.NewReader("panic: oh no"))
+	require.NoError(t, err)
+	require.Equal(t, logHash, again)
+
+	otherHash, _, err := b.Put(ctx, strings.NewReader("all good"))
+	require.NoError(t, err)
+	require.NotEqual(t, logHash, otherHash)
+
+	_, _, err = b.Put(ctx, io.LimitReader(zeros{}, domain.AttachmentMaxSize+1))
+	require.Equal(t, domain.ErrorValidation{AttachmentTooLarge: true}, err)
+	_, err = b.Open(ctx, strings.Repeat("0", 64))
+	require.ErrorIs(t, err, domain.ErrNotExists)
+	_, err = b.Open(ctx, "../attachments")
+	require.ErrorIs(t, err, domain.ErrNotExists)
+
+	id, err := s.Add(ctx, domain.Todo{
+		Title: "Fix the crash",
+		Attachments: []domain.Attachment{{
+			Hash: logHash, Name: "crash.log", ContentType: "text/plain", Size: size,
+		}},
+	})
+	require.NoError(t, err)
+
+	// Recently stored blobs are kept, they may be about to be attached.
+	n, err := b.GC(ctx, s, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Zero(t, n)
+	n, err = b.GC(ctx, s, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	_, err = b.Open(ctx, otherHash)
+	require.ErrorIs(t, err, domain.ErrNotExists)
+	require.Equal(t, "panic: oh no", read(logHash))
+
+	// Blobs of todos in the trash are kept until the todo is purged.
+	require.NoError(t, s.Delete(ctx, id))
+	n, err = b.GC(ctx, s, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Zero(t, n)
+	_, err = s.Purge(ctx, 0, time.Now())
+	require.NoError(t, err)
+	n, err = b.GC(ctx, s, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	_, err = b.Open(ctx, logHash)
+	require.ErrorIs(t, err, domain.ErrNotExists)
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestValidate(t *testing.T) {
+	forEachBackend(t, testValidate)
+}
+
+func testValidate(t *testing.T, s domain.Store) {
+	{ // Title
+		id, err := s.Add(t.Context(), domain.Todo{
+			Created: time.Now(),
+			Due:     time.Now().Add(time.Minute),
+		})
+		var v domain.ErrorValidation
+		require.ErrorAs(t, err, &v)
+		require.Zero(t, id)
+		require.Equal(t, domain.ErrorValidation{
+			TitleEmpty: true,
+		}, v)
+		c := collectAll(t, s, domain.SearchFilters{})
+		require.Len(t, c, 0)
+	}
+
+	{ // Title and description too long
+		title := strings.Repeat("x", domain.TitleMaxLength+1)
+		desc := strings.Repeat("x", domain.DescriptionMaxLength+1)
+		id, err := s.Add(t.Context(), domain.Todo{
+			Title:       title,
+			Description: desc,
+			Created:     time.Now(),
+			Due:         time.Now().Add(time.Minute),
+		})
+		var v domain.ErrorValidation
+		require.ErrorAs(t, err, &v)
+		require.Zero(t, id)
+		require.Equal(t, domain.ErrorValidation{
+			TitleTooLong:       true,
+			DescriptionTooLong: true,
+		}, v)
+		c := collectAll(t, s, domain.SearchFilters{})
+		require.Len(t, c, 0)
+	}
+
+	{ // Tags
+		tooMany := make([]string, domain.TagsMaxCount+1)
+		for i := range tooMany {
+			tooMany[i] = fmt.Sprintf("tag%d", i)
+		}
+		for _, tags := range [][]string{
+			tooMany,
+			{""},
+			{"two words"},
+			{"Upper"},
+			{strings.Repeat("x", domain.TagMaxLength+1)},
+		} {
+			id, err := s.Add(t.Context(), domain.Todo{Title: "Tagged", Tags: tags})
+			var v domain.ErrorValidation
+			require.ErrorAs(t, err, &v, "tags: %q", tags)
+			require.Zero(t, id)
+			require.Equal(t, domain.ValidateTags(tags), v)
+		}
+		c := collectAll(t, s, domain.SearchFilters{})
+		require.Len(t, c, 0)
+
+		id, err := s.Add(t.Context(), domain.Todo{Title: "Tagged", Tags: []string{"ok"}})
+		require.NoError(t, err)
+		err = s.Edit(t.Context(), id, 0, func(t *domain.Todo) error {
+			t.Tags = append(t.Tags, "Not OK")
+			return nil
+		})
+		require.ErrorAs(t, err, new(domain.ErrorValidation))
+		todo, err := s.Get(t.Context(), id)
+		require.NoError(t, err)
+		require.Equal(t, []string{"ok"}, todo.Tags)
+	}
+
+	{ // Priority
+		id, err := s.Add(t.Context(), domain.Todo{Title: "Urgent", Priority: 42})
+		var v domain.ErrorValidation
+		require.ErrorAs(t, err, &v)
+		require.Zero(t, id)
+		require.Equal(t, domain.ErrorValidation{PriorityInvalid: true}, v)
+	}
+
+	{ // Checklist
+		tooMany := make([]domain.ChecklistItem, domain.ChecklistMaxItems+1)
+		for i := range tooMany {
+			tooMany[i].Title = fmt.Sprintf("item %d", i)
+		}
+		for _, items := range [][]domain.ChecklistItem{
+			tooMany,
+			{{Title: ""}},
+			{{Title: strings.Repeat("x", domain.ChecklistItemMaxLength+1)}},
+		} {
+			id, err := s.Add(t.Context(), domain.Todo{Title: "Checklist", Checklist: items})
+			var v domain.ErrorValidation
+			require.ErrorAs(t, err, &v)
+			require.Zero(t, id)
+			require.Equal(t, domain.ValidateChecklist(items), v)
+		}
+	}
+
+	{ // Recurrence
+		id, err := s.Add(t.Context(), domain.Todo{Title: "Often", Recurrence: "FREQ=HOURLY"})
+		var v domain.ErrorValidation
+		require.ErrorAs(t, err, &v)
+		require.Zero(t, id)
+		require.Equal(t, domain.ErrorValidation{RecurrenceInvalid: true}, v)
+	}
+
+	{ // Blockers
+		tooMany := make([]int64, domain.BlockersMaxCount+1)
+		for i := range tooMany {
+			tooMany[i] = int64(i + 1)
+		}
+		for _, ids := range [][]int64{tooMany, {0}, {-1}, {1, 1}, {42}} {
+			id, err := s.Add(t.Context(), domain.Todo{Title: "Blocked", BlockedBy: ids})
+			var v domain.ErrorValidation
+			require.ErrorAs(t, err, &v, "ids: %v", ids)
+			require.Zero(t, id)
+			require.Equal(t, domain.ErrorValidation{BlockedByInvalid: true}, v)
+		}
+	}
+}
+
+func TestParseChecklist(t *testing.T) {
+	for input, expect := range map[string][]domain.ChecklistItem{
+		"":       nil,
+		" \n\n ": nil,
+		"- onions\n- [x] sausages\n\n* [ ] bananas\n[X]  a new broom ": {
+			{Title: "onions"},
+			{Title: "sausages", Done: true},
+			{Title: "bananas"},
+			{Title: "a new broom", Done: true},
+		},
+	} {
+		require.Equal(t, expect, domain.ParseChecklist(input), "input: %q", input)
+	}
+
+	items := []domain.ChecklistItem{{Title: "onions"}, {Title: "sausages", Done: true}}
+	require.Equal(t, "onions\n[x] sausages", domain.FormatChecklist(items))
+	require.Equal(t, items, domain.ParseChecklist(domain.FormatChecklist(items)))
+}
+
+func TestChecklist(t *testing.T) {
+	forEachBackend(t, testChecklist)
+}
+
+func testChecklist(t *testing.T, s domain.Store) {
+	id, err := s.Add(t.Context(), domain.Todo{
+		Title: "Go shopping",
+		Checklist: []domain.ChecklistItem{
+			{Title: "onions"}, {Title: "sausages"}, {Title: "bananas"}, {Title: "broom"},
+		},
+	})
+	require.NoError(t, err)
+
+	err = s.Edit(t.Context(), id, 0, func(t *domain.Todo) error {
+		t.Checklist[1].Done = true
+		return nil
+	})
+	require.NoError(t, err)
+	todo, err := s.Get(t.Context(), id)
+	require.NoError(t, err)
+	require.Equal(t, []domain.ChecklistItem{
+		{Title: "onions"},
+		{Title: "sausages", Done: true},
+		{Title: "bananas"},
+		{Title: "broom"},
+	}, todo.Checklist)
+	require.Equal(t, 0.25, todo.Progress())
+
+	h, err := s.History(t.Context(), domain.HistoryFilter{TodoID: id})
+	require.NoError(t, err)
+	require.Equal(t, []domain.FieldChange{{
+		Field: "Checklist",
+		Old:   "onions\nsausages\nbananas\nbroom",
+		New:   "onions\n[x] sausages\nbananas\nbroom",
+	}}, h[len(h)-1].Changes)
+
+	err = s.Edit(t.Context(), id, 0, func(t *domain.Todo) error {
+		t.Status = domain.StatusDone
+		return nil
+	})
+	require.NoError(t, err)
+	todo, err = s.Get(t.Context(), id)
+	require.NoError(t, err)
+	require.Equal(t, 1.0, todo.Progress())
+}
+
+func TestParseRecurrence(t *testing.T) {
+	for input, expect := range map[string]string{
+		"":                                  "",
+		"FREQ=DAILY":                        "FREQ=DAILY",
+		"RRULE:freq=daily;interval=1":       "FREQ=DAILY",
+		"FREQ=WEEKLY;BYDAY=FR,MO,MO":        "FREQ=WEEKLY;BYDAY=MO,FR",
+		"FREQ=WEEKLY;INTERVAL=2;COUNT=3":    "FREQ=WEEKLY;INTERVAL=2;COUNT=3",
+		"FREQ=MONTHLY;BYMONTHDAY=-1":        "FREQ=MONTHLY;BYMONTHDAY=-1",
+		"FREQ=DAILY;UNTIL=20261231":         "FREQ=DAILY;UNTIL=20261231",
+		"FREQ=DAILY;UNTIL=20261231T120000Z": "FREQ=DAILY;UNTIL=20261231T120000Z",
+	} {
+		r, err := domain.ParseRecurrence(input)
+		require.NoError(t, err, "input: %q", input)
+		require.Equal(t, expect, r.String(), "input: %q", input)
+	}
+
+	for _, input := range []string{
+		"INTERVAL=2",
+		"FREQ=YEARLY",
+		"FREQ=DAILY;FREQ=WEEKLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;INTERVAL=1001",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=DAILY;COUNT=0",
+		"FREQ=DAILY;UNTIL=tomorrow",
+		"FREQ=DAILY;COUNT=2;UNTIL=20261231",
+		"FREQ=DAILY;BYHOUR=8",
+		"FREQ",
+	} {
+		_, err := domain.ParseRecurrence(input)
+		require.Error(t, err, "input: %q", input)
+	}
+}
+
+func TestRecurrenceNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	at := func(date string) time.Time {
+		d, err := time.ParseInLocation("2006-01-02 15:04", date, berlin)
+		require.NoError(t, err)
+		return d
+	}
+
+	for _, tt := range []struct {
+		rule   string
+		due    string
+		expect []string
+		rest   string
+	}{
+		{ // Keeps the wall clock time across daylight saving time changes.
+			rule:   "FREQ=DAILY",
+			due:    "2026-03-28 08:00",
+			expect: []string{"2026-03-29 08:00", "2026-03-30 08:00"},
+			rest:   "FREQ=DAILY",
+		},
+		{
+			rule:   "FREQ=DAILY;INTERVAL=3;COUNT=3",
+			due:    "2026-01-30 08:00",
+			expect: []string{"2026-02-02 08:00", "2026-02-05 08:00"},
+			rest:   "FREQ=DAILY;INTERVAL=3;COUNT=1",
+		},
+		{
+			rule:   "FREQ=WEEKLY",
+			due:    "2026-10-16 18:00", // Friday.
+			expect: []string{"2026-10-23 18:00", "2026-10-30 18:00"},
+			rest:   "FREQ=WEEKLY",
+		},
+		{
+			rule: "FREQ=WEEKLY;BYDAY=MO,WE,FR",
+			due:  "2026-10-14 09:00", // Wednesday.
+			expect: []string{
+				"2026-10-16 09:00", "2026-10-19 09:00", "2026-10-21 09:00",
+			},
+			rest: "FREQ=WEEKLY;BYDAY=MO,WE,FR",
+		},
+		{
+			rule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,SU",
+			due:  "2026-10-12 09:00", // Monday.
+			expect: []string{
+				"2026-10-18 09:00", "2026-10-26 09:00", "2026-11-01 09:00",
+			},
+			rest: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,SU",
+		},
+		{
+			rule: "FREQ=WEEKLY;INTERVAL=1000;BYDAY=MO,SU",
+			due:  "2026-10-12 09:00", // Monday.
+			expect: []string{
+				"2026-10-18 09:00", "2045-12-11 09:00", "2045-12-17 09:00",
+			},
+			rest: "FREQ=WEEKLY;INTERVAL=1000;BYDAY=MO,SU",
+		},
+		{ // Skips months without the day.
+			rule:   "FREQ=MONTHLY;BYMONTHDAY=31",
+			due:    "2026-01-31 12:00",
+			expect: []string{"2026-03-31 12:00", "2026-05-31 12:00"},
+			rest:   "FREQ=MONTHLY;BYMONTHDAY=31",
+		},
+		{
+			rule:   "FREQ=MONTHLY;BYMONTHDAY=-1",
+			due:    "2026-01-31 12:00",
+			expect: []string{"2026-02-28 12:00", "2026-03-31 12:00"},
+			rest:   "FREQ=MONTHLY;BYMONTHDAY=-1",
+		},
+		{ // Repeats on the day of the due date.
+			rule:   "FREQ=MONTHLY;INTERVAL=2",
+			due:    "2026-11-15 12:00",
+			expect: []string{"2027-01-15 12:00", "2027-03-15 12:00"},
+			rest:   "FREQ=MONTHLY;INTERVAL=2",
+		},
+		{ // Day before the due date repeats in the next month.
+			rule:   "FREQ=MONTHLY;BYMONTHDAY=1",
+			due:    "2026-11-15 12:00",
+			expect: []string{"2026-12-01 12:00", "2027-01-01 12:00"},
+			rest:   "FREQ=MONTHLY;BYMONTHDAY=1",
+		},
+		{ // Leap days only exist every four years.
+			rule:   "FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=29;COUNT=3",
+			due:    "2024-02-29 12:00",
+			expect: []string{"2028-02-29 12:00", "2032-02-29 12:00"},
+			rest:   "FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=29;COUNT=1",
+		},
+		{
+			rule:   "FREQ=DAILY;UNTIL=20261018",
+			due:    "2026-10-16 23:30",
+			expect: []string{"2026-10-17 23:30", "2026-10-18 23:30"},
+			rest:   "FREQ=DAILY;UNTIL=20261018",
+		},
+		{
+			rule:   "FREQ=DAILY;UNTIL=20261018T120000Z",
+			due:    "2026-10-16 08:00",
+			expect: []string{"2026-10-17 08:00", "2026-10-18 08:00"},
+			rest:   "FREQ=DAILY;UNTIL=20261018T120000Z",
+		},
+	} {
+		r, err := domain.ParseRecurrence(tt.rule)
+		require.NoError(t, err)
+		due := at(tt.due)
+		for _, expect := range tt.expect {
+			var ok bool
+			due, r, ok = r.Next(due, berlin)
+			require.True(t, ok, "rule: %q", tt.rule)
+			require.Equal(t, at(expect), due, "rule: %q", tt.rule)
+		}
+		require.Equal(t, tt.rest, r.String(), "rule: %q", tt.rule)
+		_, _, ok := r.Next(due, berlin)
+		require.Equal(t, !strings.Contains(tt.rule, "COUNT") &&
+			!strings.Contains(tt.rule, "UNTIL"), ok, "rule: %q", tt.rule)
+	}
+}
+
+func TestRecurring(t *testing.T) {
+	forEachBackend(t, testRecurring)
+}
+
+func testRecurring(t *testing.T, s domain.Store) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+	ctx := domain.WithLocation(t.Context(), tokyo)
+
+	due := time.Date(2026, 10, 16, 23, 0, 0, 0, tokyo)
+	id, err := s.Add(ctx, domain.Todo{
+		Title:      "Check emails",
+		Due:        due,
+		Tags:       []string{"work"},
+		Priority:   domain.PriorityHigh,
+		Checklist:  []domain.ChecklistItem{{Title: "inbox"}, {Title: "spam"}},
+		Recurrence: "FREQ=WEEKLY;BYDAY=FR,SA;COUNT=2",
+	})
+	require.NoError(t, err)
+	plain, err := s.Add(ctx, domain.Todo{Title: "Once"})
+	require.NoError(t, err)
+
+	// done returns the ID of the added next occurrence, if any.
+	done := func(id int64) (next int64) {
+		t.Helper()
+		err := s.Edit(domain.WithNextOccurrence(ctx, &next), id, 0, func(t *domain.Todo) error {
+			if len(t.Checklist) > 0 {
+				t.Checklist[0].Done = true
+			}
+			t.Status = domain.StatusDone
+			return nil
+		})
+		require.NoError(t, err)
+		return next
+	}
+
+	require.Zero(t, done(plain))
+	require.Len(t, collectAll(t, s, domain.SearchFilters{}), 2)
+
+	nextID := done(id)
+	c := collectAll(t, s, domain.SearchFilters{Sort: domain.SortCreated})
+	require.Len(t, c, 3)
+	next := c[2]
+	require.Equal(t, next.ID, nextID)
+	require.Equal(t, domain.StatusOpen, next.Status)
+	require.Equal(t, "Check emails", next.Title)
+	require.True(t, due.AddDate(0, 0, 1).Equal(next.Due), next.Due)
+	require.Equal(t, []string{"work"}, next.Tags)
+	require.Equal(t, domain.PriorityHigh, next.Priority)
+	require.Equal(t, []domain.ChecklistItem{{Title: "inbox"}, {Title: "spam"}}, next.Checklist)
+	require.Equal(t, "FREQ=WEEKLY;BYDAY=FR,SA;COUNT=1", next.Recurrence)
+
+	h, err := s.History(ctx, domain.HistoryFilter{TodoID: next.ID})
+	require.NoError(t, err)
+	require.Len(t, h, 1)
+	require.Equal(t, domain.MutationAdd, h[0].Mutation)
+
+	// Reopening and completing again doesn't spawn another occurrence.
+	err = s.Edit(ctx, id, 0, func(t *domain.Todo) error {
+		t.Status = domain.StatusOpen
+		return nil
+	})
+	require.NoError(t, err)
+	err = s.Edit(ctx, id, 0, func(t *domain.Todo) error {
+		t.Title = "Check all emails"
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, collectAll(t, s, domain.SearchFilters{}), 3)
+
+	// Skipping moves the todo to the next occurrence.
+	err = s.Edit(ctx, id, 0, func(t *domain.Todo) error { return t.Skip(tokyo) })
+	require.NoError(t, err)
+	todo, err := s.Get(ctx, id)
+	require.NoError(t, err)
+	require.True(t, due.AddDate(0, 0, 1).Equal(todo.Due), todo.Due)
+	require.Equal(t, "FREQ=WEEKLY;BYDAY=FR,SA;COUNT=1", todo.Recurrence)
+	require.Equal(t, []domain.ChecklistItem{{Title: "inbox"}, {Title: "spam"}}, todo.Checklist)
+
+	// The last occurrence ends the series.
+	err = s.Edit(ctx, next.ID, 0, func(t *domain.Todo) error { return t.Skip(tokyo) })
+	require.ErrorIs(t, err, domain.ErrSeriesEnded)
+	done(next.ID)
+	require.Len(t, collectAll(t, s, domain.SearchFilters{}), 3)
+
+	err = s.Edit(ctx, plain, 0, func(t *domain.Todo) error { return t.Skip(tokyo) })
+	require.ErrorIs(t, err, domain.ErrSeriesEnded)
+
+	// No February has a 31st, so the series has no next occurrence.
+	never, err := s.Add(ctx, domain.Todo{
+		Title:      "Never again",
+		Due:        time.Date(2026, 2, 10, 12, 0, 0, 0, tokyo),
+		Recurrence: "FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=31",
+	})
+	require.NoError(t, err)
+	err = s.Edit(ctx, never, 0, func(t *domain.Todo) error { return t.Skip(tokyo) })
+	require.ErrorIs(t, err, domain.ErrSeriesEnded)
+	done(never)
+	require.Len(t, collectAll(t, s, domain.SearchFilters{}), 4)
+
+	// Large intervals are computed without stepping through every day.
+	rare, err := s.Add(ctx, domain.Todo{
+		Title:      "Rarely",
+		Due:        time.Date(2026, 10, 16, 12, 0, 0, 0, tokyo), // Friday.
+		Recurrence: fmt.Sprintf("FREQ=WEEKLY;INTERVAL=%d;BYDAY=MO", domain.MaxRecurrenceInterval),
+	})
+	require.NoError(t, err)
+	done(rare)
+	c = collectAll(t, s, domain.SearchFilters{Sort: domain.SortCreated})
+	require.Len(t, c, 6)
+	require.True(t, time.Date(2045, 12, 11, 12, 0, 0, 0, tokyo).Equal(c[5].Due), c[5].Due)
+
+	err = s.Edit(ctx, rare, 0, func(t *domain.Todo) error {
+		t.Recurrence = fmt.Sprintf("FREQ=WEEKLY;INTERVAL=%d", domain.MaxRecurrenceInterval+1)
+		return nil
+	})
+	require.Equal(t, domain.ErrorValidation{RecurrenceInvalid: true}, err)
+}
+
+func TestParseTodoIDs(t *testing.T) {
+	for input, expect := range map[string][]int64{
+		"":              nil,
+		" , ":           nil,
+		"3":             {3},
+		"#3, 1,#3 , 42": {3, 1, 42},
+	} {
+		ids, err := domain.ParseTodoIDs(input)
+		require.NoError(t, err, "input: %q", input)
+		require.Equal(t, expect, ids, "input: %q", input)
+	}
+	for _, input := range []string{"x", "0", "-1", "3;4"} {
+		_, err := domain.ParseTodoIDs(input)
+		require.Error(t, err, "input: %q", input)
+	}
+	require.Equal(t, "#3, #1", domain.FormatTodoIDs([]int64{3, 1}))
+}
+
+func TestBlocking(t *testing.T) {
+	forEachBackend(t, testBlocking)
+}
+
+func testBlocking(t *testing.T, s domain.Store) {
+	ctx := t.Context()
+	add := func(title string, blockedBy ...int64) int64 {
+		t.Helper()
+		id, err := s.Add(ctx, domain.Todo{Title: title, BlockedBy: blockedBy})
+		require.NoError(t, err)
+		return id
+	}
+	block := func(id int64, blockedBy ...int64) error {
+		return s.Edit(ctx, id, 0, func(t *domain.Todo) error {
+			t.BlockedBy = blockedBy
+			return nil
+		})
+	}
+	titles := func(filters domain.SearchFilters) (titles []string) {
+		t.Helper()
+		for _, todo := range collectAll(t, s, filters) {
+			titles = append(titles, todo.Title)
+		}
+		return titles
+	}
+
+	design := add("Design")
+	build := add("Build", design)
+	test := add("Test", build)
+	ship := add("Ship", build, test)
+
+	require.ErrorIs(t, block(design, design), domain.ErrDependencyCycle)
+	require.ErrorIs(t, block(design, ship), domain.ErrDependencyCycle)
+	require.ErrorIs(t, block(build, design, test), domain.ErrDependencyCycle)
+	require.ErrorAs(t, block(design, 42), new(domain.ErrorValidation))
+	todo, err := s.Get(ctx, design)
+	require.NoError(t, err)
+	require.Empty(t, todo.BlockedBy)
+
+	require.Equal(t, []string{"Design", "Build", "Test", "Ship"},
+		titles(domain.SearchFilters{}))
+	require.Equal(t, []string{"Design"},
+		titles(domain.SearchFilters{HideBlocked: true}))
+
+	all := collectAll(t, s, domain.SearchFilters{})
+	blockers, err := domain.OpenBlockers(ctx, s, all)
+	require.NoError(t, err)
+	require.Equal(t, map[int64][]int64{
+		build: {design}, test: {build}, ship: {build, test},
+	}, blockers)
+
+	// Done blockers don't block.
+	err = s.Edit(ctx, design, 0, func(t *domain.Todo) error {
+		t.Status = domain.StatusDone
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Design", "Build"},
+		titles(domain.SearchFilters{HideBlocked: true}))
+	require.Equal(t, []string{"Build"},
+		titles(domain.SearchFilters{HideBlocked: true, TextMatch: "build"}))
+
+	// Archiving removes the links from and to the archived todo.
+	err = s.Edit(ctx, build, 0, func(t *domain.Todo) error {
+		t.Archived = true
+		return nil
+	})
+	require.NoError(t, err)
+	todo, err = s.Get(ctx, build)
+	require.NoError(t, err)
+	require.Empty(t, todo.BlockedBy)
+	todo, err = s.Get(ctx, ship)
+	require.NoError(t, err)
+	require.Equal(t, []int64{test}, todo.BlockedBy)
+	h, err := s.History(ctx, domain.HistoryFilter{TodoID: ship})
+	require.NoError(t, err)
+	require.Equal(t, []domain.FieldChange{{
+		Field: "Blocked by", Old: "#2, #3", New: "#3",
+	}}, h[len(h)-1].Changes)
+	require.Equal(t, []string{"Design", "Test"},
+		titles(domain.SearchFilters{HideBlocked: true}))
+
+	// Archived todos can't block.
+	require.ErrorAs(t, block(test, build), new(domain.ErrorValidation))
+
+	// Deleting removes the links too.
+	require.NoError(t, s.Delete(ctx, test))
+	todo, err = s.Get(ctx, ship)
+	require.NoError(t, err)
+	require.Empty(t, todo.BlockedBy)
+
+	require.NoError(t, s.Archive(ctx, design))
+	todo, err = s.Get(ctx, design)
+	require.NoError(t, err)
+	require.True(t, todo.Archived)
+}
+
+func TestParsePriority(t *testing.T) {
+	for _, p := range domain.Priorities {
+		actual, err := domain.ParsePriority(p.String())
+		require.NoError(t, err)
+		require.Equal(t, p, actual)
+	}
+	p, err := domain.ParsePriority("")
+	require.NoError(t, err)
+	require.Equal(t, domain.PriorityNone, p)
+	_, err = domain.ParsePriority("critical")
+	require.Error(t, err)
+}
+
+func TestParseTags(t *testing.T) {
+	for input, expect := range map[string][]string{
+		"":                          nil,
+		" , ,":                      nil,
+		"frontend":                  {"frontend"},
+		" Frontend, ops ,,frontend": {"frontend", "ops"},
+		"c++, ci/cd, v1.2":          {"c++", "ci/cd", "v1.2"},
+	} {
+		require.Equal(t, expect, domain.ParseTags(input), "input: %q", input)
+	}
+}
+
+func TestTags(t *testing.T) {
+	forEachBackend(t, testTags)
+}
+
+func testTags(t *testing.T, s domain.Store) {
+	add := func(title string, tags ...string) int64 {
+		t.Helper()
+		id, err := s.Add(t.Context(), domain.Todo{Title: title, Tags: tags})
+		require.NoError(t, err)
+		return id
+	}
+	fix := add("Fix login button", "frontend", "bug")
+	deploy := add("Deploy to staging", "ops")
+	invoice := add("Send invoices", "billing")
+	add("Fix invoice rounding", "billing", "bug")
+	archived := add("Old frontend bug", "frontend", "bug")
+	require.NoError(t, s.Archive(t.Context(), archived))
+
+	ids := func(f domain.SearchFilters) (ids []int64) {
+		t.Helper()
+		for _, todo := range collectAll(t, s, f) {
+			ids = append(ids, todo.ID)
+		}
+		return ids
+	}
+	for _, text := range []string{"", "fix"} {
+		require.Equal(t, []int64{fix}, ids(domain.SearchFilters{
+			TextMatch: text, Tags: []string{"frontend", "bug"},
+		}))
+		if text == "" {
+			require.Equal(t, []int64{deploy, invoice}, ids(domain.SearchFilters{
+				ExcludeTags: []string{"bug", "frontend"},
+			}))
+		}
+	}
+	require.Equal(t, []int64{archived}, ids(domain.SearchFilters{
+		Archived: true, Tags: []string{"frontend"},
+	}))
+
+	counts, err := s.TagCounts(t.Context(), domain.SearchFilters{})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []domain.TagCount{
+		{Tag: "bug", Count: 2},
+		{Tag: "billing", Count: 2},
+		{Tag: "frontend", Count: 1},
+		{Tag: "ops", Count: 1},
+	}, counts)
+	require.Equal(t, 2, counts[0].Count, "most used tags first")
+
+	counts, err = s.TagCounts(t.Context(), domain.SearchFilters{
+		TextMatch: "invoice", ExcludeTags: []string{"bug"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []domain.TagCount{{Tag: "billing", Count: 1}}, counts)
+
+	// Tags are kept up to date on edit and delete.
+	err = s.Edit(t.Context(), deploy, 0, func(t *domain.Todo) error {
+		t.Tags = []string{"billing"}
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.Delete(t.Context(), invoice))
+	counts, err = s.TagCounts(t.Context(), domain.SearchFilters{Tags: []string{"billing"}})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []domain.TagCount{
+		{Tag: "billing", Count: 2},
+		{Tag: "bug", Count: 1},
+	}, counts)
+
+	h, err := s.History(t.Context(), domain.HistoryFilter{TodoID: deploy})
+	require.NoError(t, err)
+	require.Equal(t, []domain.FieldChange{
+		{Field: "Tags", Old: "ops", New: "billing"},
+	}, h[len(h)-1].Changes)
+}
+
+func TestSort(t *testing.T) {
+	forEachBackend(t, testSort)
+}
+
+func testSort(t *testing.T, s domain.Store) {
+	now := time.Now()
+	add := func(title string, p domain.Priority, created, due time.Time) int64 {
+		t.Helper()
+		id, err := s.Add(t.Context(), domain.Todo{
+			Title: title, Priority: p, Created: created, Due: due,
+		})
+		require.NoError(t, err)
+		return id
+	}
+	low := add("Water plants", domain.PriorityLow, now.Add(-3*time.Hour), time.Time{})
+	urgent := add("Fix plant sensor", domain.PriorityUrgent,
+		now.Add(-time.Hour), now.Add(2*time.Hour))
+	none := add("buy plant food", domain.PriorityNone,
+		now.Add(-2*time.Hour), now.Add(time.Hour))
+	urgent2 := add("Replace broken pot", domain.PriorityUrgent,
+		now.Add(-time.Hour), time.Time{})
+	err := s.Edit(t.Context(), none, 0, func(t *domain.Todo) error {
+		t.Status = domain.StatusDone
+		return nil
+	})
+	require.NoError(t, err)
+
+	ids := func(f domain.SearchFilters) (ids []int64) {
+		t.Helper()
+		for _, todo := range collectAll(t, s, f) {
+			ids = append(ids, todo.ID)
+		}
+		return ids
+	}
+	for _, tt := range []struct {
+		key       domain.SortKey
+		asc, desc []int64
+	}{
+		{domain.SortDefault, []int64{low, urgent, none, urgent2}, nil},
+		{
+			domain.SortManual,
+			[]int64{low, urgent, none, urgent2},
+			[]int64{urgent2, none, urgent, low},
+		},
+		{
+			// All todos are equally relevant without text match.
+			domain.SortRelevance,
+			[]int64{low, urgent, none, urgent2},
+			[]int64{low, urgent, none, urgent2},
+		},
+		{
+			domain.SortCreated,
+			[]int64{low, none, urgent, urgent2},
+			[]int64{urgent, urgent2, none, low},
+		},
+		{
+			// Todos without due date come last in both directions.
+			domain.SortDue,
+			[]int64{none, urgent, low, urgent2},
+			[]int64{urgent, none, low, urgent2},
+		},
+		{
+			domain.SortTitle,
+			[]int64{none, urgent, urgent2, low},
+			[]int64{low, urgent2, urgent, none},
+		},
+		{
+			domain.SortStatus,
+			[]int64{low, urgent, urgent2, none},
+			[]int64{none, low, urgent, urgent2},
+		},
+		{
+			domain.SortPriority,
+			[]int64{none, low, urgent, urgent2},
+			[]int64{urgent, urgent2, low, none},
+		},
+	} {
+		without := func(ids []int64, id int64) []int64 {
+			return slices.DeleteFunc(slices.Clone(ids), func(i int64) bool { return i == id })
+		}
+		require.Equal(t, tt.asc, ids(domain.SearchFilters{Sort: tt.key}),
+			"%q asc", tt.key)
+		if tt.key != domain.SortRelevance && tt.key != domain.SortDefault {
+			// Sorting text matches works the same.
+			require.Equal(t, without(tt.asc, urgent2), ids(domain.SearchFilters{
+				Sort: tt.key, TextMatch: "plant",
+			}), "%q asc text", tt.key)
+		}
+		if tt.desc != nil {
+			require.Equal(t, tt.desc, ids(domain.SearchFilters{
+				Sort: tt.key, SortDesc: true,
+			}), "%q desc", tt.key)
+		}
+	}
+
+	// Best matches come first when matching text.
+	byRelevance := ids(domain.SearchFilters{TextMatch: "plant sensor"})
+	require.Equal(t, urgent, byRelevance[0])
+	require.Equal(t, byRelevance, ids(domain.SearchFilters{
+		TextMatch: "plant sensor", Sort: domain.SortRelevance,
+	}))
+	reversed := ids(domain.SearchFilters{
+		TextMatch: "plant sensor", Sort: domain.SortRelevance, SortDesc: true,
+	})
+	require.Equal(t, urgent, reversed[len(reversed)-1])
+
+	err = s.Edit(t.Context(), low, 0, func(t *domain.Todo) error {
+		t.Priority = domain.PriorityHigh
+		return nil
+	})
+	require.NoError(t, err)
+	h, err := s.History(t.Context(), domain.HistoryFilter{TodoID: low})
+	require.NoError(t, err)
+	require.Equal(t, []domain.FieldChange{
+		{Field: "Priority", Old: "low", New: "high"},
+	}, h[len(h)-1].Changes)
+}
+
+func TestMove(t *testing.T) {
+	forEachBackend(t, testMove)
+}
+
+func testMove(t *testing.T, s domain.Store) {
+	var ids []int64
+	for _, title := range []string{"A", "B", "C", "D"} {
+		id, err := s.Add(t.Context(), domain.Todo{Title: title})
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	a, b, c, d := ids[0], ids[1], ids[2], ids[3]
+	order := func() (ids []int64) {
+		t.Helper()
+		for _, todo := range collectAll(t, s, domain.SearchFilters{}) {
+			ids = append(ids, todo.ID)
+		}
+		return ids
+	}
+	require.Equal(t, []int64{a, b, c, d}, order())
+
+	require.NoError(t, s.Move(t.Context(), d, 0))
+	require.Equal(t, []int64{d, a, b, c}, order())
+	require.NoError(t, s.Move(t.Context(), a, c))
+	require.Equal(t, []int64{d, b, c, a}, order())
+	require.NoError(t, s.Move(t.Context(), c, d))
+	require.Equal(t, []int64{d, c, b, a}, order())
+	require.NoError(t, s.Move(t.Context(), b, b))
+	require.Equal(t, []int64{d, c, b, a}, order())
+
+	// Moving only changes the rank of the moved todo.
+	before, err := s.Get(t.Context(), a)
+	require.NoError(t, err)
+	require.NoError(t, s.Move(t.Context(), b, d))
+	after, err := s.Get(t.Context(), a)
+	require.NoError(t, err)
+	require.Equal(t, before.Version, after.Version)
+	moved, err := s.Get(t.Context(), b)
+	require.NoError(t, err)
+	h, err := s.History(t.Context(), domain.HistoryFilter{TodoID: b})
+	require.NoError(t, err)
+	require.Equal(t, domain.MutationMove, h[len(h)-1].Mutation)
+	require.Equal(t, moved.Version, h[len(h)-1].Version)
+
+	// Repeatedly moving between the same todos never runs out of ranks.
+	for range 25 {
+		require.NoError(t, s.Move(t.Context(), a, d))
+		require.NoError(t, s.Move(t.Context(), b, d))
+	}
+	require.Equal(t, []int64{d, b, a, c}, order())
+
+	// New todos are ranked last.
+	e, err := s.Add(t.Context(), domain.Todo{Title: "E"})
+	require.NoError(t, err)
+	require.Equal(t, []int64{d, b, a, c, e}, order())
+
+	require.ErrorIs(t, s.Move(t.Context(), a, 42), domain.ErrNotExists)
+	require.ErrorIs(t, s.Move(t.Context(), 42, a), domain.ErrNotExists)
+}
+
+func TestStoreReopen(t *testing.T) {
+	for _, b := range backends {
+		if !b.persistent {
+			continue
+		}
+		t.Run(b.name, func(t *testing.T) {
+			dir := t.TempDir()
+			now := time.Now().UTC()
+
+			s := b.open(t, dir)
+			id1, err := s.Add(t.Context(), domain.Todo{Title: "First", Created: now})
+			require.NoError(t, err)
+			id2, err := s.Add(t.Context(), domain.Todo{
+				Title:       "Second",
+				Description: "to be archived",
+				Created:     now,
+			})
+			require.NoError(t, err)
+			id3, err := s.Add(t.Context(), domain.Todo{
+				Title:       "Third",
+				Description: "to be deleted",
+				Created:     now,
+			})
+			require.NoError(t, err)
+
+			err = s.Edit(t.Context(), id1, 0, func(t *domain.Todo) error {
+				t.Status = domain.StatusDone
+				return nil
+			})
+			require.NoError(t, err)
+			require.NoError(t, s.Archive(t.Context(), id2))
+			require.NoError(t, s.Delete(t.Context(), id3))
+			_, err = s.Purge(t.Context(), 0, time.Now())
+			require.NoError(t, err)
+			require.NoError(t, s.Close())
+
+			s = b.open(t, dir)
+			defer func() { require.NoError(t, s.Close()) }()
+			checkReopened(t, s, now, id1, id2)
+
+			// New IDs must not collide with persisted ones,
+			// not even with the ones of deleted todos.
+			id4, err := s.Add(t.Context(), domain.Todo{Title: "Fourth", Created: now})
+			require.NoError(t, err)
+			require.Greater(t, id4, id3)
+		})
+	}
+}
+
+// checkReopened checks the state left behind by TestStoreReopen.
+func checkReopened(t *testing.T, s domain.Store, now time.Time, done, archived int64) {
+	t.Helper()
+	c := collectAll(t, s, domain.SearchFilters{})
+	require.Len(t, c, 1)
+	require.Equal(t, done, c[0].ID)
+	require.Equal(t, domain.StatusDone, c[0].Status)
+	require.True(t, now.Equal(c[0].Created))
+
+	c = collectAll(t, s, domain.SearchFilters{Archived: true})
+	require.Len(t, c, 1)
+	require.Equal(t, archived, c[0].ID)
+
+	// The search index must be rebuilt too.
+	c = collectAll(t, s, domain.SearchFilters{Archived: true, TextMatch: "archived"})
+	require.Len(t, c, 1)
+	require.Equal(t, archived, c[0].ID)
+
+	// 3 additions, 1 edit, 1 archivation, 1 move to the trash and 1 deletion.
+	h, err := s.History(t.Context(), domain.HistoryFilter{})
+	require.NoError(t, err)
+	require.Len(t, h, 7)
+}
+
+func TestIndexOutOfSync(t *testing.T) {
+	for _, b := range []struct {
+		name string
+		open func(dir string, opts domain.Options) (domain.Store, error)
+	}{
+		{"journal", func(dir string, opts domain.Options) (domain.Store, error) {
+			return domain.Open(dir, opts)
+		}},
+		{"bolt", func(dir string, opts domain.Options) (domain.Store, error) {
+			return domain.OpenBolt(filepath.Join(dir, "todos.db"), opts)
+		}},
+	} {
+		t.Run(b.name, func(t *testing.T) {
+			dir := t.TempDir()
+			now := time.Now()
+
+			s, err := b.open(dir, diskIndex(dir))
+			require.NoError(t, err)
+			_, err = s.Add(t.Context(), domain.Todo{Title: "Indexed", Created: now})
+			require.NoError(t, err)
+			require.NoError(t, s.Close())
+
+			// Mutate the store without updating the on-disk index.
+			s, err = b.open(dir, domain.Options{})
+			require.NoError(t, err)
+			_, err = s.Add(t.Context(), domain.Todo{Title: "Drifted apart", Created: now})
+			require.NoError(t, err)
+			require.NoError(t, s.Close())
+
+			_, err = b.open(dir, diskIndex(dir))
+			require.ErrorIs(t, err, domain.ErrIndexOutOfSync)
+
+			opts := diskIndex(dir)
+			opts.Reindex = true
+			s, err = b.open(dir, opts)
+			require.NoError(t, err)
+			require.NoError(t, s.Close())
+
+			s, err = b.open(dir, diskIndex(dir))
+			require.NoError(t, err)
+			defer func() { require.NoError(t, s.Close()) }()
+			c := collectAll(t, s, domain.SearchFilters{TextMatch: "drifted"})
+			require.Len(t, c, 1)
+			require.Equal(t, "Drifted apart", c[0].Title)
+		})
+	}
+}
+
+func TestJournalCompact(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC()
+
+	s, err := domain.Open(dir, domain.Options{})
+	require.NoError(t, err)
+	id1, err := s.Add(t.Context(), domain.Todo{Title: "First", Created: now})
+	require.NoError(t, err)
+	id2, err := s.Add(t.Context(), domain.Todo{
+		Title:       "Second",
+		Description: "to be archived",
+		Created:     now,
+	})
+	require.NoError(t, err)
+	id3, err := s.Add(t.Context(), domain.Todo{
+		Title:       "Third",
+		Description: "to be deleted",
+		Created:     now,
+	})
+	require.NoError(t, err)
+	err = s.Edit(t.Context(), id1, 0, func(t *domain.Todo) error {
+		t.Status = domain.StatusDone
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.Archive(t.Context(), id2))
+	require.NoError(t, s.Delete(t.Context(), id3))
+	_, err = s.Purge(t.Context(), 0, time.Now())
+	require.NoError(t, err)
+
+	journalPath := filepath.Join(dir, "journal.jsonl")
+	journal, err := os.ReadFile(journalPath)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Compact())
+	require.NoError(t, s.Close())
+	info, err := os.Stat(journalPath)
+	require.NoError(t, err)
+	require.Zero(t, info.Size())
+
+	s, err = domain.Open(dir, domain.Options{})
+	require.NoError(t, err)
+	checkReopened(t, s, now, id1, id2)
+	require.NoError(t, s.Close())
+
+	// Simulate a crash after writing the snapshot
+	// but before truncating the journal.
+	require.NoError(t, os.WriteFile(journalPath, journal, 0o644))
+
+	s, err = domain.Open(dir, domain.Options{})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, s.Close()) }()
+	checkReopened(t, s, now, id1, id2)
+
+	id4, err := s.Add(t.Context(), domain.Todo{Title: "Fourth", Created: now})
+	require.NoError(t, err)
+	require.Greater(t, id4, id3)
+}
+
+func TestJournalUnranked(t *testing.T) {
+	// Todos journaled before todos had ranks keep their order.
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "journal.jsonl"), []byte(
+		`{"op":"add","gen":1,"id":1,"todo":{"ID":1,"Version":1,"Title":"One","Status":1}}
+{"op":"add","gen":2,"id":2,"todo":{"ID":2,"Version":1,"Title":"Two","Status":1}}
+`), 0o644))
+
+	s, err := domain.Open(dir, domain.Options{})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, s.Close()) }()
+	id3, err := s.Add(t.Context(), domain.Todo{Title: "Three"})
+	require.NoError(t, err)
+	require.NoError(t, s.Move(t.Context(), 1, 2))
+
+	var titles []string
+	for _, todo := range collectAll(t, s, domain.SearchFilters{}) {
+		titles = append(titles, todo.Title)
+	}
+	require.Equal(t, []string{"Two", "One", "Three"}, titles)
+	require.NoError(t, s.Move(t.Context(), id3, 0))
+}
+
+func TestBoltUnranked(t *testing.T) {
+	// Todos stored before todos had ranks keep their order.
+	path := filepath.Join(t.TempDir(), "todos.db")
+	db, err := bolt.Open(path, 0o600, nil)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("todos"))
+		if err != nil {
+			return err
+		}
+		for id, title := range map[uint64]string{1: "One", 2: "Two"} {
+			v := fmt.Sprintf(`{"ID":%d,"Version":1,"Title":%q,"Status":1}`, id, title)
+			if err := b.Put(binary.BigEndian.AppendUint64(nil, id), []byte(v)); err != nil {
+				return err
+			}
+		}
+		return b.SetSequence(2)
+	}))
+	require.NoError(t, db.Close())
+
+	s, err := domain.OpenBolt(path, domain.Options{})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, s.Close()) }()
+	id3, err := s.Add(t.Context(), domain.Todo{Title: "Three"})
+	require.NoError(t, err)
+	require.NoError(t, s.Move(t.Context(), 1, 2))
+
+	titles := func() (titles []string) {
+		for _, todo := range collectAll(t, s, domain.SearchFilters{}) {
+			titles = append(titles, todo.Title)
+		}
+		return titles
+	}
+	require.Equal(t, []string{"Two", "One", "Three"}, titles())
+	require.NoError(t, s.Move(t.Context(), id3, 0))
+	require.Equal(t, []string{"Three", "Two", "One"}, titles())
+}
+
+func TestJournalTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC()
+
+	s, err := domain.Open(dir, domain.Options{})
+	require.NoError(t, err)
+	_, err = s.Add(t.Context(), domain.Todo{Title: "Survivor", Created: now})
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	// Simulate a crash in the middle of writing a record.
+	f, err := os.OpenFile(
+		filepath.Join(dir, "journal.jsonl"), os.O_APPEND|os.O_WRONLY, 0o644,
+	)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"op":"add","id":99,"todo":{"ID":`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err = domain.Open(dir, domain.Options{})
+	require.NoError(t, err)
+	c := collectAll(t, s, domain.SearchFilters{})
+	require.Len(t, c, 1)
+	require.Equal(t, "Survivor", c[0].Title)
+
+	// Appending after the truncated record must produce a valid journal.
+	_, err = s.Add(t.Context(), domain.Todo{Title: "After crash", Created: now})
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	s, err = domain.Open(dir, domain.Options{})
+	require.NoError(t, err)
+	require.Len(t, collectAll(t, s, domain.SearchFilters{}), 2)
+	require.NoError(t, s.Close())
 }
 
 func collectAll(
-	t *testing.T, s *domain.Store, filters domain.SearchFilters,
+	t *testing.T, s domain.Store, filters domain.SearchFilters,
 ) []*domain.Todo {
 	t.Helper()
 	l, err := s.Search(context.Background(), filters)
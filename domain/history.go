@@ -0,0 +1,168 @@
+package domain
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Mutation is a kind of todo mutation.
+type Mutation string
+
+const (
+	MutationAdd     Mutation = "add"
+	MutationEdit    Mutation = "edit"
+	MutationArchive Mutation = "archive"
+	MutationTrash   Mutation = "trash"
+	MutationRestore Mutation = "restore"
+	MutationMove    Mutation = "move"
+	MutationDelete  Mutation = "delete" // Permanent deletion.
+)
+
+// HistoryEntry records a single mutation of a todo.
+type HistoryEntry struct {
+	TodoID   int64
+	Version  int64 // Version of the todo after the mutation.
+	Mutation Mutation
+	Time     time.Time
+	Actor    string
+	Changes  []FieldChange
+}
+
+// FieldChange is the change of a single todo field.
+// Old is empty for added todos and New is empty for deleted todos.
+type FieldChange struct {
+	Field    string
+	Old, New string
+}
+
+// HistoryFilter selects history entries. Zero fields match everything.
+type HistoryFilter struct {
+	TodoID int64
+	Actor  string
+	Since  time.Time // Inclusive.
+	Until  time.Time // Exclusive.
+}
+
+func (f HistoryFilter) match(e *HistoryEntry) bool {
+	return (f.TodoID == 0 || f.TodoID == e.TodoID) &&
+		(f.Actor == "" || f.Actor == e.Actor) &&
+		(f.Since.IsZero() || !e.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || e.Time.Before(f.Until))
+}
+
+type ctxKeyActor struct{}
+
+// WithActor returns a copy of ctx carrying the actor that
+// is recorded in the history of all mutations made with it.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, ctxKeyActor{}, actor)
+}
+
+// ActorFrom returns the actor set by WithActor or "" if there is none.
+func ActorFrom(ctx context.Context) string {
+	a, _ := ctx.Value(ctxKeyActor{}).(string)
+	return a
+}
+
+func (s Status) String() string {
+	switch s {
+	case StatusOpen:
+		return "open"
+	case StatusDone:
+		return "done"
+	}
+	return "unknown"
+}
+
+// newHistoryEntry creates a history entry for the mutation of before into after.
+// before is nil for added todos and after is nil for deleted todos.
+func newHistoryEntry(
+	ctx context.Context, m Mutation, before, after *Todo,
+) *HistoryEntry {
+	e := &HistoryEntry{
+		Mutation: m,
+		Time:     time.Now(),
+		Actor:    ActorFrom(ctx),
+	}
+	var b, a Todo
+	if before != nil {
+		b = *before
+		e.TodoID, e.Version = before.ID, before.Version
+	}
+	if after != nil {
+		a = *after
+		e.TodoID, e.Version = after.ID, after.Version
+	}
+	e.Changes = diffTodos(b, a)
+	return e
+}
+
+// diffTodos returns the user-facing fields that differ between a and b.
+func diffTodos(a, b Todo) (changes []FieldChange) {
+	diff := func(field, a, b string) {
+		if a != b {
+			changes = append(changes, FieldChange{Field: field, Old: a, New: b})
+		}
+	}
+	diff("Title", a.Title, b.Title)
+	diff("Description", a.Description, b.Description)
+	diff("Status", statusStr(a.Status), statusStr(b.Status))
+	diff("Archived", boolStr(a.Archived), boolStr(b.Archived))
+	diff("Due", timeStr(a.Due), timeStr(b.Due))
+	diff("Tags", strings.Join(a.Tags, ", "), strings.Join(b.Tags, ", "))
+	diff("Priority", priorityStr(a.Priority), priorityStr(b.Priority))
+	diff("Checklist", FormatChecklist(a.Checklist), FormatChecklist(b.Checklist))
+	diff("Recurrence", a.Recurrence, b.Recurrence)
+	diff("Blocked by", FormatTodoIDs(a.BlockedBy), FormatTodoIDs(b.BlockedBy))
+	diff("Assignees", idsStr(a.Assignees), idsStr(b.Assignees))
+	diff("Attachments", attachmentsStr(a.Attachments), attachmentsStr(b.Attachments))
+	return changes
+}
+
+// attachmentsStr formats the names of attachments as a comma separated list.
+func attachmentsStr(l []Attachment) string {
+	s := make([]string, len(l))
+	for i, a := range l {
+		s[i] = a.Name
+	}
+	return strings.Join(s, ", ")
+}
+
+// idsStr formats user IDs as a comma separated list.
+func idsStr(ids []int64) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(s, ", ")
+}
+
+func statusStr(s Status) string {
+	if s == 0 {
+		return ""
+	}
+	return s.String()
+}
+
+func priorityStr(p Priority) string {
+	if p == PriorityNone {
+		return ""
+	}
+	return p.String()
+}
+
+func boolStr(b bool) string {
+	if !b {
+		return ""
+	}
+	return strconv.FormatBool(b)
+}
+
+func timeStr(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
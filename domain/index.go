@@ -0,0 +1,387 @@
+package domain
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	blevequery "github.com/blevesearch/bleve/v2/search/query"
+)
+
+// ErrIndexOutOfSync is returned when opening a store with an on-disk
+// search index that doesn't match the store. Rebuild the index
+// by opening the store with Options.Reindex.
+var ErrIndexOutOfSync = errors.New("search index out of sync with store")
+
+// Options are store options.
+type Options struct {
+	// IndexPath is the path of the on-disk search index.
+	// The search index is kept in memory and rebuilt on open if empty.
+	IndexPath string
+
+	// Reindex discards the on-disk search index and rebuilds it from the store.
+	Reindex bool
+}
+
+var (
+	// keyIndexGeneration is the bleve internal key of the store generation
+	// the index was last updated at.
+	keyIndexGeneration = []byte("generation")
+
+	// keyIndexSchema is the bleve internal key of the schema version
+	// the index was built with.
+	keyIndexSchema = []byte("schema")
+)
+
+// indexSchema is the version of the index mapping and document layout.
+// Increment it on every change to newIndexMapping or indexDoc to make sure
+// on-disk indexes built by older versions are detected as out of sync.
+const indexSchema = 5
+
+// tagFacetsMax is the maximum number of tags returned by tagFacets.
+const tagFacetsMax = 50
+
+// openIndex opens the search index, creating it if necessary.
+// fresh is true if the index was newly created and is empty.
+func openIndex(opts Options) (idx bleve.Index, fresh bool, err error) {
+	if opts.IndexPath == "" {
+		return mustMakeBleveIndex(), true, nil
+	}
+	if opts.Reindex {
+		if err := os.RemoveAll(opts.IndexPath); err != nil {
+			return nil, false, fmt.Errorf("removing search index: %w", err)
+		}
+	}
+	idx, err = bleve.Open(opts.IndexPath)
+	if errors.Is(err, bleve.ErrorIndexPathDoesNotExist) {
+		idx, err = bleve.New(opts.IndexPath, newIndexMapping())
+		fresh = true
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("opening search index: %w", err)
+	}
+	return idx, fresh, nil
+}
+
+// checkIndex returns ErrIndexOutOfSync unless idx contains
+// exactly docs documents and was last updated at store generation gen.
+func checkIndex(idx bleve.Index, docs, gen uint64) error {
+	n, err := idx.DocCount()
+	if err != nil {
+		return fmt.Errorf("counting indexed documents: %w", err)
+	}
+	v, err := idx.GetInternal(keyIndexGeneration)
+	if err != nil {
+		return fmt.Errorf("reading index generation: %w", err)
+	}
+	var indexGen uint64
+	if len(v) == 8 {
+		indexGen = binary.BigEndian.Uint64(v)
+	}
+	v, err = idx.GetInternal(keyIndexSchema)
+	if err != nil {
+		return fmt.Errorf("reading index schema: %w", err)
+	}
+	if string(v) != strconv.Itoa(indexSchema) {
+		return fmt.Errorf("%w: index schema %q, expected %d",
+			ErrIndexOutOfSync, v, indexSchema)
+	}
+	if n != docs || indexGen != gen {
+		return fmt.Errorf("%w: index has %d documents at generation %d, "+
+			"store has %d todos at generation %d",
+			ErrIndexOutOfSync, n, indexGen, docs, gen)
+	}
+	return nil
+}
+
+// rebuildIndex indexes todos with their comments by todo ID
+// in a single batch at store generation gen.
+func rebuildIndex(
+	idx bleve.Index, todos []*Todo, comments map[int64][]*Comment, gen uint64,
+) error {
+	b := idx.NewBatch()
+	for _, t := range todos {
+		doc := indexDoc(t, comments[t.ID])
+		if err := b.Index(strconv.FormatInt(t.ID, 10), doc); err != nil {
+			return err
+		}
+	}
+	b.SetInternal(keyIndexGeneration, binary.BigEndian.AppendUint64(nil, gen))
+	b.SetInternal(keyIndexSchema, []byte(strconv.Itoa(indexSchema)))
+	if err := idx.Batch(b); err != nil {
+		return fmt.Errorf("indexing todos: %w", err)
+	}
+	return nil
+}
+
+func mustMakeBleveIndex() bleve.Index {
+	idx, err := bleve.NewMemOnly(newIndexMapping())
+	if err != nil {
+		panic(err)
+	}
+	return idx
+}
+
+func newIndexMapping() *mapping.IndexMappingImpl {
+	doc := bleve.NewDocumentMapping()
+
+	title := bleve.NewTextFieldMapping()
+	title.Store = false
+	title.Analyzer = "en"
+	doc.AddFieldMappingsAt("Title", title)
+
+	desc := bleve.NewTextFieldMapping()
+	desc.Store = false
+	desc.Analyzer = "en"
+	doc.AddFieldMappingsAt("Description", desc)
+
+	comments := bleve.NewTextFieldMapping()
+	comments.Store = false
+	comments.Analyzer = "en"
+	doc.AddFieldMappingsAt("Comments", comments)
+
+	arch := bleve.NewBooleanFieldMapping()
+	arch.Store = false
+	doc.AddFieldMappingsAt("Archived", arch)
+
+	trashed := bleve.NewBooleanFieldMapping()
+	trashed.Store = false
+	doc.AddFieldMappingsAt("Trashed", trashed)
+
+	tags := bleve.NewKeywordFieldMapping()
+	tags.Store = false
+	doc.AddFieldMappingsAt("Tags", tags)
+
+	workspace := bleve.NewNumericFieldMapping()
+	workspace.Store = false
+	doc.AddFieldMappingsAt("Workspace", workspace)
+
+	assignees := bleve.NewNumericFieldMapping()
+	assignees.Store = false
+	doc.AddFieldMappingsAt("Assignees", assignees)
+
+	assigned := bleve.NewBooleanFieldMapping()
+	assigned.Store = false
+	doc.AddFieldMappingsAt("Assigned", assigned)
+
+	m := bleve.NewIndexMapping()
+	m.DefaultAnalyzer = "en"
+	m.DefaultMapping = doc
+	return m
+}
+
+func indexDoc(t *Todo, comments []*Comment) map[string]any {
+	assignees := make([]float64, len(t.Assignees))
+	for i, id := range t.Assignees {
+		assignees[i] = float64(id)
+	}
+	texts := make([]string, len(comments))
+	for i, c := range comments {
+		texts[i] = c.Text
+	}
+	return map[string]any{
+		"Title":       t.Title,
+		"Description": t.Description,
+		"Comments":    texts,
+		"Archived":    t.Archived,
+		"Trashed":     t.InTrash(),
+		"Tags":        t.Tags,
+		"Workspace":   float64(t.Workspace),
+		"Assignees":   assignees,
+		"Assigned":    len(t.Assignees) > 0,
+	}
+}
+
+// indexTodo adds or updates t with its comments in idx
+// at store generation gen.
+func indexTodo(idx bleve.Index, t *Todo, comments []*Comment, gen uint64) error {
+	b := idx.NewBatch()
+	if err := b.Index(strconv.FormatInt(t.ID, 10), indexDoc(t, comments)); err != nil {
+		return err
+	}
+	b.SetInternal(keyIndexGeneration, binary.BigEndian.AppendUint64(nil, gen))
+	return idx.Batch(b)
+}
+
+// unindexTodo removes todo id from idx at store generation gen.
+func unindexTodo(idx bleve.Index, id int64, gen uint64) error {
+	b := idx.NewBatch()
+	b.Delete(strconv.FormatInt(id, 10))
+	b.SetInternal(keyIndexGeneration, binary.BigEndian.AppendUint64(nil, gen))
+	return idx.Batch(b)
+}
+
+// searchIndex returns the IDs of at most size todos matching filters
+// ordered by relevance.
+func searchIndex(
+	idx bleve.Index, filters SearchFilters, size int,
+) (scores map[int64]float64, err error) {
+	req := bleve.NewSearchRequest(buildBleveQuery(filters))
+	req.Size = size
+	res, err := idx.Search(req)
+	if err != nil {
+		return nil, fmt.Errorf("searching index: %w", err)
+	}
+	scores = make(map[int64]float64, len(res.Hits))
+	for _, h := range res.Hits {
+		id, err := strconv.ParseInt(h.ID, 10, 64)
+		if err != nil {
+			continue
+		}
+		scores[id] = h.Score
+	}
+	return scores, nil
+}
+
+// tagFacets returns the number of todos matching filters per tag.
+func tagFacets(idx bleve.Index, filters SearchFilters) ([]TagCount, error) {
+	req := bleve.NewSearchRequestOptions(buildBleveQuery(filters), 0, 0, false)
+	req.AddFacet("tags", bleve.NewFacetRequest("Tags", tagFacetsMax))
+	res, err := idx.Search(req)
+	if err != nil {
+		return nil, fmt.Errorf("searching tag facets: %w", err)
+	}
+	var counts []TagCount
+	if f := res.Facets["tags"]; f != nil && f.Terms != nil {
+		for _, t := range f.Terms.Terms() {
+			counts = append(counts, TagCount{Tag: t.Term, Count: t.Count})
+		}
+	}
+	return counts, nil
+}
+
+func buildBleveQuery(f SearchFilters) blevequery.Query {
+	filterQ := buildBleveFilterQuery(f)
+	contentQ := buildBleveContentQuery(f)
+	if contentQ == nil {
+		return filterQ
+	}
+	return bleve.NewConjunctionQuery(contentQ, filterQ)
+}
+
+// buildBleveFilterQuery returns a query matching the todos
+// selected by all filters except the text match.
+func buildBleveFilterQuery(f SearchFilters) blevequery.Query {
+	boolQ := func(field string, v bool) blevequery.Query {
+		q := bleve.NewBoolFieldQuery(v)
+		q.SetField(field)
+		return q
+	}
+	tagQ := func(tag string) blevequery.Query {
+		q := bleve.NewTermQuery(tag)
+		q.SetField("Tags")
+		return q
+	}
+
+	idQ := func(field string, id int64) blevequery.Query {
+		v, inclusive := float64(id), true
+		q := bleve.NewNumericRangeInclusiveQuery(&v, &v, &inclusive, &inclusive)
+		q.SetField(field)
+		return q
+	}
+
+	must := []blevequery.Query{boolQ("Trashed", f.Trashed)}
+	if !f.Trashed {
+		must = append(must, boolQ("Archived", f.Archived))
+	}
+	if f.Workspace != 0 {
+		must = append(must, idQ("Workspace", f.Workspace))
+	}
+	if f.Assignee != 0 {
+		must = append(must, idQ("Assignees", f.Assignee))
+	}
+	if f.Unassigned {
+		must = append(must, boolQ("Assigned", false))
+	}
+	for _, tag := range f.Tags {
+		must = append(must, tagQ(tag))
+	}
+	q := bleve.NewBooleanQuery()
+	q.AddMust(must...)
+	for _, tag := range f.ExcludeTags {
+		q.AddMustNot(tagQ(tag))
+	}
+	return q
+}
+
+// buildBleveContentQuery returns a query matching f.TextMatch
+// or nil if there's no text to match.
+func buildBleveContentQuery(f SearchFilters) blevequery.Query {
+	terms := strings.Fields(strings.TrimSpace(f.TextMatch))
+	if len(terms) == 0 {
+		return nil
+	}
+
+	// Strategy 1: Try exact phrase match first (highest priority)
+	var exactQueries []blevequery.Query
+	fullText := strings.Join(terms, " ")
+
+	titlePhraseQuery := bleve.NewMatchPhraseQuery(fullText)
+	titlePhraseQuery.SetField("Title")
+	titlePhraseQuery.SetBoost(10.0) // High boost for exact title matches
+	exactQueries = append(exactQueries, titlePhraseQuery)
+
+	descPhraseQuery := bleve.NewMatchPhraseQuery(fullText)
+	descPhraseQuery.SetField("Description")
+	descPhraseQuery.SetBoost(2.0) // Lower boost for description matches
+	exactQueries = append(exactQueries, descPhraseQuery)
+
+	commentsPhraseQuery := bleve.NewMatchPhraseQuery(fullText)
+	commentsPhraseQuery.SetField("Comments")
+	commentsPhraseQuery.SetBoost(1.0) // Lowest boost for the discussion
+	exactQueries = append(exactQueries, commentsPhraseQuery)
+
+	// Strategy 2: Individual term matches (for partial matches)
+	var termQueries []blevequery.Query
+	for _, term := range terms {
+		titleMatch := bleve.NewMatchQuery(term)
+		titleMatch.SetField("Title")
+		titleMatch.SetBoost(3.0) // Boost title matches
+
+		descMatch := bleve.NewMatchQuery(term)
+		descMatch.SetField("Description")
+		descMatch.SetBoost(1.0) // Normal boost for description
+
+		commentsMatch := bleve.NewMatchQuery(term)
+		commentsMatch.SetField("Comments")
+		commentsMatch.SetBoost(0.5)
+
+		termQueries = append(termQueries, titleMatch, descMatch, commentsMatch)
+	}
+
+	// Strategy 3: Fuzzy matching for typos
+	var fuzzyQueries []blevequery.Query
+	for _, term := range terms {
+		if len(term) > 3 { // Only fuzzy match longer terms
+			titleFuzzy := bleve.NewFuzzyQuery(term)
+			titleFuzzy.SetField("Title")
+			titleFuzzy.SetFuzziness(1) // Allow 1 character difference
+			titleFuzzy.SetBoost(0.5)   // Lower boost for fuzzy matches
+
+			descFuzzy := bleve.NewFuzzyQuery(term)
+			descFuzzy.SetField("Description")
+			descFuzzy.SetFuzziness(1)
+			descFuzzy.SetBoost(0.3)
+
+			commentsFuzzy := bleve.NewFuzzyQuery(term)
+			commentsFuzzy.SetField("Comments")
+			commentsFuzzy.SetFuzziness(1)
+			commentsFuzzy.SetBoost(0.2)
+
+			fuzzyQueries = append(fuzzyQueries, titleFuzzy, descFuzzy, commentsFuzzy)
+		}
+	}
+
+	// Combine all strategies with OR (disjunction)
+	var allQueries []blevequery.Query
+	allQueries = append(allQueries, exactQueries...)
+	allQueries = append(allQueries, termQueries...)
+	allQueries = append(allQueries, fuzzyQueries...)
+
+	return bleve.NewDisjunctionQuery(allQueries...)
+}
@@ -0,0 +1,246 @@
+package domain
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	journalFileName  = "journal.jsonl"
+	snapshotFileName = "snapshot.json"
+)
+
+// journalRecord is a single line in the journal.
+// Delete records only carry the ID, comment records carry the comment
+// after the mutation or the deleted comment, all other records carry
+// the full todo after the mutation. Batch records carry the records of
+// mutations that must be replayed all or not at all. Records of generations
+// already contained in the snapshot are skipped on replay.
+type journalRecord struct {
+	Op      Mutation        `json:"op"`
+	Gen     uint64          `json:"gen"` // Store generation after the mutation.
+	ID      int64           `json:"id"`
+	Todo    *Todo           `json:"todo,omitempty"`
+	Comment *Comment        `json:"comment,omitempty"`
+	Entry   *HistoryEntry   `json:"entry,omitempty"`
+	Batch   []journalRecord `json:"batch,omitempty"`
+}
+
+// opBatch is the operation of batch records.
+const opBatch Mutation = "batch"
+
+// snapshot is the compacted state of the journal.
+type snapshot struct {
+	Gen     uint64         `json:"gen"`
+	LastID  int64          `json:"lastID"`
+	Todos   []*Todo        `json:"todos"`
+	History []HistoryEntry `json:"history"`
+
+	Comments      []*Comment `json:"comments,omitempty"`
+	LastCommentID int64      `json:"lastCommentID,omitempty"`
+}
+
+// journal is an fsync'd append-only log of store mutations.
+type journal struct {
+	dir     string
+	file    journalFile
+	records int // Number of records appended since the last snapshot.
+	// broken is the error that left a torn record in the journal
+	// if it couldn't be removed. No more records are appended after it
+	// since replay would fail on the torn record in the middle.
+	broken error
+}
+
+// journalFile is the file of a journal.
+type journalFile interface {
+	io.ReadWriteSeeker
+	io.Closer
+	Sync() error
+	Truncate(size int64) error
+}
+
+// openJournal opens the journal in dir, creating dir if necessary,
+// calls restore with the snapshot and then apply for every journal record
+// in order. A torn record at the end of the journal, as left by a crash
+// mid-write, is truncated.
+func openJournal(
+	dir string, restore func(snapshot), apply func(journalRecord),
+) (*journal, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating data directory: %w", err)
+	}
+
+	snap, err := readSnapshot(filepath.Join(dir, snapshotFileName))
+	if err != nil {
+		return nil, err
+	}
+	restore(snap)
+
+	f, err := os.OpenFile(
+		filepath.Join(dir, journalFileName), os.O_RDWR|os.O_CREATE, 0o644,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("opening journal: %w", err)
+	}
+
+	j := &journal{dir: dir, file: f}
+	valid, err := j.replay(apply)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err := f.Truncate(valid); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("truncating torn journal record: %w", err)
+	}
+	if _, err := f.Seek(valid, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("seeking journal end: %w", err)
+	}
+	return j, nil
+}
+
+// replay calls apply for every complete record and returns
+// the offset after the last complete record.
+func (j *journal) replay(apply func(journalRecord)) (valid int64, err error) {
+	r := bufio.NewReader(j.file)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// A line without a trailing newline is a torn write.
+			return valid, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("reading journal: %w", err)
+		}
+		var rec journalRecord
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			return 0, fmt.Errorf("decoding journal record at offset %d: %w", valid, err)
+		}
+		apply(rec)
+		valid += int64(len(line))
+		j.records++
+	}
+}
+
+// append writes rec to the journal and syncs it to disk.
+// What was written of rec is removed again if that fails.
+func (j *journal) append(rec journalRecord) error {
+	if j.broken != nil {
+		return fmt.Errorf("journal has a torn record: %w", j.broken)
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encoding journal record: %w", err)
+	}
+	b = append(b, '\n')
+	end, err := j.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("seeking journal end: %w", err)
+	}
+	if err := j.write(b); err != nil {
+		if errTrunc := j.truncate(end); errTrunc != nil {
+			j.broken = errors.Join(err, errTrunc)
+		}
+		return err
+	}
+	j.records++
+	return nil
+}
+
+func (j *journal) write(b []byte) error {
+	if _, err := j.file.Write(b); err != nil {
+		return fmt.Errorf("writing journal: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("syncing journal: %w", err)
+	}
+	return nil
+}
+
+// truncate truncates the journal to size and continues writing at its end.
+func (j *journal) truncate(size int64) error {
+	if err := j.file.Truncate(size); err != nil {
+		return fmt.Errorf("truncating journal: %w", err)
+	}
+	if _, err := j.file.Seek(size, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking journal end: %w", err)
+	}
+	return nil
+}
+
+// compact atomically replaces the snapshot with snap and truncates the journal.
+func (j *journal) compact(snap snapshot) error {
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("encoding snapshot: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(j.dir, snapshotFileName), b); err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	// Crashing before the journal is truncated is safe
+	// since records already in the snapshot are skipped on replay.
+	if err := j.truncate(0); err != nil {
+		return err
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("syncing journal: %w", err)
+	}
+	j.records = 0
+	j.broken = nil
+	return nil
+}
+
+func (j *journal) close() error { return j.file.Close() }
+
+func readSnapshot(path string) (snapshot, error) {
+	var snap snapshot
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return snap, nil
+	}
+	if err != nil {
+		return snap, fmt.Errorf("reading snapshot: %w", err)
+	}
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return snap, fmt.Errorf("decoding snapshot: %w", err)
+	}
+	return snap, nil
+}
+
+// writeFileAtomic writes data to a temporary file, syncs it and renames it
+// to path so that readers never observe a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = d.Close() }()
+	return d.Sync()
+}
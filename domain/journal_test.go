@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// tearingFile is a journal file whose writes fail after writing
+// half of the data and whose truncation fails if failTruncate is set.
+type tearingFile struct {
+	journalFile
+	failTruncate bool
+}
+
+var errTest = errors.New("test")
+
+func (f *tearingFile) Write(b []byte) (int, error) {
+	n, _ := f.journalFile.Write(b[:len(b)/2])
+	return n, errTest
+}
+
+func (f *tearingFile) Truncate(size int64) error {
+	if f.failTruncate {
+		return errTest
+	}
+	return f.journalFile.Truncate(size)
+}
+
+func TestJournalAppendFailure(t *testing.T) {
+	for _, failTruncate := range []bool{false, true} {
+		t.Run("", func(t *testing.T) {
+			dir := t.TempDir()
+			j, err := openJournal(dir, func(snapshot) {}, func(journalRecord) {})
+			require.NoError(t, err)
+			require.NoError(t, j.append(journalRecord{Op: MutationAdd, ID: 1}))
+
+			f := j.file
+			j.file = &tearingFile{journalFile: f, failTruncate: failTruncate}
+			require.ErrorIs(t, j.append(journalRecord{Op: MutationAdd, ID: 2}), errTest)
+			j.file = f
+
+			err = j.append(journalRecord{Op: MutationAdd, ID: 3})
+			if failTruncate {
+				// Records after the torn one would be lost on replay.
+				require.ErrorIs(t, err, errTest)
+			} else {
+				require.NoError(t, err)
+			}
+			require.NoError(t, j.close())
+
+			var ids []int64
+			j, err = openJournal(dir, func(snapshot) {}, func(r journalRecord) {
+				ids = append(ids, r.ID)
+			})
+			require.NoError(t, err)
+			require.NoError(t, j.close())
+			if failTruncate {
+				require.Equal(t, []int64{1}, ids)
+			} else {
+				require.Equal(t, []int64{1, 3}, ids)
+			}
+		})
+	}
+}
+
+func TestMemStoreEditAtomic(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Options{})
+	require.NoError(t, err)
+	blocker, err := s.Add(t.Context(), Todo{Title: "Blocker"})
+	require.NoError(t, err)
+	blocked, err := s.Add(t.Context(), Todo{Title: "Blocked", BlockedBy: []int64{blocker}})
+	require.NoError(t, err)
+
+	archive := func(t *Todo) error {
+		t.Archived = true
+		return nil
+	}
+
+	// Archiving the blocker also unblocks the blocked todo, neither is
+	// committed if the journal fails.
+	f := s.journal.file
+	s.journal.file = &tearingFile{journalFile: f}
+	require.ErrorIs(t, s.Edit(t.Context(), blocker, 0, archive), errTest)
+	s.journal.file = f
+	todo, err := s.Get(t.Context(), blocker)
+	require.NoError(t, err)
+	require.False(t, todo.Archived)
+	todo, err = s.Get(t.Context(), blocked)
+	require.NoError(t, err)
+	require.Equal(t, []int64{blocker}, todo.BlockedBy)
+
+	require.NoError(t, s.Edit(t.Context(), blocker, 0, archive))
+	require.NoError(t, s.Close())
+
+	s, err = Open(dir, Options{})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, s.Close()) }()
+	todo, err = s.Get(t.Context(), blocker)
+	require.NoError(t, err)
+	require.True(t, todo.Archived)
+	todo, err = s.Get(t.Context(), blocked)
+	require.NoError(t, err)
+	require.Empty(t, todo.BlockedBy)
+	h, err := s.History(t.Context(), HistoryFilter{})
+	require.NoError(t, err)
+	require.Len(t, h, 4)
+}
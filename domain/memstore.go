@@ -0,0 +1,656 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// MemStore is a Store keeping all todos in memory.
+// It is optionally persisted to an append-only journal, see Open.
+type MemStore struct {
+	lock        sync.Mutex
+	todos       []*Todo
+	indexByID   map[int64]*Todo
+	indexByUID  map[string]*Todo
+	searchIndex bleve.Index
+	journal     *journal // nil for in-memory stores.
+
+	// generation is incremented on every mutation.
+	generation uint64
+
+	// lastID is the highest ID ever allocated, including deleted todos.
+	lastID int64
+
+	history []HistoryEntry
+
+	// comments are the comments by todo ID, oldest first.
+	comments      map[int64][]*Comment
+	lastCommentID int64
+}
+
+var _ Store = new(MemStore)
+
+// New creates a new in-memory store.
+func New() *MemStore { return newMemStore(mustMakeBleveIndex()) }
+
+func newMemStore(searchIndex bleve.Index) *MemStore {
+	return &MemStore{
+		indexByID:   make(map[int64]*Todo),
+		indexByUID:  make(map[string]*Todo),
+		comments:    make(map[int64][]*Comment),
+		searchIndex: searchIndex,
+	}
+}
+
+// Open opens a store persisted in dir.
+// The snapshot and journal in dir are replayed on open
+// and every mutation is appended to the journal.
+// Use Compact to periodically snapshot the journal.
+func Open(dir string, opts Options) (*MemStore, error) {
+	idx, freshIndex, err := openIndex(opts)
+	if err != nil {
+		return nil, err
+	}
+	s := newMemStore(idx)
+	var errApply error
+	j, err := openJournal(dir, s.restore, func(rec journalRecord) {
+		if errApply == nil {
+			errApply = s.apply(rec)
+		}
+	})
+	if err != nil {
+		_ = idx.Close()
+		return nil, err
+	}
+	switch {
+	case errApply != nil:
+		err = fmt.Errorf("replaying journal: %w", errApply)
+	case freshIndex:
+		err = rebuildIndex(idx, s.todos, s.comments, s.generation)
+	default:
+		err = checkIndex(idx, uint64(len(s.todos)), s.generation)
+	}
+	if err != nil {
+		_ = j.close()
+		_ = idx.Close()
+		return nil, err
+	}
+	s.journal = j
+	return s, nil
+}
+
+// restore restores the state of a snapshot.
+func (s *MemStore) restore(snap snapshot) {
+	for _, t := range snap.Todos {
+		s.put(t)
+	}
+	for _, c := range snap.Comments {
+		s.putComment(c)
+	}
+	s.history = snap.History
+	s.generation = snap.Gen
+	s.lastID = max(s.lastID, snap.LastID)
+	s.lastCommentID = max(s.lastCommentID, snap.LastCommentID)
+}
+
+// apply applies a replayed journal record.
+func (s *MemStore) apply(rec journalRecord) error {
+	if rec.Op == opBatch {
+		for _, r := range rec.Batch {
+			if err := s.apply(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if rec.Gen <= s.generation {
+		return nil // Already contained in the snapshot.
+	}
+	s.generation = rec.Gen
+	if rec.Entry != nil {
+		s.history = append(s.history, *rec.Entry)
+	}
+	switch rec.Op {
+	case MutationDelete:
+		s.remove(rec.ID)
+		return nil
+	case opComment, opDeleteComment:
+		if rec.Comment == nil {
+			return fmt.Errorf("%s record %d without comment", rec.Op, rec.ID)
+		}
+		if rec.Op == opComment {
+			s.putComment(rec.Comment)
+		} else if l, _, err := deleteComment(s.comments[rec.ID], rec.Comment.ID); err == nil {
+			s.comments[rec.ID] = l
+		}
+		return nil
+	}
+	if rec.Todo == nil {
+		return fmt.Errorf("%s record %d without todo", rec.Op, rec.ID)
+	}
+	s.put(rec.Todo)
+	return nil
+}
+
+// put inserts or replaces a copy of t.
+func (s *MemStore) put(t *Todo) {
+	if existing, ok := s.indexByID[t.ID]; ok {
+		*existing = *t
+	} else {
+		c := *t
+		if c.Rank == "" {
+			c.Rank = legacyRank(c.ID)
+		}
+		s.todos = append(s.todos, &c)
+		s.indexByID[c.ID] = &c
+		if c.UID != "" {
+			s.indexByUID[c.UID] = &c
+		}
+	}
+	// Make sure new IDs don't collide with replayed ones.
+	s.lastID = max(s.lastID, t.ID)
+}
+
+// putComment inserts or replaces a copy of c.
+func (s *MemStore) putComment(c *Comment) {
+	copied := *c
+	comments := s.comments[c.TodoID]
+	if i := slices.IndexFunc(comments, func(x *Comment) bool {
+		return x.ID == c.ID
+	}); i >= 0 {
+		comments[i] = &copied
+	} else {
+		comments = append(comments, &copied)
+	}
+	s.comments[c.TodoID] = comments
+	// Make sure new IDs don't collide with replayed ones.
+	s.lastCommentID = max(s.lastCommentID, c.ID)
+}
+
+// remove removes todo id and its comments if it exists.
+func (s *MemStore) remove(id int64) {
+	t, ok := s.indexByID[id]
+	if !ok {
+		return
+	}
+	s.todos = slices.DeleteFunc(s.todos, func(t *Todo) bool { return t.ID == id })
+	delete(s.indexByID, id)
+	delete(s.indexByUID, t.UID)
+	delete(s.comments, id)
+}
+
+// Compact writes a snapshot of the current state and truncates the journal.
+// Compact is a no-op for in-memory stores and when the journal is empty.
+func (s *MemStore) Compact() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.journal == nil || s.journal.records == 0 {
+		return nil
+	}
+	var comments []*Comment
+	for _, t := range s.todos {
+		comments = append(comments, s.comments[t.ID]...)
+	}
+	return s.journal.compact(snapshot{
+		Gen: s.generation, LastID: s.lastID, Todos: s.todos, History: s.history,
+		Comments: comments, LastCommentID: s.lastCommentID,
+	})
+}
+
+// Close closes the journal and the search index.
+func (s *MemStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var errJournal error
+	if s.journal != nil {
+		errJournal = s.journal.close()
+	}
+	return errors.Join(errJournal, s.searchIndex.Close())
+}
+
+// record appends rec to the journal unless the store is in-memory.
+func (s *MemStore) record(rec journalRecord) error {
+	if s.journal == nil {
+		return nil
+	}
+	return s.journal.append(rec)
+}
+
+func (s *MemStore) History(
+	_ context.Context, filter HistoryFilter,
+) (res []HistoryEntry, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i := range s.history {
+		if filter.match(&s.history[i]) {
+			res = append(res, s.history[i])
+		}
+	}
+	return res, nil
+}
+
+func (s *MemStore) Add(ctx context.Context, todo Todo) (id int64, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.add(ctx, todo)
+}
+
+func (s *MemStore) add(ctx context.Context, todo Todo) (id int64, err error) {
+	c, err := s.prepareAdd(ctx, todo)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.commit(ctx, c); err != nil {
+		return 0, err
+	}
+	return c.updated.ID, nil
+}
+
+// prepareAdd validates todo and returns the change adding it.
+func (s *MemStore) prepareAdd(ctx context.Context, todo Todo) (change, error) {
+	if err := validate(&todo); err.IsErr() {
+		return change{}, err
+	}
+	if err := checkBlockers(&todo, s.findByID); err != nil {
+		return change{}, err
+	}
+	t := newTodo(ctx, s.lastID+1, lastRank(s.todos), todo)
+	return change{MutationAdd, nil, t}, nil
+}
+
+func (s *MemStore) findByID(id int64) (*Todo, error) {
+	t, ok := s.indexByID[id]
+	if !ok {
+		return nil, ErrNotExists
+	}
+	return t, nil
+}
+
+func (s *MemStore) Get(_ context.Context, id int64) (*Todo, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, err := s.findByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return t.Clone(), nil
+}
+
+func (s *MemStore) GetByUID(_ context.Context, uid string) (*Todo, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, ok := s.indexByUID[uid]
+	if !ok {
+		return nil, ErrNotExists
+	}
+	return t.Clone(), nil
+}
+
+func (s *MemStore) Search(_ context.Context, filters SearchFilters) (res []*Todo, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if strings.TrimSpace(filters.TextMatch) == "" {
+		// Fast search with simple filters.
+		for _, t := range s.todos {
+			if filters.match(t) && s.matchBlocked(filters, t) {
+				res = append(res, t.Clone())
+			}
+		}
+		sortTodos(res, filters, nil)
+		return res, nil
+	}
+
+	// Slow search by text match.
+	scores, err := searchIndex(s.searchIndex, filters, len(s.todos))
+	if err != nil {
+		return nil, err
+	}
+	for id := range scores {
+		t := s.indexByID[id]
+		if t == nil || !filters.match(t) || !s.matchBlocked(filters, t) {
+			continue
+		}
+		res = append(res, t.Clone())
+	}
+	sortTodos(res, filters, scores)
+	return res, nil
+}
+
+func (s *MemStore) matchBlocked(filters SearchFilters, t *Todo) bool {
+	// findByID only fails for todos that don't exist which don't block.
+	ok, _ := filters.matchBlocked(t, s.findByID)
+	return ok
+}
+
+func (s *MemStore) TagCounts(
+	_ context.Context, filters SearchFilters,
+) ([]TagCount, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return tagFacets(s.searchIndex, filters)
+}
+
+func (s *MemStore) Edit(
+	ctx context.Context, id int64, version int64, mutate func(*Todo) error,
+) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	todo, err := s.findByID(id)
+	if err != nil {
+		return err
+	}
+	updated, err := editTodo(todo, version, mutate)
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(todo.BlockedBy, updated.BlockedBy) {
+		if err := checkBlockers(updated, s.findByID); err != nil {
+			return err
+		}
+	}
+	changes := []change{{MutationEdit, todo, updated}}
+	if detached(todo, updated) {
+		changes = append(changes, s.unblockAll(id)...)
+	}
+	var next *Todo
+	if n := nextOccurrence(ctx, todo, updated); n != nil {
+		c, err := s.prepareAdd(ctx, *n)
+		if err != nil {
+			return err
+		}
+		changes, next = append(changes, c), c.updated
+	}
+	if err := s.commit(ctx, changes...); err != nil {
+		return err
+	}
+	if next != nil {
+		setNextOccurrence(ctx, next.ID)
+	}
+	return nil
+}
+
+func (s *MemStore) Archive(ctx context.Context, id int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	todo, err := s.findByID(id)
+	if err != nil {
+		return err
+	}
+	updated := *todo
+	updated.Archived = true
+	updated.BlockedBy = nil
+	updated.Version++
+	changes := []change{{MutationArchive, todo, &updated}}
+	return s.commit(ctx, append(changes, s.unblockAll(id)...)...)
+}
+
+// unblockAll returns the changes removing blocker
+// from the blockers of all todos.
+func (s *MemStore) unblockAll(blocker int64) (changes []change) {
+	for _, t := range s.todos {
+		if updated := unblock(t, blocker); updated != nil {
+			changes = append(changes, change{MutationEdit, t, updated})
+		}
+	}
+	return changes
+}
+
+// change is a mutation of todo into updated. todo is nil for added todos.
+type change struct {
+	m             Mutation
+	todo, updated *Todo
+}
+
+// commit indexes and journals changes as a single record and applies them
+// so that either all or none of them are committed.
+// The actor of ctx is recorded as the last to update the todos.
+func (s *MemStore) commit(ctx context.Context, changes ...change) error {
+	recs := make([]journalRecord, len(changes))
+	gen := s.generation
+	for i, c := range changes {
+		gen++
+		c.updated.UpdatedBy = ActorFrom(ctx)
+		if err := indexTodo(
+			s.searchIndex, c.updated, s.comments[c.updated.ID], gen,
+		); err != nil {
+			s.reindex(changes[:i])
+			return err
+		}
+		recs[i] = journalRecord{
+			Op: c.m, Gen: gen, ID: c.updated.ID, Todo: c.updated,
+			Entry: newHistoryEntry(ctx, c.m, c.todo, c.updated),
+		}
+	}
+	rec := recs[0]
+	if len(recs) > 1 {
+		rec = journalRecord{Op: opBatch, Gen: gen, Batch: recs}
+	}
+	if err := s.record(rec); err != nil {
+		// Roll back in case of journal failure.
+		s.reindex(changes)
+		return err
+	}
+	s.generation = gen
+	for i, c := range changes {
+		s.history = append(s.history, *recs[i].Entry)
+		if c.todo == nil {
+			s.put(c.updated)
+		} else {
+			*c.todo = *c.updated
+		}
+	}
+	return nil
+}
+
+// reindex restores the search index of the todos
+// to their state before changes.
+func (s *MemStore) reindex(changes []change) {
+	for _, c := range changes {
+		if c.todo == nil {
+			_ = unindexTodo(s.searchIndex, c.updated.ID, s.generation)
+		} else {
+			_ = indexTodo(s.searchIndex, c.todo, s.comments[c.todo.ID], s.generation)
+		}
+	}
+}
+
+func (s *MemStore) Delete(ctx context.Context, id int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	todo, err := s.findByID(id)
+	if err != nil {
+		return err
+	}
+	if todo.InTrash() {
+		return ErrNotExists
+	}
+	updated := *todo
+	updated.Trashed = time.Now()
+	updated.BlockedBy = nil
+	updated.Version++
+	changes := []change{{MutationTrash, todo, &updated}}
+	return s.commit(ctx, append(changes, s.unblockAll(id)...)...)
+}
+
+func (s *MemStore) Restore(ctx context.Context, id int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	todo, err := s.findByID(id)
+	if err != nil {
+		return err
+	}
+	if !todo.InTrash() {
+		return ErrNotExists
+	}
+	updated := *todo
+	updated.Trashed = time.Time{}
+	updated.Version++
+	return s.commit(ctx, change{MutationRestore, todo, &updated})
+}
+
+func (s *MemStore) Move(ctx context.Context, id, after int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	todo, err := s.findByID(id)
+	if err != nil {
+		return err
+	}
+	rank, err := rankAfter(s.todos, id, after)
+	if err != nil {
+		return err
+	}
+	updated := *todo
+	updated.Rank = rank
+	updated.Version++
+	return s.commit(ctx, change{MutationMove, todo, &updated})
+}
+
+func (s *MemStore) Purge(
+	ctx context.Context, workspace int64, before time.Time,
+) (purged int, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var expired []*Todo
+	for _, t := range s.todos {
+		if purgeable(t, workspace, before) {
+			expired = append(expired, t)
+		}
+	}
+	for _, t := range expired {
+		if err := s.delete(ctx, t); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// delete permanently deletes todo.
+func (s *MemStore) delete(ctx context.Context, todo *Todo) error {
+	gen := s.generation + 1
+	entry := newHistoryEntry(ctx, MutationDelete, todo, nil)
+	if err := s.record(journalRecord{
+		Op: MutationDelete, Gen: gen, ID: todo.ID, Entry: entry,
+	}); err != nil {
+		return err
+	}
+
+	s.generation = gen
+	s.history = append(s.history, *entry)
+	s.remove(todo.ID)
+	return unindexTodo(s.searchIndex, todo.ID, gen)
+}
+
+func (s *MemStore) AddComment(_ context.Context, c Comment) (id int64, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := ValidateComment(c.Text); err.IsErr() {
+		return 0, err
+	}
+	todo, err := s.findByID(c.TodoID)
+	if err != nil {
+		return 0, err
+	}
+	if err := commentable(todo); err != nil {
+		return 0, err
+	}
+	added := newComment(s.lastCommentID+1, c)
+	comments := append(slices.Clone(s.comments[todo.ID]), added)
+	if err := s.commitComments(todo, comments, opComment, added); err != nil {
+		return 0, err
+	}
+	s.lastCommentID = added.ID
+	return added.ID, nil
+}
+
+func (s *MemStore) EditComment(_ context.Context, todoID, id int64, text string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := ValidateComment(text); err.IsErr() {
+		return err
+	}
+	todo, err := s.findByID(todoID)
+	if err != nil {
+		return err
+	}
+	if err := commentable(todo); err != nil {
+		return err
+	}
+	comments, edited, err := editComment(s.comments[todoID], id, text)
+	if err != nil {
+		return err
+	}
+	return s.commitComments(todo, comments, opComment, edited)
+}
+
+func (s *MemStore) DeleteComment(_ context.Context, todoID, id int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	todo, err := s.findByID(todoID)
+	if err != nil {
+		return err
+	}
+	if err := commentable(todo); err != nil {
+		return err
+	}
+	comments, deleted, err := deleteComment(s.comments[todoID], id)
+	if err != nil {
+		return err
+	}
+	return s.commitComments(todo, comments, opDeleteComment, deleted)
+}
+
+// commitComments reindexes and journals todo with its updated comments
+// after operation op on comment c.
+func (s *MemStore) commitComments(
+	todo *Todo, comments []*Comment, op Mutation, c *Comment,
+) error {
+	gen := s.generation + 1
+	if err := indexTodo(s.searchIndex, todo, comments, gen); err != nil {
+		return err
+	}
+	if err := s.record(journalRecord{
+		Op: op, Gen: gen, ID: todo.ID, Comment: c,
+	}); err != nil {
+		// Roll back in case of journal failure.
+		_ = indexTodo(s.searchIndex, todo, s.comments[todo.ID], s.generation)
+		return err
+	}
+	s.generation = gen
+	s.comments[todo.ID] = comments
+	return nil
+}
+
+func (s *MemStore) Comments(_ context.Context, todoID int64) ([]*Comment, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, err := s.findByID(todoID); err != nil {
+		return nil, err
+	}
+	return slices.Clone(s.comments[todoID]), nil
+}
@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// rankDigits are the digits of ranks in ascending order.
+const rankDigits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// rankBetween returns a rank ordered strictly between a and b
+// where "" for a means no lower and "" for b means no upper bound.
+// Returned ranks never end in the lowest digit so that there's
+// always room for another rank between any two ranks.
+func rankBetween(a, b string) string {
+	var rank []byte
+	for i := 0; ; i++ {
+		lo := 0
+		if i < len(a) {
+			lo = strings.IndexByte(rankDigits, a[i])
+		}
+		hi := len(rankDigits) // Exclusive.
+		if i < len(b) {
+			hi = strings.IndexByte(rankDigits, b[i])
+		}
+		if hi-lo > 1 {
+			return string(append(rank, rankDigits[(lo+hi)/2]))
+		}
+		rank = append(rank, rankDigits[lo])
+		if lo < hi {
+			// rank is below b no matter which digits follow.
+			b = ""
+		}
+	}
+}
+
+// legacyRank returns the rank of todos added before todos had ranks.
+// It orders them by ID before all ranks returned by rankBetween.
+func legacyRank(id int64) string {
+	return fmt.Sprintf("0%013si", strconv.FormatInt(id, len(rankDigits)))
+}
+
+func compareRanks(a, b *Todo) int {
+	if c := strings.Compare(a.Rank, b.Rank); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
+
+// lastRank returns the rank of a todo added after all todos.
+func lastRank(todos []*Todo) string {
+	var last string
+	for _, t := range todos {
+		last = max(last, t.Rank)
+	}
+	return rankBetween(last, "")
+}
+
+// rankAfter returns the rank of todo id when moved right after
+// todo after in todos, or before all todos if after is 0.
+// Returns ErrNotExists if after isn't in todos.
+func rankAfter(todos []*Todo, id, after int64) (string, error) {
+	if after == id {
+		// Moving a todo after itself keeps it in place.
+		i := slices.IndexFunc(todos, func(t *Todo) bool { return t.ID == id })
+		if i < 0 {
+			return "", ErrNotExists
+		}
+		return todos[i].Rank, nil
+	}
+	ordered := slices.SortedFunc(slices.Values(todos), compareRanks)
+	ordered = slices.DeleteFunc(ordered, func(t *Todo) bool { return t.ID == id })
+	next := 0
+	if after != 0 {
+		i := slices.IndexFunc(ordered, func(t *Todo) bool { return t.ID == after })
+		if i < 0 {
+			return "", ErrNotExists
+		}
+		next = i + 1
+	}
+	var lo, hi string
+	if next > 0 {
+		lo = ordered[next-1].Rank
+	}
+	if next < len(ordered) {
+		hi = ordered[next].Rank
+	}
+	return rankBetween(lo, hi), nil
+}
@@ -0,0 +1,357 @@
+package domain
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is how often a recurring todo repeats.
+type Frequency string
+
+const (
+	FrequencyDaily   Frequency = "DAILY"
+	FrequencyWeekly  Frequency = "WEEKLY"
+	FrequencyMonthly Frequency = "MONTHLY"
+)
+
+const (
+	untilDateFormat     = "20060102"
+	untilDateTimeFormat = "20060102T150405Z"
+)
+
+// MaxRecurrenceInterval is the maximum interval of a recurrence rule.
+const MaxRecurrenceInterval = 1000
+
+var weekdayCodes = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Recurrence is a recurrence rule of a todo.
+// The zero value is a todo that doesn't recur.
+type Recurrence struct {
+	Freq Frequency
+
+	// Interval is the number of periods between occurrences,
+	// at least 1 and at most MaxRecurrenceInterval.
+	Interval int
+
+	// Weekdays are the days of the week weekly rules repeat on
+	// starting with Monday.
+	// Weekly rules without weekdays repeat on the weekday of the due date.
+	Weekdays []time.Weekday
+
+	// MonthDay is the day of the month monthly rules repeat on, -1 is
+	// the last day of the month. Months without the day are skipped.
+	// Monthly rules without day repeat on the day of the due date.
+	MonthDay int
+
+	// Until is the last time an occurrence may be due at, zero if unbounded.
+	// If UntilDate is true Until is a date in the location of the todo.
+	Until     time.Time
+	UntilDate bool
+
+	// Count is the number of occurrences left including the current one,
+	// 0 if unlimited.
+	Count int
+}
+
+// ParseRecurrence parses a subset of RFC 5545 RRULEs:
+// FREQ=DAILY, WEEKLY or MONTHLY with INTERVAL, BYDAY for weekly rules,
+// BYMONTHDAY for monthly rules and either UNTIL or COUNT.
+// An optional "RRULE:" prefix is ignored. "" is parsed as the zero value.
+func ParseRecurrence(rule string) (Recurrence, error) {
+	var r Recurrence
+	rule = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rule)), "RRULE:")
+	if rule == "" {
+		return r, nil
+	}
+	seen := map[string]bool{}
+	for part := range strings.SplitSeq(rule, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return r, fmt.Errorf("invalid rule part: %q", part)
+		}
+		if seen[name] {
+			return r, fmt.Errorf("duplicate rule part: %s", name)
+		}
+		seen[name] = true
+		var err error
+		switch name {
+		case "FREQ":
+			r.Freq = Frequency(value)
+			switch r.Freq {
+			case FrequencyDaily, FrequencyWeekly, FrequencyMonthly:
+			default:
+				err = errors.New("unsupported frequency")
+			}
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(value)
+			if err == nil && (r.Interval < 1 || r.Interval > MaxRecurrenceInterval) {
+				err = fmt.Errorf("must be between 1 and %d", MaxRecurrenceInterval)
+			}
+		case "BYDAY":
+			for code := range strings.SplitSeq(value, ",") {
+				i := slices.Index(weekdayCodes[:], code)
+				if i < 0 {
+					err = fmt.Errorf("unsupported weekday %q", code)
+					break
+				}
+				if !slices.Contains(r.Weekdays, time.Weekday(i)) {
+					r.Weekdays = append(r.Weekdays, time.Weekday(i))
+				}
+			}
+			slices.SortFunc(r.Weekdays, func(a, b time.Weekday) int {
+				return cmp.Compare(daysSinceMonday(a), daysSinceMonday(b))
+			})
+		case "BYMONTHDAY":
+			r.MonthDay, err = strconv.Atoi(value)
+			if err == nil && (r.MonthDay < 1 || r.MonthDay > 31) && r.MonthDay != -1 {
+				err = errors.New("must be between 1 and 31 or -1")
+			}
+		case "UNTIL":
+			r.Until, err = time.Parse(untilDateTimeFormat, value)
+			if err != nil {
+				r.Until, err = time.Parse(untilDateFormat, value)
+				r.UntilDate = err == nil
+			}
+		case "COUNT":
+			r.Count, err = strconv.Atoi(value)
+			if err == nil && r.Count < 1 {
+				err = errors.New("must be at least 1")
+			}
+		default:
+			err = errors.New("unsupported rule part")
+		}
+		if err != nil {
+			return r, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	switch {
+	case r.Freq == "":
+		return r, errors.New("missing FREQ")
+	case len(r.Weekdays) > 0 && r.Freq != FrequencyWeekly:
+		return r, errors.New("BYDAY is only supported for weekly rules")
+	case r.MonthDay != 0 && r.Freq != FrequencyMonthly:
+		return r, errors.New("BYMONTHDAY is only supported for monthly rules")
+	case !r.Until.IsZero() && r.Count != 0:
+		return r, errors.New("UNTIL and COUNT are mutually exclusive")
+	}
+	if r.Interval == 0 {
+		r.Interval = 1
+	}
+	return r, nil
+}
+
+// ValidateRecurrence checks that rule is accepted by ParseRecurrence.
+func ValidateRecurrence(rule string) ErrorValidation {
+	_, err := ParseRecurrence(rule)
+	return ErrorValidation{RecurrenceInvalid: err != nil}
+}
+
+// IsZero returns true for rules of todos that don't recur.
+func (r Recurrence) IsZero() bool { return r.Freq == "" }
+
+// String returns r in the RRULE form accepted by ParseRecurrence.
+func (r Recurrence) String() string {
+	if r.IsZero() {
+		return ""
+	}
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.Weekdays) > 0 {
+		codes := make([]string, len(r.Weekdays))
+		for i, d := range r.Weekdays {
+			codes[i] = weekdayCodes[d]
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if r.MonthDay != 0 {
+		parts = append(parts, "BYMONTHDAY="+strconv.Itoa(r.MonthDay))
+	}
+	switch {
+	case r.UntilDate:
+		parts = append(parts, "UNTIL="+r.Until.Format(untilDateFormat))
+	case !r.Until.IsZero():
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilDateTimeFormat))
+	}
+	if r.Count != 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the due time of the occurrence after the one due at due
+// and the rule of the next occurrence. Days are computed in loc so that
+// occurrences keep their wall clock time across daylight saving changes.
+// ok is false if the series ends with the occurrence due at due.
+func (r Recurrence) Next(
+	due time.Time, loc *time.Location,
+) (next time.Time, rest Recurrence, ok bool) {
+	if r.IsZero() || r.Count == 1 {
+		return time.Time{}, Recurrence{}, false
+	}
+	due = due.In(loc)
+	switch r.Freq {
+	case FrequencyDaily:
+		next = due.AddDate(0, 0, r.Interval)
+	case FrequencyWeekly:
+		next = r.nextWeekly(due)
+	case FrequencyMonthly:
+		if next, ok = r.nextMonthly(due); !ok {
+			return time.Time{}, Recurrence{}, false
+		}
+	}
+	if r.UntilDate {
+		y, m, d := next.Date()
+		if time.Date(y, m, d, 0, 0, 0, 0, time.UTC).After(r.Until) {
+			return time.Time{}, Recurrence{}, false
+		}
+	} else if !r.Until.IsZero() && next.After(r.Until) {
+		return time.Time{}, Recurrence{}, false
+	}
+	rest = r
+	if rest.Count > 0 {
+		rest.Count--
+	}
+	return next, rest, true
+}
+
+func (r Recurrence) nextWeekly(due time.Time) time.Time {
+	if len(r.Weekdays) == 0 {
+		return due.AddDate(0, 0, 7*r.Interval)
+	}
+	// Weeks start on Monday, every Interval-th week
+	// counted from the week of due is a week to repeat in.
+	day := daysSinceMonday(due.Weekday())
+	for _, d := range r.Weekdays {
+		if daysSinceMonday(d) > day {
+			return due.AddDate(0, 0, daysSinceMonday(d)-day) // Later this week.
+		}
+	}
+	// The first weekday of the next week to repeat in.
+	return due.AddDate(0, 0, 7*r.Interval-day+daysSinceMonday(r.Weekdays[0]))
+}
+
+func daysSinceMonday(d time.Weekday) int { return (int(d) + 6) % 7 }
+
+// gregorianCycleMonths is the number of months after which
+// the Gregorian calendar repeats, leap years included.
+const gregorianCycleMonths = 400 * 12
+
+// nextMonthly returns false if no month reachable
+// at the interval of r has the day, like the 31st of every February.
+func (r Recurrence) nextMonthly(due time.Time) (time.Time, bool) {
+	day := r.MonthDay
+	if day == 0 {
+		day = due.Day()
+	}
+	y, m, _ := due.Date()
+	// Reachable months repeat after a full cycle of the calendar.
+	for step := 0; step <= gregorianCycleMonths; step++ {
+		months := step * r.Interval
+		// The first of the month normalizes overflowing months.
+		first := time.Date(y, m+time.Month(months), 1,
+			due.Hour(), due.Minute(), due.Second(), 0, due.Location())
+		daysInMonth := first.AddDate(0, 1, -1).Day()
+		d := day
+		if d == -1 {
+			d = daysInMonth
+		}
+		if d > daysInMonth {
+			continue // Skip months without the day.
+		}
+		if next := first.AddDate(0, 0, d-1); next.After(due) {
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ErrSeriesEnded is returned by Todo.Skip when there's no next occurrence.
+var ErrSeriesEnded = errors.New("series ended")
+
+// Skip moves recurring todo t to its next occurrence computed in loc
+// and resets its checklist. Use it to mutate todos in Store.Edit.
+// Returns ErrSeriesEnded if t doesn't recur or was the last occurrence.
+func (t *Todo) Skip(loc *time.Location) error {
+	r, err := ParseRecurrence(t.Recurrence)
+	if err != nil {
+		return err
+	}
+	due := t.Due
+	if due.IsZero() {
+		due = time.Now()
+	}
+	next, rest, ok := r.Next(due, loc)
+	if !ok {
+		return ErrSeriesEnded
+	}
+	t.Due, t.Recurrence = next, rest.String()
+	t.Checklist = ResetChecklist(t.Checklist)
+	return nil
+}
+
+type ctxKeyLocation struct{}
+
+// WithLocation returns a copy of ctx carrying the time zone
+// the due times of recurring todos are computed in.
+func WithLocation(ctx context.Context, loc *time.Location) context.Context {
+	return context.WithValue(ctx, ctxKeyLocation{}, loc)
+}
+
+// LocationFrom returns the location set by WithLocation or time.Local.
+func LocationFrom(ctx context.Context) *time.Location {
+	if loc, ok := ctx.Value(ctxKeyLocation{}).(*time.Location); ok && loc != nil {
+		return loc
+	}
+	return time.Local
+}
+
+type ctxKeyNextOccurrence struct{}
+
+// WithNextOccurrence returns a copy of ctx in which Store.Edit sets *id
+// to the ID of the next occurrence it adds when a recurring todo is completed.
+// *id is left unchanged if no occurrence is added.
+func WithNextOccurrence(ctx context.Context, id *int64) context.Context {
+	return context.WithValue(ctx, ctxKeyNextOccurrence{}, id)
+}
+
+// setNextOccurrence reports the ID of the added next occurrence,
+// see WithNextOccurrence.
+func setNextOccurrence(ctx context.Context, id int64) {
+	if p, ok := ctx.Value(ctxKeyNextOccurrence{}).(*int64); ok && p != nil {
+		*p = id
+	}
+}
+
+// nextOccurrence returns the todo to add when before is completed into after
+// or nil if after isn't a recurring todo that was just completed
+// or its series ended. Todos without due date recur from now on.
+func nextOccurrence(ctx context.Context, before, after *Todo) *Todo {
+	if before.Status == StatusDone || after.Status != StatusDone ||
+		after.Recurrence == "" {
+		return nil
+	}
+	next := Todo{
+		Workspace:   after.Workspace,
+		Title:       after.Title,
+		Description: after.Description,
+		Created:     time.Now(),
+		Due:         after.Due,
+		Tags:        after.Tags,
+		Priority:    after.Priority,
+		Checklist:   after.Checklist,
+		Assignees:   after.Assignees,
+		Recurrence:  after.Recurrence,
+	}
+	if err := next.Skip(LocationFrom(ctx)); err != nil {
+		return nil
+	}
+	return &next
+}
@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// SortKey is the key search results are sorted by.
+// All keys are tie-broken by ascending ID.
+type SortKey string
+
+const (
+	// SortDefault is SortRelevance when matching text
+	// and SortManual otherwise.
+	SortDefault SortKey = ""
+
+	// SortManual orders todos by rank, see Store.Move.
+	SortManual SortKey = "manual"
+
+	// SortRelevance orders by text match relevance, best match first.
+	// All todos are equally relevant when not matching text.
+	SortRelevance SortKey = "relevance"
+
+	// SortCreated orders by creation time, oldest first.
+	SortCreated SortKey = "created"
+
+	// SortDue orders by due date, soonest first.
+	// Todos without a due date always come last.
+	SortDue SortKey = "due"
+
+	// SortTitle orders by title alphabetically, ignoring case.
+	SortTitle SortKey = "title"
+
+	// SortStatus orders open todos before done todos.
+	SortStatus SortKey = "status"
+
+	// SortPriority orders by priority, lowest first.
+	SortPriority SortKey = "priority"
+)
+
+// SortKeys lists all sort keys except SortDefault.
+var SortKeys = []SortKey{
+	SortManual, SortRelevance, SortCreated, SortDue,
+	SortTitle, SortStatus, SortPriority,
+}
+
+// Valid returns true if k is a known sort key.
+func (k SortKey) Valid() bool {
+	return k == SortDefault || slices.Contains(SortKeys, k)
+}
+
+// sortTodos sorts todos by the sort key and direction of filters.
+// scores are the text match relevance scores by todo ID.
+func sortTodos(todos []*Todo, filters SearchFilters, scores map[int64]float64) {
+	key := filters.Sort
+	if key == SortDefault {
+		key = SortManual
+		if scores != nil {
+			key = SortRelevance
+		}
+	}
+
+	var compare func(a, b *Todo) int
+	switch key {
+	case SortRelevance:
+		compare = func(a, b *Todo) int { return cmp.Compare(scores[b.ID], scores[a.ID]) }
+	case SortCreated:
+		compare = func(a, b *Todo) int { return a.Created.Compare(b.Created) }
+	case SortDue:
+		compare = func(a, b *Todo) int { return a.Due.Compare(b.Due) }
+	case SortTitle:
+		compare = func(a, b *Todo) int {
+			return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+		}
+	case SortStatus:
+		compare = func(a, b *Todo) int { return cmp.Compare(a.Status, b.Status) }
+	case SortPriority:
+		compare = func(a, b *Todo) int { return cmp.Compare(a.Priority, b.Priority) }
+	default:
+		compare = compareRanks
+	}
+
+	slices.SortFunc(todos, func(a, b *Todo) int {
+		if key == SortDue && a.Due.IsZero() != b.Due.IsZero() {
+			if a.Due.IsZero() {
+				return 1
+			}
+			return -1
+		}
+		c := compare(a, b)
+		if filters.SortDesc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
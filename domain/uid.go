@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+)
+
+// newUID returns a new RFC 9562 UUIDv7 string.
+// UUIDv7s are time-ordered and random enough to be exposed in URLs
+// and merged across store instances without collisions.
+func newUID() string {
+	var u [16]byte
+	binary.BigEndian.PutUint64(u[:8], uint64(time.Now().UnixMilli())<<16)
+	_, _ = rand.Read(u[6:]) // Never returns an error.
+	u[6] = u[6]&0x0f | 0x70 // Version 7.
+	u[8] = u[8]&0x3f | 0x80 // Variant 10.
+
+	var s [36]byte
+	hex.Encode(s[0:8], u[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], u[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], u[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], u[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], u[10:])
+	return string(s[:])
+}
@@ -0,0 +1,349 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	UserNameMaxLength = 32
+	PasswordMinLength = 8
+	PasswordMaxLength = 72 // bcrypt ignores the bytes after.
+)
+
+// ErrUserExists is returned by UserStore.AddUser
+// when the user name is already taken.
+var ErrUserExists = errors.New("user exists")
+
+// ErrInvalidCredentials is returned by UserStore.Authenticate
+// when there's no such user or the password doesn't match.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// UserStore is a user account repository.
+type UserStore interface {
+	// AddUser creates a new user with the fields of u
+	// and the given password and returns its ID.
+	// ID, PasswordHash and Created are set by the store.
+	// Returns ErrUserExists if the name is already taken.
+	AddUser(ctx context.Context, u User, password string) (id int64, err error)
+
+	// GetUser returns user id.
+	// Returns ErrNotExists if no such user exists.
+	GetUser(ctx context.Context, id int64) (*User, error)
+
+	// GetUserByName returns the user with the given name.
+	// Returns ErrNotExists if no such user exists.
+	GetUserByName(ctx context.Context, name string) (*User, error)
+
+	// Authenticate returns the user with the given name and password.
+	// Returns ErrInvalidCredentials if there's no such user
+	// or the password doesn't match.
+	Authenticate(ctx context.Context, name, password string) (*User, error)
+
+	// Users returns all users ordered by ID.
+	Users(ctx context.Context) ([]*User, error)
+
+	// CountUsers returns the number of users.
+	CountUsers(ctx context.Context) (int, error)
+
+	// ProvisionUser returns the user linked to the OpenID Connect subject
+	// of issuer and updates its display name and email from u.
+	// If there's no such user it's added with the fields of u
+	// and without a password so it can only log in through the issuer.
+	// u.Name is made valid and unique, see ValidateUser.
+	ProvisionUser(ctx context.Context, issuer, subject string, u User) (*User, error)
+}
+
+// User is an account that can log in.
+type User struct {
+	ID int64
+	// Name is the unique login name, see ValidateUser.
+	Name        string
+	DisplayName string
+	Email       string
+	Created     time.Time
+	// PasswordHash is the bcrypt hash of the password.
+	// It's empty for users that log in through OpenID Connect.
+	PasswordHash []byte `json:",omitempty"`
+	// Issuer and Subject identify the OpenID Connect account
+	// the user logs in with, see UserStore.ProvisionUser.
+	Issuer  string `json:",omitempty"`
+	Subject string `json:",omitempty"`
+}
+
+// DisplayNameOrName returns the display name of u or its login name
+// if it has none.
+func (u *User) DisplayNameOrName() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.Name
+}
+
+// ErrorValidationUser is returned by UserStore.AddUser for invalid users.
+type ErrorValidationUser struct {
+	NameInvalid     bool
+	PasswordTooWeak bool
+}
+
+// ValidateUser checks that name is at most UserNameMaxLength bytes long
+// and only consists of lower case letters, digits and any of "-_." and
+// that password is between PasswordMinLength and PasswordMaxLength bytes long.
+func ValidateUser(name, password string) ErrorValidationUser {
+	return ErrorValidationUser{
+		NameInvalid: name == "" || len(name) > UserNameMaxLength ||
+			strings.ContainsFunc(name, func(r rune) bool { return !validUserNameRune(r) }),
+		PasswordTooWeak: len(password) < PasswordMinLength || len(password) > PasswordMaxLength,
+	}
+}
+
+func validUserNameRune(r rune) bool {
+	return (unicode.IsLetter(r) && !unicode.IsUpper(r)) ||
+		unicode.IsDigit(r) || strings.ContainsRune("-_.", r)
+}
+
+// userName turns s into a valid user name, see ValidateUser,
+// by lower casing it and dropping invalid characters.
+// Returns "user" if nothing is left.
+func userName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r = unicode.ToLower(r); validUserNameRune(r) {
+			return r
+		}
+		return -1
+	}, s)
+	if s = truncate(s, UserNameMaxLength); s == "" {
+		return "user"
+	}
+	return s
+}
+
+// truncate cuts s to at most n bytes without splitting runes.
+func truncate(s string, n int) string {
+	for len(s) > n {
+		_, size := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-size]
+	}
+	return s
+}
+
+func (v ErrorValidationUser) IsErr() bool { return v.NameInvalid || v.PasswordTooWeak }
+
+func (v ErrorValidationUser) Error() string { return "invalid user" }
+
+type ctxKeyUser struct{}
+
+// WithUser returns a copy of ctx carrying the logged in user u.
+// u is also the actor of all mutations made with it, see WithActor.
+func WithUser(ctx context.Context, u *User) context.Context {
+	ctx = WithActor(ctx, u.Name)
+	return context.WithValue(ctx, ctxKeyUser{}, u)
+}
+
+// UserFrom returns the user set by WithUser or nil if there is none.
+func UserFrom(ctx context.Context) *User {
+	u, _ := ctx.Value(ctxKeyUser{}).(*User)
+	return u
+}
+
+// MemUsers is a UserStore keeping all users in memory.
+// It's optionally persisted to a JSON file, see OpenUsers.
+type MemUsers struct {
+	lock  sync.Mutex
+	users []*User
+	path  string // "" for in-memory stores.
+}
+
+var _ UserStore = new(MemUsers)
+
+// NewUsers creates a new in-memory user store.
+func NewUsers() *MemUsers { return new(MemUsers) }
+
+// OpenUsers opens the user store persisted in the file at path
+// which is created on the first added user.
+func OpenUsers(path string) (*MemUsers, error) {
+	s := &MemUsers{path: path}
+	if err := readJSONFile(path, &s.users); err != nil {
+		return nil, fmt.Errorf("reading users: %w", err)
+	}
+	return s, nil
+}
+
+func (s *MemUsers) AddUser(
+	_ context.Context, u User, password string,
+) (id int64, err error) {
+	if err := ValidateUser(u.Name, password); err.IsErr() {
+		return 0, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, fmt.Errorf("hashing password: %w", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.nameTaken(u.Name) {
+		return 0, ErrUserExists
+	}
+	u.ID, u.PasswordHash, u.Created = int64(len(s.users)+1), hash, time.Now()
+	s.users = append(s.users, &u)
+	if err := s.save(); err != nil {
+		s.users = s.users[:len(s.users)-1]
+		return 0, err
+	}
+	return u.ID, nil
+}
+
+func (s *MemUsers) nameTaken(name string) bool {
+	return slices.ContainsFunc(s.users, func(u *User) bool { return u.Name == name })
+}
+
+// save writes all users to the file of the store.
+func (s *MemUsers) save() error {
+	if s.path == "" {
+		return nil
+	}
+	b, err := json.Marshal(s.users)
+	if err != nil {
+		return fmt.Errorf("encoding users: %w", err)
+	}
+	if err := writeFileAtomic(s.path, b); err != nil {
+		return fmt.Errorf("writing users: %w", err)
+	}
+	return nil
+}
+
+// readJSONFile decodes the JSON file at path into v.
+// v is left untouched if the file doesn't exist.
+func readJSONFile(path string, v any) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func (s *MemUsers) GetUser(_ context.Context, id int64) (*User, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i := slices.IndexFunc(s.users, func(u *User) bool { return u.ID == id })
+	if i < 0 {
+		return nil, ErrNotExists
+	}
+	u := *s.users[i]
+	return &u, nil
+}
+
+func (s *MemUsers) GetUserByName(_ context.Context, name string) (*User, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i := slices.IndexFunc(s.users, func(u *User) bool { return u.Name == name })
+	if i < 0 {
+		return nil, ErrNotExists
+	}
+	u := *s.users[i]
+	return &u, nil
+}
+
+func (s *MemUsers) Authenticate(
+	_ context.Context, name, password string,
+) (*User, error) {
+	s.lock.Lock()
+	i := slices.IndexFunc(s.users, func(u *User) bool { return u.Name == name })
+	var u User
+	if i >= 0 {
+		u = *s.users[i]
+	}
+	s.lock.Unlock()
+
+	if i < 0 {
+		// Take as long as for existing users to not reveal which exist.
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &u, nil
+}
+
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword(
+	[]byte("dummy password"), bcrypt.DefaultCost,
+)
+
+func (s *MemUsers) ProvisionUser(
+	_ context.Context, issuer, subject string, u User,
+) (*User, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i := slices.IndexFunc(s.users, func(x *User) bool {
+		return x.Issuer == issuer && x.Subject == subject
+	})
+	if i >= 0 {
+		existing := s.users[i]
+		if existing.DisplayName != u.DisplayName || existing.Email != u.Email {
+			updated := *existing
+			updated.DisplayName, updated.Email = u.DisplayName, u.Email
+			s.users[i] = &updated
+			if err := s.save(); err != nil {
+				s.users[i] = existing
+				return nil, err
+			}
+		}
+		c := *s.users[i]
+		return &c, nil
+	}
+
+	base := userName(u.Name)
+	u.Name = base
+	for n := 2; s.nameTaken(u.Name); n++ {
+		suffix := strconv.Itoa(n)
+		u.Name = truncate(base, UserNameMaxLength-len(suffix)) + suffix
+	}
+	u.ID, u.Created = int64(len(s.users)+1), time.Now()
+	u.PasswordHash, u.Issuer, u.Subject = nil, issuer, subject
+	s.users = append(s.users, &u)
+	if err := s.save(); err != nil {
+		s.users = s.users[:len(s.users)-1]
+		return nil, err
+	}
+	c := u
+	return &c, nil
+}
+
+func (s *MemUsers) Users(context.Context) ([]*User, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	l := make([]*User, len(s.users))
+	for i, u := range s.users {
+		c := *u
+		l[i] = &c
+	}
+	return l, nil
+}
+
+func (s *MemUsers) CountUsers(context.Context) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.users), nil
+}
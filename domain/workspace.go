@@ -0,0 +1,266 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const WorkspaceNameMaxLength = 64
+
+// ErrLastAdmin is returned by WorkspaceStore.SetRole
+// when the last admin of a workspace would be demoted or removed.
+var ErrLastAdmin = errors.New("workspace must keep an admin")
+
+// WorkspaceStore is a repository of workspaces and their members.
+// Every todo belongs to one workspace, see Todo.Workspace.
+type WorkspaceStore interface {
+	// AddWorkspace creates a new workspace with admin as its only member
+	// and returns its ID. Returns ErrorValidationWorkspace for invalid names.
+	AddWorkspace(ctx context.Context, name string, admin int64) (id int64, err error)
+
+	// GetWorkspace returns workspace id.
+	// Returns ErrNotExists if no such workspace exists.
+	GetWorkspace(ctx context.Context, id int64) (*Workspace, error)
+
+	// Workspaces returns the workspaces user is a member of ordered by ID.
+	Workspaces(ctx context.Context, user int64) ([]*Workspace, error)
+
+	// SetRole sets the role of user in workspace id.
+	// RoleNone removes user from the workspace.
+	// Returns ErrLastAdmin if the workspace would be left without an admin
+	// and ErrNotExists if no such workspace exists.
+	SetRole(ctx context.Context, id, user int64, role Role) error
+}
+
+// Role is the role of a member of a workspace.
+// Roles are ordered, every role is allowed everything lower roles are.
+type Role int8
+
+const (
+	RoleNone Role = iota
+	// RoleViewer can see the todos of the workspace.
+	RoleViewer
+	// RoleEditor can add, edit and delete todos.
+	RoleEditor
+	// RoleAdmin can manage members and permanently delete todos.
+	RoleAdmin
+)
+
+// Roles lists all roles of members from lowest to highest.
+var Roles = []Role{RoleViewer, RoleEditor, RoleAdmin}
+
+func (r Role) String() string {
+	switch r {
+	case RoleNone:
+		return "none"
+	case RoleViewer:
+		return "viewer"
+	case RoleEditor:
+		return "editor"
+	case RoleAdmin:
+		return "admin"
+	}
+	return "unknown"
+}
+
+// ParseRole parses the string representation of a role.
+func ParseRole(s string) (Role, error) {
+	for _, r := range append([]Role{RoleNone}, Roles...) {
+		if r.String() == s {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid role: %q", s)
+}
+
+// Workspace is a shared list of todos.
+type Workspace struct {
+	ID      int64
+	Name    string
+	Created time.Time
+	// Members maps user IDs to their role.
+	Members map[int64]Role
+}
+
+// Role returns the role of user in w or RoleNone if user isn't a member.
+func (w *Workspace) Role(user int64) Role { return w.Members[user] }
+
+// admins returns the number of admins of w.
+func (w *Workspace) admins() (n int) {
+	for _, r := range w.Members {
+		if r == RoleAdmin {
+			n++
+		}
+	}
+	return n
+}
+
+func (w *Workspace) clone() *Workspace {
+	c := *w
+	c.Members = maps.Clone(w.Members)
+	return &c
+}
+
+// ErrorValidationWorkspace is returned for invalid workspace names.
+type ErrorValidationWorkspace struct {
+	NameEmpty   bool
+	NameTooLong bool
+}
+
+// ValidateWorkspaceName checks that name isn't blank
+// and at most WorkspaceNameMaxLength bytes long.
+func ValidateWorkspaceName(name string) ErrorValidationWorkspace {
+	return ErrorValidationWorkspace{
+		NameEmpty:   strings.TrimSpace(name) == "",
+		NameTooLong: len(name) > WorkspaceNameMaxLength,
+	}
+}
+
+func (v ErrorValidationWorkspace) IsErr() bool { return v.NameEmpty || v.NameTooLong }
+
+func (v ErrorValidationWorkspace) Error() string { return "invalid workspace" }
+
+type ctxKeyWorkspace struct{}
+
+// WithWorkspace returns a copy of ctx carrying the workspace being viewed.
+func WithWorkspace(ctx context.Context, w *Workspace) context.Context {
+	return context.WithValue(ctx, ctxKeyWorkspace{}, w)
+}
+
+// WorkspaceFrom returns the workspace set by WithWorkspace
+// or nil if there is none.
+func WorkspaceFrom(ctx context.Context) *Workspace {
+	w, _ := ctx.Value(ctxKeyWorkspace{}).(*Workspace)
+	return w
+}
+
+// MemWorkspaces is a WorkspaceStore keeping all workspaces in memory.
+// It's optionally persisted to a JSON file, see OpenWorkspaces.
+type MemWorkspaces struct {
+	lock       sync.Mutex
+	workspaces []*Workspace
+	path       string // "" for in-memory stores.
+}
+
+var _ WorkspaceStore = new(MemWorkspaces)
+
+// NewWorkspaces creates a new in-memory workspace store.
+func NewWorkspaces() *MemWorkspaces { return new(MemWorkspaces) }
+
+// OpenWorkspaces opens the workspace store persisted in the file at path
+// which is created on the first added workspace.
+func OpenWorkspaces(path string) (*MemWorkspaces, error) {
+	s := &MemWorkspaces{path: path}
+	if err := readJSONFile(path, &s.workspaces); err != nil {
+		return nil, fmt.Errorf("reading workspaces: %w", err)
+	}
+	return s, nil
+}
+
+// save writes all workspaces to the file of the store.
+func (s *MemWorkspaces) save() error {
+	if s.path == "" {
+		return nil
+	}
+	b, err := json.Marshal(s.workspaces)
+	if err != nil {
+		return fmt.Errorf("encoding workspaces: %w", err)
+	}
+	if err := writeFileAtomic(s.path, b); err != nil {
+		return fmt.Errorf("writing workspaces: %w", err)
+	}
+	return nil
+}
+
+func (s *MemWorkspaces) AddWorkspace(
+	_ context.Context, name string, admin int64,
+) (id int64, err error) {
+	if err := ValidateWorkspaceName(name); err.IsErr() {
+		return 0, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	w := &Workspace{
+		ID:      int64(len(s.workspaces) + 1),
+		Name:    strings.TrimSpace(name),
+		Created: time.Now(),
+		Members: map[int64]Role{admin: RoleAdmin},
+	}
+	s.workspaces = append(s.workspaces, w)
+	if err := s.save(); err != nil {
+		s.workspaces = s.workspaces[:len(s.workspaces)-1]
+		return 0, err
+	}
+	return w.ID, nil
+}
+
+func (s *MemWorkspaces) find(id int64) (*Workspace, error) {
+	i := slices.IndexFunc(s.workspaces, func(w *Workspace) bool { return w.ID == id })
+	if i < 0 {
+		return nil, ErrNotExists
+	}
+	return s.workspaces[i], nil
+}
+
+func (s *MemWorkspaces) GetWorkspace(_ context.Context, id int64) (*Workspace, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	w, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+	return w.clone(), nil
+}
+
+func (s *MemWorkspaces) Workspaces(_ context.Context, user int64) ([]*Workspace, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var l []*Workspace
+	for _, w := range s.workspaces {
+		if w.Role(user) != RoleNone {
+			l = append(l, w.clone())
+		}
+	}
+	return l, nil
+}
+
+func (s *MemWorkspaces) SetRole(_ context.Context, id, user int64, role Role) error {
+	if role < RoleNone || role > RoleAdmin {
+		return fmt.Errorf("invalid role: %d", role)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	w, err := s.find(id)
+	if err != nil {
+		return err
+	}
+	updated := w.clone()
+	if role == RoleNone {
+		delete(updated.Members, user)
+	} else {
+		updated.Members[user] = role
+	}
+	if w.Role(user) == RoleAdmin && updated.admins() == 0 {
+		return ErrLastAdmin
+	}
+	i := slices.Index(s.workspaces, w)
+	s.workspaces[i] = updated
+	if err := s.save(); err != nil {
+		s.workspaces[i] = w
+		return err
+	}
+	return nil
+}
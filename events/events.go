@@ -1,19 +1,336 @@
 package events
 
-import "github.com/romshark/todostar/pkg/broadcast"
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"time"
 
-type EventTodosChanged struct{}
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/pkg/broadcast"
+)
+
+// TodoChange is the kind of change to todos.
+type TodoChange int8
+
+const (
+	// TodoChangeUnknown means that any todo may have changed in any way.
+	TodoChangeUnknown TodoChange = iota
+	TodoCreated
+	TodoUpdated
+	TodoArchived
+	// TodoRestored means a todo was restored from the archive or the trash.
+	TodoRestored
+	// TodoDeleted means a todo was moved to the trash.
+	TodoDeleted
+	// TodoPurged means todos were permanently deleted from the trash.
+	TodoPurged
+)
+
+func (c TodoChange) String() string {
+	switch c {
+	case TodoCreated:
+		return "created"
+	case TodoUpdated:
+		return "updated"
+	case TodoArchived:
+		return "archived"
+	case TodoRestored:
+		return "restored"
+	case TodoDeleted:
+		return "deleted"
+	case TodoPurged:
+		return "purged"
+	}
+	return "unknown"
+}
+
+// ChangeOf returns the kind of change of a todo from before to after
+// where before is nil for a created todo and after for a purged one.
+func ChangeOf(before, after *domain.Todo) TodoChange {
+	switch {
+	case before == nil && after == nil:
+		return TodoChangeUnknown
+	case before == nil:
+		return TodoCreated
+	case after == nil:
+		return TodoPurged
+	case !before.InTrash() && after.InTrash():
+		return TodoDeleted
+	case before.InTrash() && !after.InTrash(), before.Archived && !after.Archived:
+		return TodoRestored
+	case !before.Archived && after.Archived:
+		return TodoArchived
+	}
+	return TodoUpdated
+}
+
+// EventTodosChanged notifies the clients viewing a workspace
+// about changes to its todos.
+type EventTodosChanged struct {
+	// Seq is the sequence number of the event. It increases with every
+	// EventTodosChanged so subscribers can order events, which are
+	// delivered concurrently, see broadcast.Notify.
+	Seq uint64
+	// Workspace is the ID of the changed workspace, 0 for all workspaces.
+	Workspace int64
+	Kind      TodoChange
+	// IDs are the IDs of the changed todos, nil if Kind is unknown.
+	IDs []int64
+	// Before and After are snapshots of the todo right before and after
+	// the change if a single todo changed. Before is nil for a created todo
+	// and After for a purged one. They must not be modified.
+	Before, After *domain.Todo
+	// Actor is the actor who made the change, see domain.WithActor.
+	Actor string
+}
 
 func (EventTodosChanged) Topic() int64 { return 1 }
 
+// Unknown returns true if it's unknown which todos changed
+// and views must be rendered anew.
+func (e EventTodosChanged) Unknown() bool { return e.Kind == TodoChangeUnknown }
+
 var Broadcaster = broadcast.NewTopicBroadcaster()
 
-func NotifyTodosChanged() int {
-	return broadcast.Notify(Broadcaster, EventTodosChanged{})
+var todosSeq atomic.Uint64
+
+func notifyTodos(e EventTodosChanged) int {
+	e.Seq = todosSeq.Add(1)
+	n := broadcast.Notify(Broadcaster, e)
+	todosNotified.Add(int64(n))
+	return n
+}
+
+// notifyTodo notifies about a change of kind to a single todo.
+func notifyTodo(ctx context.Context, kind TodoChange, before, after *domain.Todo) int {
+	t := after
+	if t == nil {
+		t = before
+	}
+	return notifyTodos(EventTodosChanged{
+		Workspace: t.Workspace,
+		Kind:      kind,
+		IDs:       []int64{t.ID},
+		Before:    before,
+		After:     after,
+		Actor:     domain.ActorFrom(ctx),
+	})
+}
+
+// NotifyTodosChanged notifies about unknown changes to the todos
+// of workspace, see EventTodosChanged.Unknown.
+func NotifyTodosChanged(workspace int64) int {
+	return notifyTodos(EventTodosChanged{Workspace: workspace})
+}
+
+// NotifyTodoChanged notifies about the change of a todo from before
+// to after of the kind returned by ChangeOf.
+// Either of them must not be nil.
+func NotifyTodoChanged(ctx context.Context, before, after *domain.Todo) int {
+	return notifyTodo(ctx, ChangeOf(before, after), before, after)
+}
+
+func NotifyTodoCreated(ctx context.Context, t *domain.Todo) int {
+	return notifyTodo(ctx, TodoCreated, nil, t)
+}
+
+func NotifyTodoUpdated(ctx context.Context, before, after *domain.Todo) int {
+	return notifyTodo(ctx, TodoUpdated, before, after)
+}
+
+func NotifyTodoArchived(ctx context.Context, before, after *domain.Todo) int {
+	return notifyTodo(ctx, TodoArchived, before, after)
+}
+
+func NotifyTodoRestored(ctx context.Context, before, after *domain.Todo) int {
+	return notifyTodo(ctx, TodoRestored, before, after)
+}
+
+func NotifyTodoDeleted(ctx context.Context, before, after *domain.Todo) int {
+	return notifyTodo(ctx, TodoDeleted, before, after)
+}
+
+// NotifyTodosPurged notifies about todos ids permanently deleted
+// from the trash of workspace.
+func NotifyTodosPurged(ctx context.Context, workspace int64, ids ...int64) int {
+	return notifyTodos(EventTodosChanged{
+		Workspace: workspace,
+		Kind:      TodoPurged,
+		IDs:       ids,
+		Actor:     domain.ActorFrom(ctx),
+	})
+}
+
+// Merge returns e merged with the later event l as if they were one change.
+// The kind of the merged event is derived from the snapshots if both
+// are about the same single todo. Otherwise it's the kind of both
+// if they're equal or TodoUpdated if not. Events of different workspaces
+// and unknown events merge into an unknown event for all workspaces.
+func (e EventTodosChanged) Merge(l EventTodosChanged) EventTodosChanged {
+	m := EventTodosChanged{Seq: max(e.Seq, l.Seq), Workspace: e.Workspace}
+	if e.Unknown() || l.Unknown() || e.Workspace != l.Workspace {
+		m.Workspace = 0
+		return m
+	}
+	if e.Actor == l.Actor {
+		m.Actor = e.Actor
+	}
+	m.IDs = slices.Clone(e.IDs)
+	for _, id := range l.IDs {
+		if !slices.Contains(m.IDs, id) {
+			m.IDs = append(m.IDs, id)
+		}
+	}
+	switch {
+	case len(m.IDs) == 1 && (e.Before != nil || l.After != nil):
+		m.Before, m.After = e.Before, l.After
+		m.Kind = ChangeOf(m.Before, m.After)
+	case e.Kind == l.Kind:
+		m.Kind = e.Kind
+	default:
+		m.Kind = TodoUpdated
+	}
+	return m
+}
+
+// todosBuffer is the number of events buffered per subscriber
+// before they're merged, see OnTodosChanged.
+const todosBuffer = 64
+
+// Metrics of EventTodosChanged, see TodosMetrics.
+var todosNotified, todosMerged, todosIgnored, todosDelivered atomic.Int64
+
+// TodosMetrics are counters of EventTodosChanged.
+// All of them count per subscriber, an event notified to two subscribers
+// counts twice. Every notified event is eventually either merged,
+// ignored or delivered.
+type TodosMetrics struct {
+	// Notified is the number of events notified to subscribers.
+	Notified int64
+	// Merged is the number of events merged into earlier ones
+	// instead of being delivered to a subscriber on their own.
+	Merged int64
+	// Ignored is the number of events ignored by subscribers
+	// of other workspaces.
+	Ignored int64
+	// Delivered is the number of callbacks called by OnTodosChanged.
+	Delivered int64
 }
 
+// Metrics returns the counters of EventTodosChanged since startup.
+func Metrics() TodosMetrics {
+	return TodosMetrics{
+		Notified:  todosNotified.Load(),
+		Merged:    todosMerged.Load(),
+		Ignored:   todosIgnored.Load(),
+		Delivered: todosDelivered.Load(),
+	}
+}
+
+// OnTodosChanged calls callback for changes to the todos of workspace,
+// one event at a time and in order. Events arriving within window
+// after an event are merged into it, see EventTodosChanged.Merge,
+// so bursts of changes cause a single call.
+// The last event of a burst is always delivered at the end of the window.
 func OnTodosChanged(
-	callback func(EventTodosChanged),
+	workspace int64, window time.Duration, callback func(EventTodosChanged),
 ) broadcast.Subscription[EventTodosChanged] {
+	sub := broadcast.SubscribeChan(Broadcaster, broadcast.ChanOptions[EventTodosChanged]{
+		Buffer:   todosBuffer,
+		Overflow: broadcast.Coalesce,
+		Merge:    mergeTodos,
+	})
+	go func() {
+		for e := range sub.C() {
+			if e.Workspace != 0 && e.Workspace != workspace {
+				todosIgnored.Add(1)
+				continue
+			}
+			if window > 0 {
+				var ok bool
+				if e, ok = collectTodos(sub.C(), workspace, window, e); !ok {
+					return // Closed.
+				}
+			}
+			todosDelivered.Add(1)
+			callback(e)
+		}
+	}()
+	return sub
+}
+
+// collectTodos merges the events of workspace received from c
+// within window into e. Returns false if c was closed.
+func collectTodos(
+	c <-chan EventTodosChanged, workspace int64, window time.Duration,
+	e EventTodosChanged,
+) (EventTodosChanged, bool) {
+	t := time.NewTimer(window)
+	defer t.Stop()
+	for {
+		select {
+		case next, ok := <-c:
+			if !ok {
+				return e, false
+			}
+			if next.Workspace == 0 || next.Workspace == workspace {
+				e = mergeTodos(e, next)
+			} else {
+				todosIgnored.Add(1)
+			}
+		case <-t.C:
+			return e, true
+		}
+	}
+}
+
+func mergeTodos(e, l EventTodosChanged) EventTodosChanged {
+	todosMerged.Add(1)
+	return e.Merge(l)
+}
+
+// EventCommentsChanged notifies the clients viewing a workspace
+// about changes to the comments on one of its todos.
+type EventCommentsChanged struct {
+	Workspace int64
+	TodoID    int64
+}
+
+func (EventCommentsChanged) Topic() int64 { return 3 }
+
+func NotifyCommentsChanged(workspace, todoID int64) int {
+	return broadcast.Notify(Broadcaster, EventCommentsChanged{
+		Workspace: workspace, TodoID: todoID,
+	})
+}
+
+// OnCommentsChanged calls callback for changes to the comments
+// on todos of workspace.
+func OnCommentsChanged(
+	workspace int64, callback func(EventCommentsChanged),
+) broadcast.Subscription[EventCommentsChanged] {
+	return broadcast.Subscribe(Broadcaster, func(e EventCommentsChanged) {
+		if e.Workspace == workspace {
+			callback(e)
+		}
+	})
+}
+
+// EventUndo notifies a single session about a change of its undo stack.
+type EventUndo struct {
+	Session string
+	Message string
+	// CanUndo and CanRedo are true if the change can be undone or redone.
+	CanUndo, CanRedo bool
+}
+
+func (EventUndo) Topic() int64 { return 2 }
+
+func NotifyUndo(e EventUndo) int {
+	return broadcast.Notify(Broadcaster, e)
+}
+
+func OnUndo(callback func(EventUndo)) broadcast.Subscription[EventUndo] {
 	return broadcast.Subscribe(Broadcaster, callback)
 }
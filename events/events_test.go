@@ -0,0 +1,179 @@
+package events_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/events"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeOf(t *testing.T) {
+	open := &domain.Todo{ID: 1}
+	archived := &domain.Todo{ID: 1, Archived: true}
+	trashed := &domain.Todo{ID: 1, Trashed: time.Now()}
+	for _, td := range []struct {
+		name          string
+		before, after *domain.Todo
+		expect        events.TodoChange
+	}{
+		{"unknown", nil, nil, events.TodoChangeUnknown},
+		{"created", nil, open, events.TodoCreated},
+		{"purged", trashed, nil, events.TodoPurged},
+		{"updated", open, &domain.Todo{ID: 1, Title: "x"}, events.TodoUpdated},
+		{"archived", open, archived, events.TodoArchived},
+		{"deleted", open, trashed, events.TodoDeleted},
+		{"deleted from archive", archived, &domain.Todo{
+			ID: 1, Archived: true, Trashed: time.Now(),
+		}, events.TodoDeleted},
+		{"restored from archive", archived, open, events.TodoRestored},
+		{"restored from trash", trashed, open, events.TodoRestored},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			require.Equal(t, td.expect, events.ChangeOf(td.before, td.after))
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	v1 := &domain.Todo{ID: 1, Workspace: 1, Version: 1}
+	v2 := &domain.Todo{ID: 1, Workspace: 1, Version: 2}
+	v3 := &domain.Todo{ID: 1, Workspace: 1, Version: 3, Archived: true}
+	single := func(
+		seq uint64, kind events.TodoChange, before, after *domain.Todo,
+	) events.EventTodosChanged {
+		return events.EventTodosChanged{
+			Seq: seq, Workspace: 1, Kind: kind, IDs: []int64{1},
+			Before: before, After: after, Actor: "alice",
+		}
+	}
+	for _, td := range []struct {
+		name   string
+		e, l   events.EventTodosChanged
+		expect events.EventTodosChanged
+	}{
+		{
+			name:   "updated then archived",
+			e:      single(1, events.TodoUpdated, v1, v2),
+			l:      single(2, events.TodoArchived, v2, v3),
+			expect: single(2, events.TodoArchived, v1, v3),
+		},
+		{
+			name:   "created then updated",
+			e:      single(1, events.TodoCreated, nil, v1),
+			l:      single(2, events.TodoUpdated, v1, v2),
+			expect: single(2, events.TodoCreated, nil, v2),
+		},
+		{
+			name: "other todo of same kind",
+			e: events.EventTodosChanged{
+				Seq: 1, Workspace: 1, Kind: events.TodoDeleted, IDs: []int64{1},
+				Before: v1, After: v2, Actor: "alice",
+			},
+			l: events.EventTodosChanged{
+				Seq: 2, Workspace: 1, Kind: events.TodoDeleted, IDs: []int64{2},
+				Actor: "bob",
+			},
+			expect: events.EventTodosChanged{
+				Seq: 2, Workspace: 1, Kind: events.TodoDeleted, IDs: []int64{1, 2},
+			},
+		},
+		{
+			name: "other todo of other kind",
+			e: events.EventTodosChanged{
+				Seq: 3, Workspace: 1, Kind: events.TodoCreated, IDs: []int64{1},
+			},
+			l: events.EventTodosChanged{
+				Seq: 2, Workspace: 1, Kind: events.TodoPurged, IDs: []int64{1, 2},
+			},
+			expect: events.EventTodosChanged{
+				Seq: 3, Workspace: 1, Kind: events.TodoUpdated, IDs: []int64{1, 2},
+			},
+		},
+		{
+			name:   "unknown",
+			e:      single(1, events.TodoUpdated, v1, v2),
+			l:      events.EventTodosChanged{Seq: 2, Workspace: 1},
+			expect: events.EventTodosChanged{Seq: 2},
+		},
+		{
+			name: "other workspace",
+			e:    single(1, events.TodoUpdated, v1, v2),
+			l: events.EventTodosChanged{
+				Seq: 2, Workspace: 2, Kind: events.TodoUpdated, IDs: []int64{5},
+			},
+			expect: events.EventTodosChanged{Seq: 2},
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			require.Equal(t, td.expect, td.e.Merge(td.l))
+		})
+	}
+}
+
+func TestOnTodosChangedWindow(t *testing.T) {
+	const workspace, other = 101, 102
+	before := events.Metrics()
+
+	received := make(chan events.EventTodosChanged, 16)
+	sub := events.OnTodosChanged(workspace, 100*time.Millisecond,
+		func(e events.EventTodosChanged) { received <- e })
+	defer sub.Close()
+
+	ctx := domain.WithActor(t.Context(), "alice")
+	todo := func(version int64) *domain.Todo {
+		return &domain.Todo{ID: 1, Workspace: workspace, Version: version}
+	}
+	for v := range int64(5) {
+		require.Equal(t, 1, events.NotifyTodoUpdated(ctx, todo(v+1), todo(v+2)))
+	}
+	events.NotifyTodoCreated(ctx, &domain.Todo{ID: 2, Workspace: other})
+
+	// The burst is delivered once at the end of the window in its final state.
+	select {
+	case e := <-received:
+		require.Equal(t, events.TodoUpdated, e.Kind)
+		require.Equal(t, int64(workspace), e.Workspace)
+		require.Equal(t, []int64{1}, e.IDs)
+		require.Equal(t, todo(1), e.Before)
+		require.Equal(t, todo(6), e.After)
+		require.Equal(t, "alice", e.Actor)
+	case <-time.After(time.Second):
+		t.Fatal("burst not delivered")
+	}
+	select {
+	case e := <-received:
+		t.Fatalf("unexpected event: %#v", e)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	after := events.Metrics()
+	require.Equal(t, int64(6), after.Notified-before.Notified)
+	require.Equal(t, int64(4), after.Merged-before.Merged)
+	require.Equal(t, int64(1), after.Ignored-before.Ignored)
+	require.Equal(t, int64(1), after.Delivered-before.Delivered)
+}
+
+func TestOnTodosChangedNoWindow(t *testing.T) {
+	const workspace = 103
+	received := make(chan events.EventTodosChanged, 16)
+	sub := events.OnTodosChanged(workspace, 0,
+		func(e events.EventTodosChanged) { received <- e })
+	defer sub.Close()
+
+	for range 3 {
+		events.NotifyTodosChanged(workspace)
+	}
+	var last uint64
+	for range 3 {
+		select {
+		case e := <-received:
+			require.True(t, e.Unknown())
+			require.Greater(t, e.Seq, last, "in order")
+			last = e.Seq
+		case <-time.After(time.Second):
+			t.Fatal("event not delivered")
+		}
+	}
+}
@@ -6,8 +6,13 @@ require (
 	github.com/a-h/templ v0.3.943
 	github.com/andybalholm/brotli v1.2.0
 	github.com/blevesearch/bleve/v2 v2.5.3
+	github.com/coreos/go-oidc/v3 v3.18.0
+	github.com/go-jose/go-jose/v4 v4.1.4
 	github.com/starfederation/datastar-go v1.0.1
 	github.com/stretchr/testify v1.10.0
+	go.etcd.io/bbolt v1.4.2
+	golang.org/x/crypto v0.41.0
+	golang.org/x/oauth2 v0.36.0
 )
 
 require (
@@ -43,7 +48,6 @@ require (
 	github.com/pmezard/go-difflib v1.0.1-0.20181226105442-5d4384ee4fb2 // indirect
 	github.com/rogpeppe/go-internal v1.11.0 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
-	go.etcd.io/bbolt v1.4.2 // indirect
 	golang.org/x/sys v0.35.0 // indirect
 	google.golang.org/protobuf v1.36.7 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
@@ -3,6 +3,7 @@ package broadcast
 import (
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 var idCounter atomic.Int64
@@ -46,11 +47,21 @@ func (s Subscription[T]) Close() {
 			delete(s.b.topics, topic)
 		}
 	}
-	if c, ok := s.c.(chan T); ok {
-		close(c)
+	if c, ok := s.c.(*chanSubscriber[T]); ok {
+		close(c.c)
 	}
 }
 
+// C returns the channel events are delivered to
+// or nil if the subscription isn't a channel subscription, see SubscribeChan.
+// The channel is closed when the subscription is closed.
+func (s Subscription[T]) C() <-chan T {
+	if c, ok := s.c.(*chanSubscriber[T]); ok {
+		return c.c
+	}
+	return nil
+}
+
 // Subscribe creates a new subscription for T and calls callback when it's triggered.
 func Subscribe[T Event](b *TopicBroadcaster, callback func(T)) Subscription[T] {
 	return subscribe[T](b, callback)
@@ -71,7 +82,123 @@ func subscribe[T Event](b *TopicBroadcaster, c any) Subscription[T] {
 	return Subscription[T]{b: b, id: id, c: c}
 }
 
+// Overflow is what a channel subscription does with an event
+// when its buffer is full, see SubscribeChan.
+type Overflow int8
+
+const (
+	// DropOldest discards the oldest buffered event to make room.
+	DropOldest Overflow = iota
+
+	// DropNewest discards the event.
+	DropNewest
+
+	// Coalesce merges all buffered events and the event into one
+	// using ChanOptions.Merge.
+	Coalesce
+
+	// Block waits at most ChanOptions.Timeout for room and discards
+	// the event after that. Notify for any topic waits meanwhile.
+	Block
+)
+
+// ChanOptions configures a channel subscription, see SubscribeChan.
+type ChanOptions[T Event] struct {
+	// Buffer is the number of events buffered until the subscriber
+	// receives them. Values smaller than 1 are 1.
+	Buffer   int
+	Overflow Overflow
+
+	// Merge merges event into the earlier event acc.
+	// It's required for Coalesce.
+	Merge func(acc, event T) T
+
+	// Timeout is how long Block waits for room.
+	Timeout time.Duration
+}
+
+// SubscribeChan creates a new subscription for T delivering events
+// to the channel returned by Subscription.C in the order they're notified.
+// A full buffer is handled as configured by opts.Overflow.
+// Panics if opts.Overflow is Coalesce and opts.Merge is nil.
+func SubscribeChan[T Event](b *TopicBroadcaster, opts ChanOptions[T]) Subscription[T] {
+	if opts.Overflow == Coalesce && opts.Merge == nil {
+		panic("broadcast: Coalesce without Merge")
+	}
+	opts.Buffer = max(opts.Buffer, 1)
+	return subscribe[T](b, &chanSubscriber[T]{
+		c: make(chan T, opts.Buffer), opts: opts,
+	})
+}
+
+type chanSubscriber[T Event] struct {
+	c    chan T
+	opts ChanOptions[T]
+}
+
+// send delivers event according to the overflow policy
+// and returns false if it was discarded.
+// Notify calls it with the lock held, so it never runs concurrently
+// and the channel isn't closed meanwhile.
+func (s *chanSubscriber[T]) send(event T) bool {
+	select {
+	case s.c <- event:
+		return true
+	default:
+	}
+	switch s.opts.Overflow {
+	case DropNewest:
+		return false
+	case Block:
+		t := time.NewTimer(s.opts.Timeout)
+		defer t.Stop()
+		select {
+		case s.c <- event:
+			return true
+		case <-t.C:
+			return false
+		}
+	case Coalesce:
+		// The subscriber may receive concurrently, so the events
+		// left in the buffer are merged in the order they're taken.
+		merged := false
+		var acc T
+		for len(s.c) > 0 {
+			select {
+			case e := <-s.c:
+				if merged {
+					acc = s.opts.Merge(acc, e)
+				} else {
+					acc, merged = e, true
+				}
+			default:
+			}
+		}
+		if merged {
+			event = s.opts.Merge(acc, event)
+		}
+		s.c <- event // The buffer is empty and only send fills it.
+		return true
+	}
+	// DropOldest: Retry until there's room
+	// since the subscriber may have taken the oldest event meanwhile.
+	for {
+		select {
+		case <-s.c:
+		default:
+		}
+		select {
+		case s.c <- event:
+			return true
+		default:
+		}
+	}
+}
+
 // Notify sends event to all subscribers for T.
+// Callbacks are called in new goroutines while channel subscriptions
+// receive events in order, see SubscribeChan.
+// Returns the number of subscribers the event wasn't discarded for.
 func Notify[T Event](b *TopicBroadcaster, event T) (notified int) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
@@ -84,6 +211,10 @@ func Notify[T Event](b *TopicBroadcaster, event T) (notified int) {
 			case func(T):
 				go c(event)
 				notified++
+			case *chanSubscriber[T]:
+				if c.send(event) {
+					notified++
+				}
 			}
 		}
 	}
@@ -4,6 +4,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/romshark/todostar/pkg/broadcast"
 
@@ -54,3 +55,135 @@ func TestSubUnsub(t *testing.T) {
 	require.Equal(t, int32(1), sub1Calls.Load())
 	require.Equal(t, int32(1), sub2Calls.Load())
 }
+
+// receive returns all events buffered in c.
+func receive(c <-chan TestEvent1) (data []int) {
+	for {
+		select {
+		case e := <-c:
+			data = append(data, e.Data)
+		default:
+			return data
+		}
+	}
+}
+
+func TestSubscribeChan(t *testing.T) {
+	b := broadcast.NewTopicBroadcaster()
+
+	sub := broadcast.SubscribeChan(b, broadcast.ChanOptions[TestEvent1]{Buffer: 100})
+	require.Nil(t, broadcast.Subscribe(b, func(TestEvent1) {}).C())
+
+	for i := range 100 {
+		require.Equal(t, 2, broadcast.Notify(b, TestEvent1{Data: i}))
+	}
+	data := receive(sub.C())
+	require.Len(t, data, 100)
+	for i, d := range data {
+		require.Equal(t, i, d, "delivered in order")
+	}
+
+	sub.Close()
+	_, ok := <-sub.C()
+	require.False(t, ok, "closed")
+	require.Equal(t, 1, broadcast.Notify(b, TestEvent1{}))
+}
+
+func TestSubscribeChanOverflow(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		opts     broadcast.ChanOptions[TestEvent1]
+		notified int
+		expect   []int
+	}{
+		{
+			name:     "drop oldest",
+			opts:     broadcast.ChanOptions[TestEvent1]{Buffer: 2},
+			notified: 4,
+			expect:   []int{3, 4},
+		},
+		{
+			name: "drop newest",
+			opts: broadcast.ChanOptions[TestEvent1]{
+				Buffer: 2, Overflow: broadcast.DropNewest,
+			},
+			notified: 2,
+			expect:   []int{1, 2},
+		},
+		{
+			name: "coalesce",
+			opts: broadcast.ChanOptions[TestEvent1]{
+				Buffer: 2, Overflow: broadcast.Coalesce,
+				Merge: func(acc, e TestEvent1) TestEvent1 {
+					return TestEvent1{Data: acc.Data*10 + e.Data}
+				},
+			},
+			notified: 4,
+			expect:   []int{123, 4},
+		},
+		{
+			name: "block",
+			opts: broadcast.ChanOptions[TestEvent1]{
+				Buffer: 2, Overflow: broadcast.Block, Timeout: time.Millisecond,
+			},
+			notified: 2,
+			expect:   []int{1, 2},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b := broadcast.NewTopicBroadcaster()
+			sub := broadcast.SubscribeChan(b, tt.opts)
+			defer sub.Close()
+
+			notified := 0
+			for i := 1; i <= 4; i++ {
+				notified += broadcast.Notify(b, TestEvent1{Data: i})
+			}
+			require.Equal(t, tt.notified, notified)
+			require.Equal(t, tt.expect, receive(sub.C()))
+		})
+	}
+}
+
+func TestSubscribeChanBlock(t *testing.T) {
+	b := broadcast.NewTopicBroadcaster()
+	sub := broadcast.SubscribeChan(b, broadcast.ChanOptions[TestEvent1]{
+		Overflow: broadcast.Block, Timeout: time.Minute,
+	})
+	defer sub.Close()
+
+	require.Equal(t, 1, broadcast.Notify(b, TestEvent1{Data: 1}))
+	done := make(chan int)
+	go func() { done <- broadcast.Notify(b, TestEvent1{Data: 2}) }()
+
+	require.Equal(t, 1, (<-sub.C()).Data)
+	require.Equal(t, 1, <-done, "delivered once there was room")
+	require.Equal(t, 2, (<-sub.C()).Data)
+}
+
+func TestSubscribeChanCoalesceWithoutMerge(t *testing.T) {
+	require.Panics(t, func() {
+		broadcast.SubscribeChan(broadcast.NewTopicBroadcaster(),
+			broadcast.ChanOptions[TestEvent1]{Overflow: broadcast.Coalesce})
+	})
+}
+
+func TestSubscribeChanConcurrent(t *testing.T) {
+	b := broadcast.NewTopicBroadcaster()
+	sub := broadcast.SubscribeChan(b, broadcast.ChanOptions[TestEvent1]{Buffer: 4})
+
+	const n = 10_000
+	go func() {
+		for i := range n {
+			broadcast.Notify(b, TestEvent1{Data: i})
+		}
+		sub.Close()
+	}()
+
+	last := -1
+	for e := range sub.C() {
+		require.Greater(t, e.Data, last, "in order despite drops")
+		last = e.Data
+	}
+	require.Equal(t, n-1, last, "the latest event is never dropped")
+}
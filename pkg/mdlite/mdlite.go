@@ -0,0 +1,180 @@
+// Package mdlite renders a small and safe subset of markdown to HTML.
+//
+// Supported are paragraphs separated by blank lines, line breaks,
+// lists of lines starting with "- " or "* ", **bold**, *italic* or _italic_,
+// `code`, [links](https://example.com) and bare http(s) URLs.
+// Everything else is escaped and rendered as is.
+package mdlite
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// HTML renders markdown-lite s to HTML.
+func HTML(s string) string {
+	var b strings.Builder
+	var para []string
+	var list []string
+	flush := func() {
+		if len(para) > 0 {
+			b.WriteString("<p>")
+			for i, l := range para {
+				if i > 0 {
+					b.WriteString("<br>")
+				}
+				inline(&b, l)
+			}
+			b.WriteString("</p>")
+			para = para[:0]
+		}
+		if len(list) > 0 {
+			b.WriteString("<ul>")
+			for _, l := range list {
+				b.WriteString("<li>")
+				inline(&b, l)
+				b.WriteString("</li>")
+			}
+			b.WriteString("</ul>")
+			list = list[:0]
+		}
+	}
+	for l := range strings.SplitSeq(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		l = strings.TrimRightFunc(l, unicode.IsSpace)
+		switch item, ok := listItem(l); {
+		case l == "":
+			flush()
+		case ok:
+			if len(para) > 0 {
+				flush()
+			}
+			list = append(list, item)
+		default:
+			if len(list) > 0 {
+				flush()
+			}
+			para = append(para, l)
+		}
+	}
+	flush()
+	return b.String()
+}
+
+func listItem(l string) (item string, ok bool) {
+	t := strings.TrimLeft(l, " ")
+	for _, p := range []string{"- ", "* "} {
+		if rest, ok := strings.CutPrefix(t, p); ok {
+			return rest, true
+		}
+	}
+	return "", false
+}
+
+// inline renders the inline elements of s.
+func inline(b *strings.Builder, s string) {
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		switch {
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				b.WriteString("<code>")
+				b.WriteString(html.EscapeString(rest[1 : end+1]))
+				b.WriteString("</code>")
+				i += end + 2
+				continue
+			}
+		case strings.HasPrefix(rest, "**"):
+			if end := strings.Index(rest[2:], "**"); end > 0 {
+				b.WriteString("<strong>")
+				inline(b, rest[2:end+2])
+				b.WriteString("</strong>")
+				i += end + 4
+				continue
+			}
+		case rest[0] == '*' || rest[0] == '_':
+			if end := emphasisEnd(s, i); end > 0 {
+				b.WriteString("<em>")
+				inline(b, s[i+1:end])
+				b.WriteString("</em>")
+				i = end + 1
+				continue
+			}
+		case rest[0] == '[':
+			if text, url, n := link(rest); n > 0 {
+				writeLink(b, url, func() { inline(b, text) })
+				i += n
+				continue
+			}
+		case isURL(rest) && (i == 0 || !isWordByte(s[i-1])):
+			url := bareURL(rest)
+			writeLink(b, url, func() { b.WriteString(html.EscapeString(url)) })
+			i += len(url)
+			continue
+		}
+		_, n := utf8.DecodeRuneInString(rest)
+		b.WriteString(html.EscapeString(rest[:n]))
+		i += n
+	}
+}
+
+// emphasisEnd returns the index of the delimiter closing the emphasis
+// opened at s[i] or -1 if there is none. Delimiters within words,
+// like in snake_case, don't count.
+func emphasisEnd(s string, i int) int {
+	d := s[i]
+	if i > 0 && isWordByte(s[i-1]) || i+1 >= len(s) || s[i+1] == ' ' {
+		return -1
+	}
+	for j := i + 2; j < len(s); j++ {
+		if s[j] == d && s[j-1] != ' ' && (j+1 == len(s) || !isWordByte(s[j+1])) {
+			return j
+		}
+	}
+	return -1
+}
+
+// link parses a link like [text](https://example.com) at the start of s
+// and returns the number of bytes it spans or 0 if there is none.
+func link(s string) (text, url string, n int) {
+	closeText := strings.Index(s, "](")
+	if closeText < 2 {
+		return "", "", 0
+	}
+	closeURL := strings.IndexByte(s[closeText:], ')')
+	if closeURL < 0 {
+		return "", "", 0
+	}
+	text, url = s[1:closeText], s[closeText+2:closeText+closeURL]
+	if !isURL(url) || strings.ContainsAny(url, " \t") {
+		return "", "", 0
+	}
+	return text, url, closeText + closeURL + 1
+}
+
+func writeLink(b *strings.Builder, url string, text func()) {
+	b.WriteString(`<a href="`)
+	b.WriteString(html.EscapeString(url))
+	b.WriteString(`" target="_blank" rel="noopener noreferrer">`)
+	text()
+	b.WriteString("</a>")
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://")
+}
+
+// bareURL returns the URL at the start of s without trailing punctuation.
+func bareURL(s string) string {
+	end := strings.IndexFunc(s, unicode.IsSpace)
+	if end < 0 {
+		end = len(s)
+	}
+	return strings.TrimRight(s[:end], ".,;:!?)'\"")
+}
+
+func isWordByte(c byte) bool {
+	return c >= utf8.RuneSelf || c == '_' ||
+		'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
@@ -0,0 +1,65 @@
+package mdlite_test
+
+import (
+	"testing"
+
+	"github.com/romshark/todostar/pkg/mdlite"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTML(t *testing.T) {
+	for _, tc := range []struct {
+		name, input, expect string
+	}{
+		{"empty", "", ""},
+		{"text", "plain text", "<p>plain text</p>"},
+		{
+			"escaped",
+			`<script>alert("x")</script> & co`,
+			"<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; &amp; co</p>",
+		},
+		{"line breaks", "one\ntwo\r\nthree", "<p>one<br>two<br>three</p>"},
+		{"paragraphs", "one\n\n\ntwo", "<p>one</p><p>two</p>"},
+		{
+			"list",
+			"Options:\n- lighthouse\n* harbor\n\nDecide!",
+			"<p>Options:</p><ul><li>lighthouse</li><li>harbor</li></ul><p>Decide!</p>",
+		},
+		{"bold", "a **bold** move", "<p>a <strong>bold</strong> move</p>"},
+		{"italic", "*really* _this_", "<p><em>really</em> <em>this</em></p>"},
+		{"nested", "**very *much* so**", "<p><strong>very <em>much</em> so</strong></p>"},
+		{"snake case", "use snake_case_names", "<p>use snake_case_names</p>"},
+		{"multiplication", "2 * 3 * 4", "<p>2 * 3 * 4</p>"},
+		{"unclosed", "**open `code", "<p>**open `code</p>"},
+		{"code", "run `go test <pkg>`", "<p>run <code>go test &lt;pkg&gt;</code></p>"},
+		{"code not formatted", "`**x**`", "<p><code>**x**</code></p>"},
+		{
+			"link",
+			"see [the docs](https://example.com/a?b=1&c=2)",
+			`<p>see <a href="https://example.com/a?b=1&amp;c=2" target="_blank" ` +
+				`rel="noopener noreferrer">the docs</a></p>`,
+		},
+		{
+			"bare url",
+			"at https://example.com/x.",
+			`<p>at <a href="https://example.com/x" target="_blank" ` +
+				`rel="noopener noreferrer">https://example.com/x</a>.</p>`,
+		},
+		{
+			"no javascript links",
+			"[click](javascript:alert(1))",
+			"<p>[click](javascript:alert(1))</p>",
+		},
+		{
+			"quotes in url",
+			`https://example.com/"onmouseover="x`,
+			`<p><a href="https://example.com/&#34;onmouseover=&#34;x" target="_blank" ` +
+				`rel="noopener noreferrer">https://example.com/&#34;onmouseover=&#34;x</a></p>`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expect, mdlite.HTML(tc.input))
+		})
+	}
+}
@@ -1,9 +1,11 @@
 package server
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 
+	"github.com/romshark/todostar/domain"
 	"github.com/romshark/todostar/events"
 	"github.com/romshark/todostar/server/request"
 	"github.com/starfederation/datastar-go/datastar"
@@ -18,11 +20,26 @@ func (s *Server) deleteTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = s.store.Delete(r.Context(), signals.SelectedTodoID)
+	r, ok := s.authorizeTodo(w, r, signals.SelectedTodoID, domain.RoleEditor)
+	if !ok {
+		return
+	}
+
+	// Moving the todo to the trash unblocks the todos blocked by it.
+	blocked, err := s.blockedTodos(r.Context(), signals.SelectedTodoID)
+	if request.IfErrInternal(w, err, "") {
+		return
+	}
+	c, err := s.changeTodo(r.Context(), signals.SelectedTodoID,
+		func(ctx context.Context) error {
+			return s.store.Delete(ctx, signals.SelectedTodoID)
+		})
 	if request.IfErrInternal(w, err, "") {
 		return
 	}
+	e := s.trashUndo(signals.SelectedTodoID)
+	s.pushUndo(r, s.reblockUndo(e, signals.SelectedTodoID, blocked))
 
-	n := events.NotifyTodosChanged()
+	n := events.NotifyTodoDeleted(r.Context(), c.before, c.after)
 	slog.Debug("notified todos changed", slog.Int("clients", n))
 }
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/events"
+)
+
+// deleteTodoAttachments removes the attachment with the hash in the path
+// from the todo in the path. Its contents are garbage-collected
+// once no todo references them anymore, see domain.BlobStore.GC.
+func (s *Server) deleteTodoAttachments(w http.ResponseWriter, r *http.Request) {
+	r, id, ok := s.authorizeTodoPath(w, r, domain.RoleEditor)
+	if !ok {
+		return
+	}
+
+	hash := r.PathValue("hash")
+	c, err := s.editTodo(r.Context(), id, 0, func(t *domain.Todo) error {
+		if _, ok := t.Attachment(hash); !ok {
+			return domain.ErrNotExists
+		}
+		t.Attachments = slices.DeleteFunc(t.Attachments,
+			func(a domain.Attachment) bool { return a.Hash == hash })
+		return nil
+	})
+	if ifErrWorkspace(w, r, err) {
+		return
+	}
+
+	s.pushUndo(r, s.editUndo("Attachment removed", *c.before, *c.after))
+
+	n := events.NotifyTodoUpdated(r.Context(), c.before, c.after)
+	slog.Debug("notified todos changed", slog.Int("clients", n))
+}
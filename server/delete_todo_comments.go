@@ -0,0 +1,45 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/events"
+	"github.com/romshark/todostar/server/request"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+func (s *Server) deleteTodoComments(w http.ResponseWriter, r *http.Request) {
+	var signals struct {
+		SelectedTodoID int64 `json:"selectedTodoID"`
+		Comment        struct {
+			ID int64 `json:"id"`
+		} `json:"comment"`
+	}
+	err := datastar.ReadSignals(r, &signals)
+	if request.IfErrBadRequest(w, err, "bad signals") {
+		return
+	}
+
+	r, ok := s.authorizeTodo(w, r, signals.SelectedTodoID, domain.RoleEditor)
+	if !ok {
+		return
+	}
+
+	err = s.authorizeComment(r, signals.SelectedTodoID, signals.Comment.ID)
+	if err == nil {
+		err = s.store.DeleteComment(r.Context(), signals.SelectedTodoID, signals.Comment.ID)
+	}
+	if ifErrWorkspace(w, r, err) {
+		return
+	}
+
+	n := events.NotifyCommentsChanged(workspaceID(r.Context()), signals.SelectedTodoID)
+	slog.Debug("notified comments changed", slog.Int("clients", n))
+
+	if sse, ok := s.patchComments(w, r, signals.SelectedTodoID, ""); ok {
+		sse.PatchSignals(map[string]any{"comment": map[string]any{"id": 0}},
+			"comment id")
+	}
+}
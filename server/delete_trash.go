@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/events"
+	"github.com/romshark/todostar/server/request"
+)
+
+// deleteTrash permanently deletes all todos in the trash of the workspace.
+func (s *Server) deleteTrash(w http.ResponseWriter, r *http.Request) {
+	workspace := workspaceID(r.Context())
+	trashed, err := s.store.Search(r.Context(), domain.SearchFilters{
+		Workspace: workspace, Trashed: true,
+	})
+	if request.IfErrInternal(w, err, "") {
+		return
+	}
+	n, err := s.store.Purge(r.Context(), workspace, time.Now())
+	if request.IfErrInternal(w, err, "") {
+		return
+	}
+	slog.Info("emptied trash",
+		slog.Int64("workspace", workspace), slog.Int("purged", n))
+	s.collectBlobs(r.Context())
+	if n == 0 {
+		return
+	}
+
+	ids := make([]int64, len(trashed))
+	for i, t := range trashed {
+		ids[i] = t.ID
+	}
+	// The trash is rendered anew on every change,
+	// so todos trashed in the meantime don't need to be listed.
+	clients := events.NotifyTodosPurged(r.Context(), workspace, ids...)
+	slog.Debug("notified todos changed", slog.Int("clients", clients))
+}
+
+// collectBlobs deletes the contents of attachments no todo references
+// anymore after todos were permanently deleted.
+func (s *Server) collectBlobs(ctx context.Context) {
+	n, err := s.blobs.GC(ctx, s.store, time.Now().Add(-domain.BlobGracePeriod))
+	if err != nil {
+		slog.Error("collecting attachments", slog.Any("err", err))
+	}
+	if n > 0 {
+		slog.Info("collected attachments", slog.Int("deleted", n))
+	}
+}
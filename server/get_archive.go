@@ -1,6 +1,8 @@
 package server
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
 
@@ -21,6 +23,11 @@ func (s *Server) getArchive(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Membership is only checked here, see stillMember.
+	ctx, leave := context.WithCancel(r.Context())
+	defer leave()
+	r = r.WithContext(ctx)
+
 	sse := request.SSE(w, r)
 	sse.Patch(template.ViewArchive(nil), "view archive")
 
@@ -29,33 +36,68 @@ func (s *Server) getArchive(w http.ResponseWriter, r *http.Request) {
 		slog.Error("reading signals", slog.Any("err", err))
 	}
 
-	todos, err := s.store.Search(r.Context(), domain.SearchFilters{
+	workspace := workspaceID(r.Context())
+	filters := domain.SearchFilters{
+		Workspace: workspace,
 		TextMatch: signals.Search.Term,
 		Archived:  true,
-	})
+		Sort:      signals.Search.SortKey(),
+		SortDesc:  signals.Search.SortDesc,
+	}
+	todos, err := s.store.Search(r.Context(), filters)
 	if err != nil {
 		slog.Error("searching archived todos", slog.Any("err", err))
 		return
 	}
 
 	sse.Patch(template.PartArchivedTodos(todos), "part archived todos list")
+	list := newRenderedList(false, todos, nil)
 
-	// Subscribe and keep updating the view until the connection is closed.
-	sub := events.OnTodosChanged(func(etc events.EventTodosChanged) {
-		todos, err := s.store.Search(r.Context(), domain.SearchFilters{
-			TextMatch: signals.Search.Term,
-			Archived:  true,
+	// Subscribe and keep updating the list until the connection is closed.
+	sub := events.OnTodosChanged(workspace, s.refreshWindow,
+		func(e events.EventTodosChanged) {
+			if !s.stillMember(r.Context(), sse, leave) {
+				return
+			}
+			todos, err := s.store.Search(r.Context(), filters)
+			if err != nil {
+				slog.Error("searching archived todos", slog.Any("err", err))
+				return
+			}
+			patchArchivedTodos(sse, list, e, todos)
 		})
-		if err != nil {
-			slog.Error("searching archived todos", slog.Any("err", err))
-			return
-		}
-		if todos == nil {
-			todos = []*domain.Todo{}
-		}
-		sse.Patch(template.ViewArchive(todos), "view archive")
-	})
 	defer sub.Close()
 
+	subUndo := s.subscribeUndo(request.Session(r), sse)
+	defer subUndo.Close()
+
 	sse.Wait() // Wait until connection is closed.
 }
+
+// patchArchivedTodos patches the archived todos rendered as l
+// to todos after the changes of e, see patchTodos.
+func patchArchivedTodos(
+	sse request.SSEHandle, l *renderedList, e events.EventTodosChanged,
+	todos []*domain.Todo,
+) {
+	defer l.set(todos, nil)
+	removed, kept, ok := l.diff(e, todos)
+	if !ok {
+		sse.Patch(template.PartArchivedTodos(todos), "part archived todos list")
+		return
+	}
+	for _, id := range removed {
+		sse.Remove(fmt.Sprintf("#archived-todo-%d", id), "archived todo")
+	}
+	for i, t := range todos {
+		item := template.PartArchivedTodosListItem(i, t)
+		switch {
+		case i >= kept:
+			sse.Patch(item, "part archived todos list item",
+				datastar.WithSelectorID("archived-todos-list"), datastar.WithModeAppend())
+		case l.changed(e, todos, i, nil):
+			sse.Patch(item, "part archived todos list item")
+		}
+	}
+	sse.Patch(template.PartArchivedTodosSummary(todos), "part archived todos summary")
+}
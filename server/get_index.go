@@ -1,8 +1,11 @@
 package server
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"sync/atomic"
 
 	"github.com/romshark/todostar/domain"
 	"github.com/romshark/todostar/events"
@@ -21,39 +24,131 @@ func (s *Server) getIndex(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Membership is only checked here, see stillMember.
+	ctx, leave := context.WithCancel(r.Context())
+	defer leave()
+	r = r.WithContext(ctx)
+
 	sse := request.SSE(w, r)
-	sse.Patch(template.ViewIndex(nil), "view index")
+	sse.Patch(template.ViewIndex(nil, nil, nil), "view index")
 
 	var signals Signals
 	if err := datastar.ReadSignals(r, &signals); err != nil {
 		slog.Error("reading signals", slog.Any("err", err))
 	}
 
-	todos, err := s.store.Search(r.Context(), domain.SearchFilters{
-		TextMatch: signals.Search.Term,
-	})
+	workspace := workspaceID(r.Context())
+	assignee, unassigned := signals.Search.AssigneeFilter(domain.UserFrom(r.Context()).ID)
+	filters := domain.SearchFilters{
+		Workspace:   workspace,
+		Assignee:    assignee,
+		Unassigned:  unassigned,
+		TextMatch:   signals.Search.Term,
+		Tags:        signals.Search.Tags,
+		ExcludeTags: signals.Search.ExcludeTags,
+		Sort:        signals.Search.SortKey(),
+		SortDesc:    signals.Search.SortDesc,
+		HideBlocked: signals.Search.HideBlocked,
+	}
+	todos, tags, blockers, err := s.searchTodos(r.Context(), filters)
 	if err != nil {
 		slog.Error("searching todos", slog.Any("err", err))
 		return
 	}
 
-	sse.Patch(template.PartTodos(todos), "part list todos")
+	sse.Patch(template.PartTodos(todos, tags, blockers), "part list todos")
+	list := newRenderedList(true, todos, blockers)
 
-	// Subscribe and keep updating the view until the connection is closed.
-	sub := events.OnTodosChanged(func(etc events.EventTodosChanged) {
-		todos, err := s.store.Search(r.Context(), domain.SearchFilters{
-			TextMatch: signals.Search.Term,
+	// Subscribe and keep updating the list until the connection is closed.
+	sub := events.OnTodosChanged(workspace, s.refreshWindow,
+		func(e events.EventTodosChanged) {
+			if !s.stillMember(r.Context(), sse, leave) {
+				return
+			}
+			todos, tags, blockers, err := s.searchTodos(r.Context(), filters)
+			if err != nil {
+				slog.Error("searching todos", slog.Any("err", err))
+				return
+			}
+			patchTodos(sse, list, e, todos, tags, blockers)
 		})
-		if err != nil {
-			slog.Error("searching todos", slog.Any("err", err))
+	defer sub.Close()
+
+	// Let the edit dialog reload the comments if it shows the changed ones.
+	var commentsSeq atomic.Int64
+	subComments := events.OnCommentsChanged(workspace, func(e events.EventCommentsChanged) {
+		if !s.stillMember(r.Context(), sse, leave) {
 			return
 		}
-		if todos == nil {
-			todos = []*domain.Todo{}
-		}
-		sse.Patch(template.ViewIndex(todos), "view index")
+		sse.PatchSignals(map[string]any{"_comments": map[string]any{
+			"todo": e.TodoID, "seq": commentsSeq.Add(1),
+		}}, "comments changed")
 	})
-	defer sub.Close()
+	defer subComments.Close()
+
+	subUndo := s.subscribeUndo(request.Session(r), sse)
+	defer subUndo.Close()
 
 	sse.Wait() // Wait until connection is closed.
 }
+
+// patchTodos patches the todos rendered as l to todos after the changes of e.
+// Only the affected list items are patched unless the list
+// has to be rendered anew, see renderedList.diff.
+func patchTodos(
+	sse request.SSEHandle, l *renderedList, e events.EventTodosChanged,
+	todos []*domain.Todo, tags []domain.TagCount, blockers map[int64][]int64,
+) {
+	defer l.set(todos, blockers)
+	removed, kept, ok := l.diff(e, todos)
+	if !ok {
+		sse.Patch(template.PartTodos(todos, tags, blockers), "part list todos")
+		return
+	}
+	for _, id := range removed {
+		sse.Remove(fmt.Sprintf("#todo-%d", id), "todo")
+	}
+	for i, t := range todos {
+		var prevID int64
+		if i > 0 {
+			prevID = todos[i-1].ID
+		}
+		item := template.PartTodosListItem(i, t, prevID, blockers[t.ID])
+		switch {
+		case i >= kept:
+			sse.Patch(item, "part todos list item",
+				datastar.WithSelectorID("todos-list"), datastar.WithModeAppend())
+		case l.changed(e, todos, i, blockers[t.ID]):
+			sse.Patch(item, "part todos list item")
+		}
+	}
+	sse.Patch(template.PartTodosSummary(todos), "part todos summary")
+	sse.Patch(template.PartTagFacets(tags), "part tag facets")
+}
+
+// searchTodos returns the todos matching filters, the tag counts
+// of all matching todos and the open blockers of each todo.
+// Excluded tags are included with a count of 0 so that the filter can be reset.
+func (s *Server) searchTodos(
+	ctx context.Context, filters domain.SearchFilters,
+) (
+	todos []*domain.Todo, tags []domain.TagCount,
+	blockers map[int64][]int64, err error,
+) {
+	todos, err = s.store.Search(ctx, filters)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tags, err = s.store.TagCounts(ctx, filters)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, t := range filters.ExcludeTags {
+		tags = append(tags, domain.TagCount{Tag: t})
+	}
+	blockers, err = domain.OpenBlockers(ctx, s.store, todos)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return todos, tags, blockers, nil
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/romshark/todostar/server/request"
+	"github.com/romshark/todostar/server/template"
+)
+
+func (s *Server) getLogin(w http.ResponseWriter, r *http.Request) {
+	next := nextURL(r)
+	if _, ok := s.sessions.Get(request.Session(r)); ok {
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	}
+	s.renderLogin(w, r, next, "")
+}
+
+// renderLogin renders the login page showing errLogin if not empty.
+func (s *Server) renderLogin(w http.ResponseWriter, r *http.Request, next, errLogin string) {
+	err := template.PageLogin(
+		request.ThemeIsDark(r), next, s.oidc != nil, s.passwordLogin, errLogin,
+	).Render(r.Context(), w)
+	if err != nil {
+		slog.Error("rendering page login", slog.Any("err", err))
+	}
+}
+
+// nextURL returns the local URL from the query parameter "next"
+// to take the user to after logging in or "/" if there is none.
+func nextURL(r *http.Request) string {
+	next := r.URL.Query().Get("next")
+	// Don't redirect to other hosts like "//example.com".
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") ||
+		strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+
+	"github.com/romshark/todostar/server/oidc"
+	"github.com/romshark/todostar/server/request"
+)
+
+// cookieOIDCState binds a login through the OIDC provider to the browser
+// that started it so that nobody else's login can be finished in it.
+const cookieOIDCState = "oidc_state"
+
+// getLoginOIDC redirects to the OIDC provider to log in.
+func (s *Server) getLoginOIDC(w http.ResponseWriter, r *http.Request) {
+	authURL, state := s.oidc.Begin(nextURL(r))
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieOIDCState,
+		Value:    state,
+		Path:     "/login/oidc/",
+		MaxAge:   int(oidc.LoginTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   !s.insecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusSeeOther)
+}
+
+// getLoginOIDCCallback finishes the login the OIDC provider redirected back
+// from, provisions the user on first login and starts a new session.
+func (s *Server) getLoginOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	const msgFailed = "Single sign-on failed, please try again"
+	q := r.URL.Query()
+	http.SetCookie(w, &http.Cookie{
+		Name: cookieOIDCState, Path: "/login/oidc/", MaxAge: -1, HttpOnly: true,
+	})
+
+	if e := q.Get("error"); e != "" {
+		slog.Info("oidc login denied", slog.String("error", e),
+			slog.String("description", q.Get("error_description")))
+		s.renderLogin(w, r, "/", msgFailed)
+		return
+	}
+	c, err := r.Cookie(cookieOIDCState)
+	if err != nil || subtle.ConstantTimeCompare([]byte(c.Value), []byte(q.Get("state"))) != 1 {
+		slog.Info("oidc login state mismatch")
+		s.renderLogin(w, r, "/", msgFailed)
+		return
+	}
+	claims, next, err := s.oidc.Finish(r.Context(), q.Get("state"), q.Get("code"))
+	if err != nil {
+		slog.Info("oidc login failed", slog.Any("err", err))
+		s.renderLogin(w, r, "/", msgFailed)
+		return
+	}
+
+	u, err := s.users.ProvisionUser(r.Context(),
+		s.oidc.Issuer(), claims.Subject, claims.User())
+	if request.IfErrInternal(w, err, "") {
+		return
+	}
+
+	s.sessions.End(request.Session(r))
+	id := s.sessions.Start(u.ID)
+	request.SetSession(w, id, s.sessions.TTL(), s.insecureCookies)
+	slog.Info("login", slog.String("user", u.Name), slog.String("via", "oidc"))
+
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/server/request"
+	"github.com/romshark/todostar/server/template"
+)
+
+func (s *Server) getMembers(w http.ResponseWriter, r *http.Request) {
+	members, err := s.members(r.Context())
+	if request.IfErrInternal(w, err, "") {
+		return
+	}
+	err = template.PageMembers(request.ThemeIsDark(r), members).Render(r.Context(), w)
+	if err != nil {
+		slog.Error("rendering page members", slog.Any("err", err))
+	}
+}
+
+// members returns the members of the workspace passed on in ctx
+// ordered by role from highest to lowest and name.
+func (s *Server) members(ctx context.Context) ([]*domain.User, error) {
+	ws := domain.WorkspaceFrom(ctx)
+	members := make([]*domain.User, 0, len(ws.Members))
+	for id := range ws.Members {
+		u, err := s.users.GetUser(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, u)
+	}
+	slices.SortFunc(members, func(a, b *domain.User) int {
+		return cmp.Or(
+			cmp.Compare(ws.Role(b.ID), ws.Role(a.ID)),
+			cmp.Compare(a.Name, b.Name),
+		)
+	})
+	return members, nil
+}
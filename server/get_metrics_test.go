@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsRequireLogin(t *testing.T) {
+	s := newTestServer(t)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequestWithContext(
+		t.Context(), http.MethodGet, "/metrics/", nil))
+	require.Equal(t, http.StatusSeeOther, w.Code)
+
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/metrics/", nil)
+	r.AddCookie(&http.Cookie{Name: "session", Value: s.session})
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	for _, name := range []string{
+		"todostar_todo_events_notified_total",
+		"todostar_todo_events_merged_total",
+		"todostar_todo_events_ignored_total",
+		"todostar_todo_refreshes_total",
+	} {
+		require.Contains(t, w.Body.String(), "\n"+name+" ")
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/server/request"
+)
+
+// defaultWorkspaceName is the name of the workspace created
+// for users that aren't a member of any.
+const defaultWorkspaceName = "Personal"
+
+// getRoot redirects to the first workspace of the user
+// and creates one if the user has none.
+func (s *Server) getRoot(w http.ResponseWriter, r *http.Request) {
+	u := domain.UserFrom(r.Context())
+	l, err := s.workspaces.Workspaces(r.Context(), u.ID)
+	if request.IfErrInternal(w, err, "") {
+		return
+	}
+	var id int64
+	if len(l) > 0 {
+		id = l[0].ID
+	} else {
+		id, err = s.workspaces.AddWorkspace(r.Context(), defaultWorkspaceName, u.ID)
+		if request.IfErrInternal(w, err, "") {
+			return
+		}
+		slog.Info("added workspace",
+			slog.Int64("workspace", id), slog.String("admin", u.Name))
+	}
+	http.Redirect(w, r, fmt.Sprintf("/w/%d/", id), http.StatusSeeOther)
+}
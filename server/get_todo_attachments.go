@@ -0,0 +1,54 @@
+package server
+
+import (
+	"log/slog"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/romshark/todostar/domain"
+)
+
+// getTodoAttachments serves the contents of the attachment with the hash
+// in the path of the todo in the path. Images are shown inline,
+// other files are downloaded.
+func (s *Server) getTodoAttachments(w http.ResponseWriter, r *http.Request) {
+	r, id, ok := s.authorizeTodoPath(w, r, domain.RoleViewer)
+	if !ok {
+		return
+	}
+	t, err := s.store.Get(r.Context(), id)
+	if ifErrWorkspace(w, r, err) {
+		return
+	}
+	a, ok := t.Attachment(r.PathValue("hash"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := s.blobs.Open(r.Context(), a.Hash)
+	if ifErrWorkspace(w, r, err) {
+		return
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			slog.Error("closing attachment", slog.Any("err", err))
+		}
+	}()
+
+	disposition := "attachment"
+	if a.IsImage() {
+		disposition = "inline"
+	}
+	h := w.Header()
+	h.Set("Content-Type", a.ContentType)
+	h.Set("Content-Disposition",
+		mime.FormatMediaType(disposition, map[string]string{"filename": a.Name}))
+	// Never let browsers guess the type or run anything that's served.
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	// The contents behind a hash never change.
+	h.Set("Cache-Control", "private, max-age=31536000, immutable")
+	h.Set("ETag", `"`+a.Hash+`"`)
+	http.ServeContent(w, r, a.Name, time.Time{}, f)
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/server/request"
+	"github.com/romshark/todostar/server/template"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+func (s *Server) getTodoComments(w http.ResponseWriter, r *http.Request) {
+	var signals struct {
+		SelectedTodoID int64 `json:"selectedTodoID"`
+	}
+	err := datastar.ReadSignals(r, &signals)
+	if request.IfErrBadRequest(w, err, "bad signals") {
+		return
+	}
+
+	r, ok := s.authorizeTodo(w, r, signals.SelectedTodoID, domain.RoleViewer)
+	if !ok {
+		return
+	}
+
+	s.patchComments(w, r, signals.SelectedTodoID, "")
+}
+
+// patchComments patches the comments panel of the edit dialog
+// with the comments on todo id and errComment.
+func (s *Server) patchComments(
+	w http.ResponseWriter, r *http.Request, id int64, errComment string,
+) (sse request.SSEHandle, ok bool) {
+	comments, err := s.store.Comments(r.Context(), id)
+	if ifErrWorkspace(w, r, err) {
+		return sse, false
+	}
+
+	// Like the history panel, the comments panel is excluded from morphing
+	// when the dialog is patched, so it has to be replaced instead.
+	sse = request.SSE(w, r)
+	return sse, sse.Patch(template.PartTodoComments(comments, errComment),
+		"part todo comments", datastar.WithModeReplace())
+}
+
+// authorizeComment returns errForbidden unless the user is the author
+// of comment id on todo todoID. Returns domain.ErrNotExists
+// if there's no such comment.
+func (s *Server) authorizeComment(r *http.Request, todoID, id int64) error {
+	comments, err := s.store.Comments(r.Context(), todoID)
+	if err != nil {
+		return err
+	}
+	for _, c := range comments {
+		if c.ID == id {
+			if c.Author != domain.UserFrom(r.Context()).ID {
+				return errForbidden
+			}
+			return nil
+		}
+	}
+	return domain.ErrNotExists
+}
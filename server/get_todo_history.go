@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/server/request"
+	"github.com/romshark/todostar/server/template"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+func (s *Server) getTodoHistory(w http.ResponseWriter, r *http.Request) {
+	var signals struct {
+		SelectedTodoID int64 `json:"selectedTodoID"`
+	}
+	err := datastar.ReadSignals(r, &signals)
+	if request.IfErrBadRequest(w, err, "bad signals") {
+		return
+	}
+
+	r, ok := s.authorizeTodo(w, r, signals.SelectedTodoID, domain.RoleViewer)
+	if !ok {
+		return
+	}
+
+	entries, err := s.store.History(r.Context(), domain.HistoryFilter{
+		TodoID: signals.SelectedTodoID,
+	})
+	if request.IfErrInternal(w, err, "") {
+		return
+	}
+
+	// The history panel is excluded from morphing when the dialog is patched,
+	// so it has to be replaced instead.
+	request.SSE(w, r).Patch(template.PartTodoHistory(entries), "part todo history",
+		datastar.WithModeReplace())
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/events"
+	"github.com/romshark/todostar/server/request"
+	"github.com/romshark/todostar/server/template"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+func (s *Server) getTrash(w http.ResponseWriter, r *http.Request) {
+	startDark := request.ThemeIsDark(r)
+
+	if !request.IsDS(r) {
+		err := template.PageTrash(startDark, s.trashRetention).Render(r.Context(), w)
+		if err != nil {
+			slog.Error("rendering page trash", slog.Any("err", err))
+		}
+		return
+	}
+
+	// Membership is only checked here, see stillMember.
+	ctx, leave := context.WithCancel(r.Context())
+	defer leave()
+	r = r.WithContext(ctx)
+
+	sse := request.SSE(w, r)
+	sse.Patch(template.ViewTrash(nil, s.trashRetention), "view trash")
+
+	var signals Signals
+	if err := datastar.ReadSignals(r, &signals); err != nil {
+		slog.Error("reading signals", slog.Any("err", err))
+	}
+
+	workspace := workspaceID(r.Context())
+	filters := domain.SearchFilters{
+		Workspace: workspace,
+		TextMatch: signals.Search.Term,
+		Trashed:   true,
+	}
+	todos, err := s.store.Search(r.Context(), filters)
+	if err != nil {
+		slog.Error("searching trashed todos", slog.Any("err", err))
+		return
+	}
+
+	sse.Patch(template.PartTrashedTodos(todos, s.trashRetention), "part trashed todos list")
+
+	// Subscribe and keep updating the view until the connection is closed.
+	sub := events.OnTodosChanged(workspace, s.refreshWindow,
+		func(events.EventTodosChanged) {
+			if !s.stillMember(r.Context(), sse, leave) {
+				return
+			}
+			todos, err := s.store.Search(r.Context(), filters)
+			if err != nil {
+				slog.Error("searching trashed todos", slog.Any("err", err))
+				return
+			}
+			if todos == nil {
+				todos = []*domain.Todo{}
+			}
+			sse.Patch(template.ViewTrash(todos, s.trashRetention), "view trash")
+		})
+	defer sub.Close()
+
+	subUndo := s.subscribeUndo(request.Session(r), sse)
+	defer subUndo.Close()
+
+	sse.Wait() // Wait until connection is closed.
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/server/request"
+	"github.com/romshark/todostar/server/session"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+// PathLogin is the path of the login page.
+const PathLogin = "/login/"
+
+// Auth makes next available to logged in users only and passes the user
+// on in the request context, see domain.UserFrom.
+// Page requests are redirected to the login page, Datastar requests
+// are redirected through SSE and all other requests are rejected with 401.
+// The session cookie is renewed on every request, see request.SetSession.
+func Auth(
+	next http.Handler, sessions *session.Store, users domain.UserStore,
+	insecureCookies bool,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := request.Session(r)
+		userID, ok := sessions.Get(id)
+		if !ok {
+			unauthorized(w, r)
+			return
+		}
+		u, err := users.GetUser(r.Context(), userID)
+		if errors.Is(err, domain.ErrNotExists) {
+			sessions.End(id)
+			unauthorized(w, r)
+			return
+		} else if request.IfErrInternal(w, err, "") {
+			return
+		}
+		request.SetSession(w, id, sessions.TTL(), insecureCookies)
+		next.ServeHTTP(w, r.WithContext(domain.WithUser(r.Context(), u)))
+	})
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case request.IsDS(r):
+		if err := datastar.NewSSE(w, r).Redirect(PathLogin); err != nil {
+			slog.Error("redirecting to login", slog.Any("err", err))
+		}
+	case r.Method == http.MethodGet:
+		// Take the user back to where they were after logging in.
+		u := PathLogin + "?" + url.Values{"next": {r.URL.RequestURI()}}.Encode()
+		http.Redirect(w, r, u, http.StatusSeeOther)
+	default:
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	}
+}
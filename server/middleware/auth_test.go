@@ -0,0 +1,76 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/server/middleware"
+	"github.com/romshark/todostar/server/session"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuth(t *testing.T) {
+	users := domain.NewUsers()
+	alice, err := users.AddUser(t.Context(), domain.User{Name: "alice"}, "password1")
+	require.NoError(t, err)
+	sessions := session.New(time.Hour)
+	valid := sessions.Start(alice)
+	deleted := sessions.Start(999)
+
+	h := middleware.Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(domain.UserFrom(r.Context()).Name))
+	}), sessions, users, false)
+
+	for _, td := range []struct {
+		name, method, session string
+		ds                    bool
+		expectCode            int
+		expectBody            string
+		expectLocation        string
+	}{
+		{
+			name: "logged in", method: http.MethodPost, session: valid,
+			expectCode: http.StatusOK, expectBody: "alice",
+		},
+		{
+			name: "page", method: http.MethodGet,
+			expectCode:     http.StatusSeeOther,
+			expectLocation: "/login/?next=%2Fw%2F1%2F%3Fq%3Dx",
+		},
+		{
+			name: "datastar", method: http.MethodGet, ds: true,
+			expectCode: http.StatusOK, expectBody: `window.location.href = "/login/"`,
+		},
+		{
+			name: "action", method: http.MethodPost, session: "forged",
+			expectCode: http.StatusUnauthorized,
+		},
+		{
+			name: "deleted user", method: http.MethodPost, session: deleted,
+			expectCode: http.StatusUnauthorized,
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			r := httptest.NewRequestWithContext(t.Context(), td.method, "/w/1/?q=x", nil)
+			if td.session != "" {
+				r.AddCookie(&http.Cookie{Name: "session", Value: td.session})
+			}
+			if td.ds {
+				r.Header.Set("Datastar-Request", "true")
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			require.Equal(t, td.expectCode, w.Code)
+			require.Contains(t, w.Body.String(), td.expectBody)
+			require.Equal(t, td.expectLocation, w.Header().Get("Location"))
+			// Only valid sessions are renewed.
+			require.Equal(t, td.session == valid, len(w.Result().Cookies()) > 0)
+		})
+	}
+
+	_, ok := sessions.Get(deleted)
+	require.False(t, ok, "sessions of deleted users end")
+}
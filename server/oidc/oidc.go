@@ -0,0 +1,182 @@
+// Package oidc implements logging in through an OpenID Connect provider
+// using the authorization code flow with PKCE.
+package oidc
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"github.com/romshark/todostar/domain"
+	"golang.org/x/oauth2"
+)
+
+// LoginTimeout is how long a login started with Provider.Begin can be finished.
+const LoginTimeout = 10 * time.Minute
+
+// MaxPendingLogins is how many logins started with Provider.Begin
+// can be pending at once. Beginning more logins evicts the oldest ones
+// since anyone can begin a login.
+const MaxPendingLogins = 10_000
+
+// ErrInvalidState is returned by Provider.Finish when the login
+// is unknown, was already finished or timed out.
+var ErrInvalidState = errors.New("invalid login state")
+
+// Config configures a Provider.
+type Config struct {
+	// Issuer is the URL of the OpenID Connect provider
+	// serving /.well-known/openid-configuration.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+
+	// Scopes are requested in addition to "openid".
+	Scopes []string
+
+	// RedirectURL is the callback URL registered with the provider.
+	RedirectURL string
+}
+
+// Provider logs users in through an OpenID Connect provider.
+type Provider struct {
+	issuer   string
+	oauth2   oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+
+	lock    sync.Mutex
+	pending map[string]*list.Element // Values are *login, by state.
+	order   list.List                // Pending logins from oldest to newest.
+}
+
+// login is a login waiting for the user to return from the provider.
+type login struct {
+	state, verifier, nonce, next string
+	expires                      time.Time
+}
+
+// New discovers the endpoints of the provider at conf.Issuer.
+// ctx is used for discovery and for fetching the signing keys
+// of the provider later on, see gooidc.ClientContext.
+func New(ctx context.Context, conf Config) (*Provider, error) {
+	p, err := gooidc.NewProvider(ctx, conf.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discovering provider: %w", err)
+	}
+	scopes := []string{gooidc.ScopeOpenID}
+	for _, s := range conf.Scopes {
+		if s = strings.TrimSpace(s); s != "" && s != gooidc.ScopeOpenID {
+			scopes = append(scopes, s)
+		}
+	}
+	return &Provider{
+		issuer: conf.Issuer,
+		oauth2: oauth2.Config{
+			ClientID:     conf.ClientID,
+			ClientSecret: conf.ClientSecret,
+			Endpoint:     p.Endpoint(),
+			RedirectURL:  conf.RedirectURL,
+			Scopes:       scopes,
+		},
+		verifier: p.Verifier(&gooidc.Config{ClientID: conf.ClientID}),
+		pending:  make(map[string]*list.Element),
+	}, nil
+}
+
+// Issuer returns the issuer URL of the provider.
+func (p *Provider) Issuer() string { return p.issuer }
+
+// Begin starts a login and returns the URL of the provider
+// to redirect the user to and the state to pass to Finish.
+// next is returned by Finish to take the user back to where they were.
+func (p *Provider) Begin(next string) (authURL, state string) {
+	state, verifier, nonce := rand.Text(), oauth2.GenerateVerifier(), rand.Text()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// All logins time out after the same duration
+	// so the oldest ones are the first to expire.
+	now := time.Now()
+	for e := p.order.Front(); e != nil; e = p.order.Front() {
+		if l := e.Value.(*login); p.order.Len() < MaxPendingLogins &&
+			!now.After(l.expires) {
+			break
+		}
+		p.remove(e)
+	}
+	p.pending[state] = p.order.PushBack(&login{
+		state: state, verifier: verifier, nonce: nonce, next: next,
+		expires: now.Add(LoginTimeout),
+	})
+	return p.oauth2.AuthCodeURL(state,
+		oauth2.S256ChallengeOption(verifier), gooidc.Nonce(nonce)), state
+}
+
+// Finish finishes login state by exchanging the authorization code
+// the provider redirected back with for the verified claims of the user.
+// Returns the next URL passed to Begin.
+// Returns ErrInvalidState if there's no such pending login.
+func (p *Provider) Finish(
+	ctx context.Context, state, code string,
+) (c Claims, next string, err error) {
+	p.lock.Lock()
+	e := p.pending[state]
+	if e != nil {
+		p.remove(e) // Logins can only be finished once.
+	}
+	p.lock.Unlock()
+	if e == nil || time.Now().After(e.Value.(*login).expires) {
+		return Claims{}, "", ErrInvalidState
+	}
+	l := e.Value.(*login)
+
+	tok, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(l.verifier))
+	if err != nil {
+		return Claims{}, "", fmt.Errorf("exchanging code: %w", err)
+	}
+	raw, ok := tok.Extra("id_token").(string)
+	if !ok {
+		return Claims{}, "", errors.New("missing ID token")
+	}
+	idToken, err := p.verifier.Verify(ctx, raw)
+	if err != nil {
+		return Claims{}, "", fmt.Errorf("verifying ID token: %w", err)
+	}
+	if idToken.Nonce != l.nonce {
+		return Claims{}, "", errors.New("ID token nonce mismatch")
+	}
+	if err := idToken.Claims(&c); err != nil {
+		return Claims{}, "", fmt.Errorf("decoding claims: %w", err)
+	}
+	return c, l.next, nil
+}
+
+// remove removes pending login e. p.lock must be held.
+func (p *Provider) remove(e *list.Element) {
+	delete(p.pending, p.order.Remove(e).(*login).state)
+}
+
+// Claims are the standard claims of the user read from the ID token.
+type Claims struct {
+	Subject           string `json:"sub"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Email             string `json:"email"`
+}
+
+// User maps c to a user to provision, see domain.UserStore.ProvisionUser.
+// The user name is the preferred user name or the local part of the email.
+func (c Claims) User() domain.User {
+	name := c.PreferredUsername
+	if name == "" {
+		name, _, _ = strings.Cut(c.Email, "@")
+	}
+	return domain.User{Name: name, DisplayName: c.Name, Email: c.Email}
+}
@@ -0,0 +1,316 @@
+package oidc_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/server/oidc"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	clientID     = "todostar"
+	clientSecret = "secret"
+	redirectURL  = "http://todostar.test/login/oidc/callback/"
+)
+
+// mockProvider is an in-process OpenID Connect provider
+// that authorizes every request as user.
+type mockProvider struct {
+	*httptest.Server
+	key  *rsa.PrivateKey
+	user map[string]any
+
+	// nonce overrides the nonce of issued ID tokens if not empty.
+	nonce string
+
+	lock  sync.Mutex
+	codes map[string]authorization
+}
+
+type authorization struct {
+	challenge, nonce, redirectURI string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p := &mockProvider{
+		key: key,
+		user: map[string]any{
+			"sub":                "248289761001",
+			"name":               "Jane Doe",
+			"preferred_username": "j.doe",
+			"email":              "janedoe@example.com",
+		},
+		codes: make(map[string]authorization),
+	}
+	m := http.NewServeMux()
+	m.HandleFunc("GET /.well-known/openid-configuration", p.getDiscovery)
+	m.HandleFunc("GET /keys", p.getKeys)
+	m.HandleFunc("GET /authorize", p.getAuthorize)
+	m.HandleFunc("POST /token", p.postToken)
+	p.Server = httptest.NewServer(m)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *mockProvider) getDiscovery(w http.ResponseWriter, r *http.Request) {
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"issuer":                                p.URL,
+		"authorization_endpoint":                p.URL + "/authorize",
+		"token_endpoint":                        p.URL + "/token",
+		"jwks_uri":                              p.URL + "/keys",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *mockProvider) getKeys(w http.ResponseWriter, r *http.Request) {
+	_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key: &p.key.PublicKey, KeyID: "k1", Algorithm: "RS256", Use: "sig",
+	}}})
+}
+
+// getAuthorize immediately redirects back with an authorization code.
+func (p *mockProvider) getAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != clientID || q.Get("response_type") != "code" ||
+		q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	code := rand.Text()
+	p.lock.Lock()
+	p.codes[code] = authorization{
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		redirectURI: q.Get("redirect_uri"),
+	}
+	p.lock.Unlock()
+	u, _ := url.Parse(q.Get("redirect_uri"))
+	u.RawQuery = url.Values{"code": {code}, "state": {q.Get("state")}}.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func (p *mockProvider) postToken(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if id != clientID || secret != clientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	p.lock.Lock()
+	a, ok := p.codes[r.PostFormValue("code")]
+	delete(p.codes, r.PostFormValue("code"))
+	p.lock.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || r.PostFormValue("redirect_uri") != a.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(challenge[:]) != a.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: p.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "k1"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	claims := map[string]any{
+		"iss": p.URL, "aud": clientID, "nonce": a.nonce,
+		"iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix(),
+	}
+	if p.nonce != "" {
+		claims["nonce"] = p.nonce
+	}
+	for k, v := range p.user {
+		claims[k] = v
+	}
+	idToken, err := jwt.Signed(signer).Claims(claims).Serialize()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func newProvider(t *testing.T, mock *mockProvider) *oidc.Provider {
+	t.Helper()
+	p, err := oidc.New(t.Context(), oidc.Config{
+		Issuer:       mock.URL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       []string{"openid", "profile", "email"},
+		RedirectURL:  redirectURL,
+	})
+	require.NoError(t, err)
+	return p
+}
+
+// authorize follows authURL like a browser and returns the state
+// and code the provider redirected back with.
+func authorize(t *testing.T, authURL string) (state, code string) {
+	t.Helper()
+	c := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := c.Get(authURL)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	loc, err := resp.Location()
+	require.NoError(t, err)
+	require.Equal(t, redirectURL, loc.Scheme+"://"+loc.Host+loc.Path)
+	return loc.Query().Get("state"), loc.Query().Get("code")
+}
+
+func TestLogin(t *testing.T) {
+	mock := newMockProvider(t)
+	p := newProvider(t, mock)
+	require.Equal(t, mock.URL, p.Issuer())
+
+	authURL, state := p.Begin("/archive/")
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	require.Equal(t, "openid profile email", u.Query().Get("scope"))
+	require.NotEmpty(t, u.Query().Get("nonce"))
+
+	gotState, code := authorize(t, authURL)
+	require.Equal(t, state, gotState)
+
+	c, next, err := p.Finish(t.Context(), state, code)
+	require.NoError(t, err)
+	require.Equal(t, "/archive/", next)
+	require.Equal(t, oidc.Claims{
+		Subject:           "248289761001",
+		Name:              "Jane Doe",
+		PreferredUsername: "j.doe",
+		Email:             "janedoe@example.com",
+	}, c)
+	require.Equal(t, domain.User{
+		Name: "j.doe", DisplayName: "Jane Doe", Email: "janedoe@example.com",
+	}, c.User())
+
+	// Logins can only be finished once.
+	_, _, err = p.Finish(t.Context(), state, code)
+	require.ErrorIs(t, err, oidc.ErrInvalidState)
+
+	// First login provisions the user, later ones update it.
+	users := domain.NewUsers()
+	first, err := users.ProvisionUser(t.Context(), p.Issuer(), c.Subject, c.User())
+	require.NoError(t, err)
+	mock.user["name"] = "Jane Smith"
+	authURL, state = p.Begin("/")
+	_, code = authorize(t, authURL)
+	c, _, err = p.Finish(t.Context(), state, code)
+	require.NoError(t, err)
+	again, err := users.ProvisionUser(t.Context(), p.Issuer(), c.Subject, c.User())
+	require.NoError(t, err)
+	require.Equal(t, first.ID, again.ID)
+	require.Equal(t, "Jane Smith", again.DisplayName)
+}
+
+func TestLoginUnknownState(t *testing.T) {
+	p := newProvider(t, newMockProvider(t))
+
+	authURL, _ := p.Begin("/")
+	state, code := authorize(t, authURL)
+	_, _, err := p.Finish(t.Context(), "forged", code)
+	require.ErrorIs(t, err, oidc.ErrInvalidState)
+
+	// The code must not be redeemable under another pending login
+	// whose PKCE verifier doesn't match.
+	_, other := p.Begin("/")
+	_, _, err = p.Finish(t.Context(), other, code)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, oidc.ErrInvalidState)
+
+	// The code was consumed by the failed attempt.
+	_, _, err = p.Finish(t.Context(), state, code)
+	require.Error(t, err)
+}
+
+func TestLoginNonceMismatch(t *testing.T) {
+	mock := newMockProvider(t)
+	p := newProvider(t, mock)
+	mock.nonce = "replayed"
+
+	authURL, state := p.Begin("/")
+	_, code := authorize(t, authURL)
+	_, _, err := p.Finish(t.Context(), state, code)
+	require.ErrorContains(t, err, "nonce")
+}
+
+func TestClaimsUser(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		claims oidc.Claims
+		expect domain.User
+	}{
+		{
+			name:   "preferred_username",
+			claims: oidc.Claims{PreferredUsername: "jd", Email: "x@y.z", Name: "J D"},
+			expect: domain.User{Name: "jd", DisplayName: "J D", Email: "x@y.z"},
+		},
+		{
+			name:   "email",
+			claims: oidc.Claims{Email: "jane@example.com"},
+			expect: domain.User{Name: "jane", Email: "jane@example.com"},
+		},
+		{
+			name:   "none",
+			claims: oidc.Claims{Subject: "1"},
+			expect: domain.User{},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expect, tt.claims.User())
+		})
+	}
+}
+
+func TestLoginEvictsOldest(t *testing.T) {
+	mock := newMockProvider(t)
+	p := newProvider(t, mock)
+
+	oldest, oldestState := p.Begin("/")
+	_, code := authorize(t, oldest)
+	var authURL, state string
+	for range oidc.MaxPendingLogins {
+		authURL, state = p.Begin("/")
+	}
+	_, _, err := p.Finish(t.Context(), oldestState, code)
+	require.ErrorIs(t, err, oidc.ErrInvalidState)
+
+	_, code = authorize(t, authURL)
+	_, _, err = p.Finish(t.Context(), state, code)
+	require.NoError(t, err)
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
 
@@ -12,35 +13,74 @@ import (
 
 func (s *Server) postFormEdit(w http.ResponseWriter, r *http.Request) {
 	var signals struct {
-		Title       string `json:"editTitle"`
-		Description string `json:"editDescription"`
+		Title          string  `json:"editTitle"`
+		Description    string  `json:"editDescription"`
+		Tags           string  `json:"editTags"`
+		Checklist      string  `json:"editChecklist"`
+		Recurrence     string  `json:"editRecurrence"`
+		BlockedBy      string  `json:"editBlockedBy"`
+		Assignees      []int64 `json:"editAssignees"`
+		SelectedTodoID int64   `json:"selectedTodoID"`
 	}
 	err := datastar.ReadSignals(r, &signals)
 	if request.IfErrBadRequest(w, err, "bad signals") {
 		return
 	}
 
-	var msgTitle, msgDescription string
+	var msg template.DialogMessages
 	errVal := domain.Validate(signals.Title, signals.Description)
 	if errVal.IsErr() {
 		if errVal.TitleEmpty {
-			msgTitle = "Title must not be empty"
+			msg.Title = "Title must not be empty"
 		}
 		if errVal.TitleTooLong {
-			msgTitle = "Title is too long"
+			msg.Title = "Title is too long"
 		}
 		if errVal.DescriptionTooLong {
-			msgDescription = "Description is too long"
+			msg.Description = "Description is too long"
 		}
 	} else if request.IfErrInternal(w, err, "") {
 		// Unexpected error.
 		return
 	}
+	msg.Tags = tagsValidationMessage(
+		domain.ValidateTags(domain.ParseTags(signals.Tags)),
+	)
+	msg.Checklist = checklistValidationMessage(
+		domain.ValidateChecklist(domain.ParseChecklist(signals.Checklist)),
+	)
+	msg.Recurrence = recurrenceValidationMessage(
+		domain.ValidateRecurrence(signals.Recurrence),
+	)
+	// Assignees that left the workspace may stay assigned to the todo.
+	var prevAssignees []int64
+	t, err := s.store.Get(r.Context(), signals.SelectedTodoID)
+	if err == nil && t.Workspace == workspaceID(r.Context()) {
+		prevAssignees = t.Assignees
+	} else if !errors.Is(err, domain.ErrNotExists) &&
+		request.IfErrInternal(w, err, "") {
+		return
+	}
+	blockedBy, err := domain.ParseTodoIDs(signals.BlockedBy)
+	if err != nil {
+		err = domain.ErrorValidation{BlockedByInvalid: true}
+	} else {
+		err = s.checkBlockers(r.Context(), blockedBy)
+	}
+	var errBlockedBy domain.ErrorValidation
+	if !errors.As(err, &errBlockedBy) && request.IfErrInternal(w, err, "") {
+		return
+	}
+	err = checkAssignees(r.Context(), signals.Assignees, prevAssignees)
+	var errAssignees domain.ErrorValidation
+	errors.As(err, &errAssignees)
+	msg.BlockedBy = blockedByValidationMessage(errBlockedBy)
+	msg.Assignees = assigneesValidationMessage(errAssignees)
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("datastar-selector", "#el_dialogEdit") // target element
 
-	if err := template.PartDialogEdit(true, msgTitle, msgDescription).
+	if err := template.PartDialogEdit(true, msg, nil).
 		Render(r.Context(), w); err != nil {
 		slog.Error("rendering part dialog new", slog.Any("err", err))
 	}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormEditKeepsAssigneesThatLeft(t *testing.T) {
+	s := newTestServer(t)
+	bob, err := s.users.AddUser(t.Context(), domain.User{Name: "bob"}, "password2")
+	require.NoError(t, err)
+	id, err := s.store.Add(t.Context(), domain.Todo{
+		Workspace: s.workspace, Title: "Pack", Assignees: []int64{bob},
+	})
+	require.NoError(t, err)
+
+	const msgAssignees = "members of the workspace can be assigned"
+	w := s.do(t, http.MethodPost, fmt.Sprintf("/w/%d/form/edit/", s.workspace),
+		fmt.Sprintf(`{"selectedTodoID":%d,"editAssignees":[%d]}`, id, bob))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NotContains(t, w.Body.String(), msgAssignees)
+
+	// A different todo doesn't allow bob.
+	other, err := s.store.Add(t.Context(), domain.Todo{
+		Workspace: s.workspace, Title: "Unpack",
+	})
+	require.NoError(t, err)
+	w = s.do(t, http.MethodPost, fmt.Sprintf("/w/%d/form/edit/", s.workspace),
+		fmt.Sprintf(`{"selectedTodoID":%d,"editAssignees":[%d]}`, other, bob))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Contains(t, w.Body.String(), msgAssignees)
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
 
@@ -12,35 +13,64 @@ import (
 
 func (s *Server) postFormNew(w http.ResponseWriter, r *http.Request) {
 	var signals struct {
-		Title       string `json:"newTitle"`
-		Description string `json:"newDescription"`
+		Title       string  `json:"newTitle"`
+		Description string  `json:"newDescription"`
+		Tags        string  `json:"newTags"`
+		Checklist   string  `json:"newChecklist"`
+		Recurrence  string  `json:"newRecurrence"`
+		BlockedBy   string  `json:"newBlockedBy"`
+		Assignees   []int64 `json:"newAssignees"`
 	}
 	err := datastar.ReadSignals(r, &signals)
 	if request.IfErrBadRequest(w, err, "bad signals") {
 		return
 	}
 
-	var msgTitle, msgDescription string
+	var msg template.DialogMessages
 	errVal := domain.Validate(signals.Title, signals.Description)
 	if errVal.IsErr() {
 		if errVal.TitleEmpty {
-			msgTitle = "Title must not be empty"
+			msg.Title = "Title must not be empty"
 		}
 		if errVal.TitleTooLong {
-			msgTitle = "Title is too long"
+			msg.Title = "Title is too long"
 		}
 		if errVal.DescriptionTooLong {
-			msgDescription = "Description is too long"
+			msg.Description = "Description is too long"
 		}
 	} else if request.IfErrInternal(w, err, "") {
 		// Unexpected error.
 		return
 	}
+	msg.Tags = tagsValidationMessage(
+		domain.ValidateTags(domain.ParseTags(signals.Tags)),
+	)
+	msg.Checklist = checklistValidationMessage(
+		domain.ValidateChecklist(domain.ParseChecklist(signals.Checklist)),
+	)
+	msg.Recurrence = recurrenceValidationMessage(
+		domain.ValidateRecurrence(signals.Recurrence),
+	)
+	blockedBy, err := domain.ParseTodoIDs(signals.BlockedBy)
+	if err != nil {
+		err = domain.ErrorValidation{BlockedByInvalid: true}
+	} else {
+		err = s.checkBlockers(r.Context(), blockedBy)
+	}
+	var errBlockedBy domain.ErrorValidation
+	if !errors.As(err, &errBlockedBy) && request.IfErrInternal(w, err, "") {
+		return
+	}
+	err = checkAssignees(r.Context(), signals.Assignees, nil)
+	var errAssignees domain.ErrorValidation
+	errors.As(err, &errAssignees)
+	msg.BlockedBy = blockedByValidationMessage(errBlockedBy)
+	msg.Assignees = assigneesValidationMessage(errAssignees)
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("datastar-selector", "#el_dialogNew") // target element
 
-	if err := template.PartDialogNew(true, msgTitle, msgDescription).
+	if err := template.PartDialogNew(true, msg).
 		Render(r.Context(), w); err != nil {
 		slog.Error("rendering part dialog new", slog.Any("err", err))
 	}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormNewValidatesWithinWorkspace(t *testing.T) {
+	s := newTestServer(t)
+	other, err := s.workspaces.AddWorkspace(t.Context(), "Work", s.user)
+	require.NoError(t, err)
+	bob, err := s.users.AddUser(t.Context(), domain.User{Name: "bob"}, "password2")
+	require.NoError(t, err)
+	own, err := s.store.Add(t.Context(), domain.Todo{Workspace: s.workspace, Title: "Own"})
+	require.NoError(t, err)
+	foreign, err := s.store.Add(t.Context(), domain.Todo{Workspace: other, Title: "Foreign"})
+	require.NoError(t, err)
+
+	const msgBlockedBy = "active todos like #3, #5 are allowed"
+	const msgAssignees = "members of the workspace can be assigned"
+	for _, td := range []struct {
+		name, signals  string
+		expect, reject []string
+	}{
+		{
+			name:    "valid",
+			signals: fmt.Sprintf(`{"newBlockedBy":"#%d","newAssignees":[%d]}`, own, s.user),
+			reject:  []string{msgBlockedBy, msgAssignees},
+		},
+		{
+			name:    "blocker of other workspace",
+			signals: fmt.Sprintf(`{"newBlockedBy":"#%d"}`, foreign),
+			expect:  []string{msgBlockedBy},
+		},
+		{
+			name:    "unknown blocker",
+			signals: `{"newBlockedBy":"#999"}`,
+			expect:  []string{msgBlockedBy},
+		},
+		{
+			name:    "non-member assignee",
+			signals: fmt.Sprintf(`{"newAssignees":[%d]}`, bob),
+			expect:  []string{msgAssignees},
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			w := s.do(t, http.MethodPost,
+				fmt.Sprintf("/w/%d/form/new/", s.workspace), td.signals)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			for _, msg := range td.expect {
+				require.Contains(t, w.Body.String(), msg)
+			}
+			for _, msg := range td.reject {
+				require.NotContains(t, w.Body.String(), msg)
+			}
+		})
+	}
+}
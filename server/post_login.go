@@ -0,0 +1,62 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/server/middleware"
+	"github.com/romshark/todostar/server/request"
+	"github.com/romshark/todostar/server/template"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+// postLogin starts a new session if the credentials are valid
+// and redirects to the page the user came from.
+func (s *Server) postLogin(w http.ResponseWriter, r *http.Request) {
+	var signals struct {
+		Login struct {
+			Name     string `json:"name"`
+			Password string `json:"password"`
+		} `json:"login"`
+	}
+	err := datastar.ReadSignals(r, &signals)
+	if request.IfErrBadRequest(w, err, "bad signals") {
+		return
+	}
+
+	u, err := s.users.Authenticate(r.Context(),
+		signals.Login.Name, signals.Login.Password)
+	if errors.Is(err, domain.ErrInvalidCredentials) {
+		slog.Info("failed login", slog.String("user", signals.Login.Name))
+		request.SSE(w, r).Patch(
+			template.PartLoginError("Wrong user name or password"),
+			"part login error",
+		)
+		return
+	}
+	if request.IfErrInternal(w, err, "") {
+		return
+	}
+
+	// Don't reuse a session ID that might have been planted.
+	s.sessions.End(request.Session(r))
+	id := s.sessions.Start(u.ID)
+	request.SetSession(w, id, s.sessions.TTL(), s.insecureCookies)
+	slog.Info("login", slog.String("user", u.Name))
+
+	if err := datastar.NewSSE(w, r).Redirect(nextURL(r)); err != nil {
+		slog.Error("redirecting after login", slog.Any("err", err))
+	}
+}
+
+// postLogout ends the session and redirects to the login page.
+func (s *Server) postLogout(w http.ResponseWriter, r *http.Request) {
+	s.sessions.End(request.Session(r))
+	request.ClearSession(w)
+
+	if err := datastar.NewSSE(w, r).Redirect(middleware.PathLogin); err != nil {
+		slog.Error("redirecting after logout", slog.Any("err", err))
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/server/request"
+	"github.com/romshark/todostar/server/template"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+// postMembers sets the role of a member of the workspace.
+// The role "none" removes the member.
+func (s *Server) postMembers(w http.ResponseWriter, r *http.Request) {
+	var signals struct {
+		Member struct {
+			Name string `json:"name"`
+			Role string `json:"role"`
+		} `json:"member"`
+	}
+	err := datastar.ReadSignals(r, &signals)
+	if request.IfErrBadRequest(w, err, "bad signals") {
+		return
+	}
+	role, err := domain.ParseRole(signals.Member.Role)
+	if request.IfErrBadRequest(w, err, "invalid role") {
+		return
+	}
+
+	ws := domain.WorkspaceFrom(r.Context())
+	var errMember string
+	u, err := s.users.GetUserByName(r.Context(), signals.Member.Name)
+	if err == nil {
+		err = s.workspaces.SetRole(r.Context(), ws.ID, u.ID, role)
+	}
+	switch {
+	case errors.Is(err, domain.ErrNotExists):
+		errMember = fmt.Sprintf("There's no user named %q", signals.Member.Name)
+	case errors.Is(err, domain.ErrLastAdmin):
+		errMember = "A workspace must keep at least one admin"
+	case request.IfErrInternal(w, err, ""):
+		return
+	default:
+		slog.Info("set workspace role",
+			slog.Int64("workspace", ws.ID),
+			slog.String("user", u.Name),
+			slog.String("role", role.String()))
+	}
+
+	// Render with the updated workspace.
+	// The user might have just removed themselves from it.
+	ctx, err := s.enterWorkspace(r.Context(), ws.ID, domain.RoleViewer)
+	if errors.Is(err, domain.ErrNotExists) {
+		if err := datastar.NewSSE(w, r).Redirect("/"); err != nil {
+			slog.Error("redirecting after leaving workspace", slog.Any("err", err))
+		}
+		return
+	}
+	if request.IfErrInternal(w, err, "") {
+		return
+	}
+	members, err := s.members(ctx)
+	if request.IfErrInternal(w, err, "") {
+		return
+	}
+	request.SSE(w, r.WithContext(ctx)).Patch(
+		template.ViewMembers(members, errMember), "view members",
+	)
+}
@@ -7,31 +7,45 @@ import (
 	"time"
 
 	"github.com/romshark/todostar/domain"
-	"github.com/romshark/todostar/events"
 	"github.com/romshark/todostar/pkg/timefmt"
 	"github.com/romshark/todostar/server/request"
+	"github.com/romshark/todostar/server/template"
 	"github.com/starfederation/datastar-go/datastar"
 )
 
 func (s *Server) postTodo(w http.ResponseWriter, r *http.Request) {
 	var signals struct {
 		Signals
-		SelectedTodoID int64   `json:"selectedTodoID"`
-		Archived       *bool   `json:"editArchived"`
-		Checked        *bool   `json:"editChecked"`
-		Title          *string `json:"editTitle"`
-		Description    *string `json:"editDescription"`
-		Due            *string `json:"editDue"`
+		SelectedTodoID int64    `json:"selectedTodoID"`
+		Version        int64    `json:"editVersion"`
+		Archived       *bool    `json:"editArchived"`
+		Checked        *bool    `json:"editChecked"`
+		Title          *string  `json:"editTitle"`
+		Description    *string  `json:"editDescription"`
+		Due            *string  `json:"editDue"`
+		Tags           *string  `json:"editTags"`
+		Priority       *string  `json:"editPriority"`
+		Checklist      *string  `json:"editChecklist"`
+		Recurrence     *string  `json:"editRecurrence"`
+		BlockedBy      *string  `json:"editBlockedBy"`
+		Assignees      *[]int64 `json:"editAssignees"`
 	}
 	err := datastar.ReadSignals(r, &signals)
 	if request.IfErrBadRequest(w, err, "bad signals") {
 		return
 	}
 
+	r, ok := s.authorizeTodo(w, r, signals.SelectedTodoID, domain.RoleEditor)
+	if !ok {
+		return
+	}
+
 	var due *time.Time
 	if signals.Due != nil {
 		if *signals.Due != "" {
-			tm, err := time.Parse(timefmt.TimeFormat, *signals.Due)
+			tm, err := time.ParseInLocation(
+				timefmt.TimeFormat, *signals.Due, request.Location(r),
+			)
 			if request.IfErrBadRequest(w, err, "invalid due time") {
 				return
 			}
@@ -41,7 +55,24 @@ func (s *Server) postTodo(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	err = s.store.Edit(r.Context(), signals.SelectedTodoID, func(t *domain.Todo) error {
+	var priority *domain.Priority
+	if signals.Priority != nil {
+		p, err := domain.ParsePriority(*signals.Priority)
+		if request.IfErrBadRequest(w, err, "invalid priority") {
+			return
+		}
+		priority = &p
+	}
+
+	var blockedBy []int64
+	if signals.BlockedBy != nil {
+		blockedBy, err = domain.ParseTodoIDs(*signals.BlockedBy)
+		if request.IfErrBadRequest(w, err, "invalid blockers") {
+			return
+		}
+	}
+
+	mutate := func(t *domain.Todo) error {
 		if signals.Checked != nil {
 			if *signals.Checked {
 				t.Status = domain.StatusDone
@@ -66,9 +97,79 @@ func (s *Server) postTodo(w http.ResponseWriter, r *http.Request) {
 			t.Due = *due
 		}
 
+		if signals.Tags != nil {
+			t.Tags = domain.ParseTags(*signals.Tags)
+		}
+
+		if priority != nil {
+			t.Priority = *priority
+		}
+
+		if signals.Checklist != nil {
+			t.Checklist = domain.ParseChecklist(*signals.Checklist)
+		}
+
+		if signals.Recurrence != nil {
+			t.Recurrence = *signals.Recurrence
+		}
+
+		if signals.BlockedBy != nil {
+			t.BlockedBy = blockedBy
+		}
+
+		if signals.Assignees != nil {
+			err := checkAssignees(r.Context(), *signals.Assignees, t.Assignees)
+			if err != nil {
+				return err
+			}
+			t.Assignees = *signals.Assignees
+		}
+
 		return nil
-	})
+	}
+
+	// Archiving unblocks the todos blocked by the todo.
+	var blocked []int64
+	if signals.Archived != nil && *signals.Archived {
+		blocked, err = s.blockedTodos(r.Context(), signals.SelectedTodoID)
+		if request.IfErrInternal(w, err, "") {
+			return
+		}
+	}
+
+	// Version is only sent when saving the edit dialog,
+	// all other edits are unconditional.
+	c, err := s.editTodo(r.Context(), signals.SelectedTodoID, signals.Version, mutate)
+	var errConflict domain.ErrConflict
+	if errors.As(err, &errConflict) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("datastar-selector", "#el_dialogEdit") // target element
+
+		if err := template.PartDialogEdit(true, template.DialogMessages{}, &errConflict.Current).
+			Render(r.Context(), w); err != nil {
+			slog.Error("rendering part dialog edit", slog.Any("err", err))
+		}
+		return
+	}
 	var errValid domain.ErrorValidation
+	if errors.As(err, &errValid) && (errValid.BlockedByInvalid || errValid.AssigneesInvalid) ||
+		errors.Is(err, domain.ErrDependencyCycle) {
+		msg := template.DialogMessages{
+			BlockedBy: blockedByValidationMessage(errValid),
+			Assignees: assigneesValidationMessage(errValid),
+		}
+		if errors.Is(err, domain.ErrDependencyCycle) {
+			msg.BlockedBy = "A todo can't be blocked by itself, not even through other todos"
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("datastar-selector", "#el_dialogEdit") // target element
+
+		if err := template.PartDialogEdit(true, msg, nil).
+			Render(r.Context(), w); err != nil {
+			slog.Error("rendering part dialog edit", slog.Any("err", err))
+		}
+		return
+	}
 	if errors.As(err, &errValid) {
 		if request.IfErrBadRequest(w, err, "invalid input") {
 			return
@@ -78,6 +179,28 @@ func (s *Server) postTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	n := events.NotifyTodosChanged()
+	label := "Todo updated"
+	switch {
+	case signals.Archived != nil && *signals.Archived:
+		label = "Todo archived"
+	case signals.Archived != nil:
+		label = "Todo restored"
+	case signals.Checked != nil && *signals.Checked:
+		label = "Todo done"
+	case signals.Checked != nil:
+		label = "Todo reopened"
+	case signals.Recurrence != nil && *signals.Recurrence == "":
+		label = "Series ended"
+	}
+	// Undoing the completion of a recurring todo would leave
+	// its next occurrence behind and redoing it would add another.
+	if c.before.Status == domain.StatusDone || c.after.Status != domain.StatusDone ||
+		c.after.Recurrence == "" {
+		e := s.editUndo(label, *c.before, *c.after)
+		s.pushUndo(r, s.reblockUndo(e, signals.SelectedTodoID, blocked))
+	}
+
+	// Edits also archive and restore todos.
+	n := notifyTodoChange(r.Context(), c)
 	slog.Debug("notified todos changed", slog.Int("clients", n))
 }
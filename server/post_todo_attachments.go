@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/events"
+	"github.com/romshark/todostar/server/request"
+	"github.com/romshark/todostar/server/template"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+// attachmentMaxRequestSize leaves room for the multipart headers
+// of a file of domain.AttachmentMaxSize bytes.
+const attachmentMaxRequestSize = domain.AttachmentMaxSize + 64<<10
+
+var errNoFile = errors.New("no file uploaded")
+
+// postTodoAttachments attaches the file uploaded in the multipart form
+// field "file" to the todo in the path.
+func (s *Server) postTodoAttachments(w http.ResponseWriter, r *http.Request) {
+	r, id, ok := s.authorizeTodoPath(w, r, domain.RoleEditor)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, attachmentMaxRequestSize)
+	a, err := s.readAttachment(r)
+	if errTooLarge := new(http.MaxBytesError); errors.As(err, &errTooLarge) {
+		err = domain.ErrorValidation{AttachmentTooLarge: true}
+	}
+	var c todoChange
+	if err == nil {
+		c, err = s.editTodo(r.Context(), id, 0, func(t *domain.Todo) error {
+			if _, ok := t.Attachment(a.Hash); !ok {
+				t.Attachments = append(t.Attachments, a)
+			}
+			return nil
+		})
+	}
+	var errValid domain.ErrorValidation
+	switch {
+	case errors.As(err, &errValid):
+		request.SSE(w, r).Patch(
+			template.PartToast(attachmentValidationMessage(errValid), false, false),
+			"part toast", datastar.WithModeReplace())
+		return
+	case errors.Is(err, errNoFile):
+		request.IfErrBadRequest(w, err, "no file")
+		return
+	case ifErrWorkspace(w, r, err):
+		return
+	}
+
+	s.pushUndo(r, s.editUndo("File attached", *c.before, *c.after))
+
+	n := events.NotifyTodoUpdated(r.Context(), c.before, c.after)
+	slog.Debug("notified todos changed", slog.Int("clients", n))
+}
+
+// readAttachment stores the contents of the first file in the multipart
+// form field "file" of r and returns the attachment for it.
+// The content type is sniffed from the contents rather than trusting
+// the one sent by the browser which is derived from the file extension.
+func (s *Server) readAttachment(r *http.Request) (domain.Attachment, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return domain.Attachment{}, errors.Join(errNoFile, err)
+	}
+	for {
+		p, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return domain.Attachment{}, errNoFile
+		} else if err != nil {
+			return domain.Attachment{}, err
+		}
+		if p.FormName() != "file" || p.FileName() == "" {
+			continue
+		}
+
+		head := make([]byte, 512) // See http.DetectContentType.
+		n, err := io.ReadFull(p, head)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return domain.Attachment{}, err
+		}
+		head = head[:n]
+		contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+		if !slices.Contains(domain.AttachmentTypes, contentType) {
+			return domain.Attachment{}, domain.ErrorValidation{AttachmentTypeInvalid: true}
+		}
+
+		hash, size, err := s.blobs.Put(r.Context(), io.MultiReader(bytes.NewReader(head), p))
+		if err != nil {
+			return domain.Attachment{}, err
+		}
+		return domain.Attachment{
+			Hash:        hash,
+			Name:        domain.AttachmentName(p.FileName()),
+			ContentType: contentType,
+			Size:        size,
+		}, nil
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/events"
+	"github.com/romshark/todostar/server/request"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+var errChecklistItemNotExists = errors.New("checklist item doesn't exist")
+
+// postTodoChecklist checks or unchecks a single checklist item.
+func (s *Server) postTodoChecklist(w http.ResponseWriter, r *http.Request) {
+	var signals struct {
+		SelectedTodoID int64 `json:"selectedTodoID"`
+		// Version is the version of the todo the item index refers to.
+		Version int64 `json:"checklistVersion"`
+		Item    int   `json:"checklistItem"`
+		Done    bool  `json:"checklistDone"`
+	}
+	err := datastar.ReadSignals(r, &signals)
+	if request.IfErrBadRequest(w, err, "bad signals") {
+		return
+	}
+
+	r, ok := s.authorizeTodo(w, r, signals.SelectedTodoID, domain.RoleEditor)
+	if !ok {
+		return
+	}
+
+	c, err := s.editTodo(r.Context(), signals.SelectedTodoID, signals.Version,
+		func(t *domain.Todo) error {
+			if signals.Item < 0 || signals.Item >= len(t.Checklist) {
+				return errChecklistItemNotExists
+			}
+			t.Checklist[signals.Item].Done = signals.Done
+			return nil
+		})
+	var errConflict domain.ErrConflict
+	if errors.As(err, &errConflict) {
+		// The checklist changed in the meantime and the client
+		// is about to receive the current one.
+		http.Error(w, "todo changed", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, errChecklistItemNotExists) {
+		if request.IfErrBadRequest(w, err, "invalid checklist item") {
+			return
+		}
+	}
+	if request.IfErrInternal(w, err, "") {
+		return
+	}
+
+	label := "Subtask reopened"
+	if signals.Done {
+		label = "Subtask done"
+	}
+	s.pushUndo(r, s.editUndo(label, *c.before, *c.after))
+
+	n := events.NotifyTodoUpdated(r.Context(), c.before, c.after)
+	slog.Debug("notified todos changed", slog.Int("clients", n))
+}
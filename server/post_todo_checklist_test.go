@@ -0,0 +1,74 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/events"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecklistToggleUndo(t *testing.T) {
+	s := newTestServer(t)
+	id, err := s.store.Add(t.Context(), domain.Todo{
+		Workspace: s.workspace,
+		Title:     "Pack",
+		Checklist: []domain.ChecklistItem{{Title: "passport"}, {Title: "charger"}},
+	})
+	require.NoError(t, err)
+
+	w := s.do(t, http.MethodPost, "/todo/checklist/", fmt.Sprintf(
+		`{"selectedTodoID":%d,"checklistVersion":1,"checklistItem":1,"checklistDone":true}`,
+		id))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	todo, err := s.store.Get(t.Context(), id)
+	require.NoError(t, err)
+	require.True(t, todo.Checklist[1].Done)
+
+	w = s.do(t, http.MethodPost, "/undo/", `{}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	todo, err = s.store.Get(t.Context(), id)
+	require.NoError(t, err)
+	require.Equal(t, []domain.ChecklistItem{
+		{Title: "passport"}, {Title: "charger"},
+	}, todo.Checklist)
+
+	w = s.do(t, http.MethodPost, "/redo/", `{}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	todo, err = s.store.Get(t.Context(), id)
+	require.NoError(t, err)
+	require.True(t, todo.Checklist[1].Done, "redone")
+	require.Equal(t, int64(4), todo.Version)
+}
+
+func TestChecklistToggleSnapshots(t *testing.T) {
+	s := newTestServer(t)
+	id, err := s.store.Add(t.Context(), domain.Todo{
+		Workspace: s.workspace,
+		Title:     "Pack",
+		Checklist: []domain.ChecklistItem{{Title: "passport"}},
+	})
+	require.NoError(t, err)
+
+	received := make(chan events.EventTodosChanged, 1)
+	sub := events.OnTodosChanged(s.workspace, 0, func(e events.EventTodosChanged) {
+		received <- e
+	})
+	defer sub.Close()
+
+	w := s.do(t, http.MethodPost, "/todo/checklist/", fmt.Sprintf(
+		`{"selectedTodoID":%d,"checklistItem":0,"checklistDone":true}`, id))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	e := <-received
+	require.Equal(t, events.TodoUpdated, e.Kind)
+	require.Equal(t, []int64{id}, e.IDs)
+	require.Equal(t, "alice", e.Actor)
+	require.Equal(t, int64(1), e.Before.Version)
+	require.False(t, e.Before.Checklist[0].Done)
+	committed, err := s.store.Get(t.Context(), id)
+	require.NoError(t, err)
+	require.Equal(t, committed, e.After, "snapshot of the committed todo")
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/events"
+	"github.com/romshark/todostar/server/request"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+func (s *Server) postTodoMove(w http.ResponseWriter, r *http.Request) {
+	var signals struct {
+		SelectedTodoID int64 `json:"selectedTodoID,omitempty"`
+		// MoveAfter is the ID of the todo to move the selected todo after,
+		// 0 moves it to the top.
+		MoveAfter int64 `json:"moveAfter,omitempty"`
+	}
+	err := datastar.ReadSignals(r, &signals)
+	if request.IfErrBadRequest(w, err, "bad signals") {
+		return
+	}
+
+	r, ok := s.authorizeTodo(w, r, signals.SelectedTodoID, domain.RoleEditor)
+	if !ok {
+		return
+	}
+
+	if signals.MoveAfter != 0 {
+		after, err := s.store.Get(r.Context(), signals.MoveAfter)
+		if err == nil && after.Workspace != workspaceID(r.Context()) {
+			err = errForbidden
+		}
+		if request.IfErrBadRequest(w, err, "invalid todo to move after") {
+			return
+		}
+	}
+
+	c, err := s.changeTodo(r.Context(), signals.SelectedTodoID,
+		func(ctx context.Context) error {
+			return s.store.Move(ctx, signals.SelectedTodoID, signals.MoveAfter)
+		})
+	if request.IfErrInternal(w, err, "") {
+		return
+	}
+
+	n := events.NotifyTodoUpdated(r.Context(), c.before, c.after)
+	slog.Debug("notified todos changed", slog.Int("clients", n))
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/events"
+	"github.com/romshark/todostar/server/request"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+// postTodoSkip moves a recurring todo to its next occurrence
+// without completing it.
+func (s *Server) postTodoSkip(w http.ResponseWriter, r *http.Request) {
+	var signals struct {
+		SelectedTodoID int64 `json:"selectedTodoID"`
+	}
+	err := datastar.ReadSignals(r, &signals)
+	if request.IfErrBadRequest(w, err, "bad signals") {
+		return
+	}
+
+	r, ok := s.authorizeTodo(w, r, signals.SelectedTodoID, domain.RoleEditor)
+	if !ok {
+		return
+	}
+
+	c, err := s.editTodo(r.Context(), signals.SelectedTodoID, 0,
+		func(t *domain.Todo) error {
+			return t.Skip(domain.LocationFrom(r.Context()))
+		})
+	if errors.Is(err, domain.ErrSeriesEnded) {
+		if request.IfErrBadRequest(w, err, "no next occurrence") {
+			return
+		}
+	}
+	if request.IfErrInternal(w, err, "") {
+		return
+	}
+	s.pushUndo(r, s.editUndo("Occurrence skipped", *c.before, *c.after))
+
+	n := events.NotifyTodoUpdated(r.Context(), c.before, c.after)
+	slog.Debug("notified todos changed", slog.Int("clients", n))
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/events"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompleteRecurringSnapshots(t *testing.T) {
+	s := newTestServer(t)
+	id, err := s.store.Add(t.Context(), domain.Todo{
+		Workspace:  s.workspace,
+		Title:      "Water plants",
+		Due:        time.Now().Add(time.Hour),
+		Recurrence: "FREQ=DAILY",
+	})
+	require.NoError(t, err)
+
+	received := make(chan events.EventTodosChanged, 2)
+	sub := events.OnTodosChanged(s.workspace, 0, func(e events.EventTodosChanged) {
+		received <- e
+	})
+	defer sub.Close()
+
+	w := s.do(t, http.MethodPost, "/todo/",
+		fmt.Sprintf(`{"selectedTodoID":%d,"editChecked":true}`, id))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	e := <-received
+	require.Equal(t, events.TodoUpdated, e.Kind)
+	require.Equal(t, []int64{id}, e.IDs)
+
+	e = <-received
+	require.Equal(t, events.TodoCreated, e.Kind)
+	require.Len(t, e.IDs, 1)
+	next, err := s.store.Get(t.Context(), e.IDs[0])
+	require.NoError(t, err)
+	require.Equal(t, "Water plants", next.Title)
+	require.Equal(t, domain.StatusOpen, next.Status)
+	require.Equal(t, next, e.After, "snapshot of the next occurrence")
+}
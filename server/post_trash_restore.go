@@ -0,0 +1,39 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/events"
+	"github.com/romshark/todostar/server/request"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+func (s *Server) postTrashRestore(w http.ResponseWriter, r *http.Request) {
+	var signals struct {
+		SelectedTodoID int64 `json:"selectedTodoID,omitempty"`
+	}
+	err := datastar.ReadSignals(r, &signals)
+	if request.IfErrBadRequest(w, err, "bad signals") {
+		return
+	}
+
+	r, ok := s.authorizeTodo(w, r, signals.SelectedTodoID, domain.RoleEditor)
+	if !ok {
+		return
+	}
+
+	c, err := s.changeTodo(r.Context(), signals.SelectedTodoID,
+		func(ctx context.Context) error {
+			return s.store.Restore(ctx, signals.SelectedTodoID)
+		})
+	if request.IfErrInternal(w, err, "") {
+		return
+	}
+	s.pushUndo(r, s.restoreUndo(signals.SelectedTodoID))
+
+	n := events.NotifyTodoRestored(r.Context(), c.before, c.after)
+	slog.Debug("notified todos changed", slog.Int("clients", n))
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/romshark/todostar/events"
+	"github.com/romshark/todostar/server/request"
+)
+
+func (s *Server) postUndo(w http.ResponseWriter, r *http.Request) {
+	session := request.Session(r)
+	entry, c, err := s.undo.undo(r.Context(), session, s.allowUndo(r.Context()))
+	e := events.EventUndo{Session: session}
+	switch {
+	case errors.Is(err, errNothingToUndo):
+		e.Message = "Nothing to undo"
+	case errors.Is(err, errForbidden):
+		e.Message = "Can't undo, your role no longer allows editing"
+	case isUndoConflict(err):
+		e.Message = "Can't undo, the todo was changed in the meantime"
+	case request.IfErrInternal(w, err, ""):
+		return
+	default:
+		e.Message, e.CanRedo = "Undone: "+entry.label, true
+		n := notifyTodoChange(r.Context(), c)
+		slog.Debug("notified todos changed", slog.Int("clients", n))
+	}
+	events.NotifyUndo(e)
+}
+
+func (s *Server) postRedo(w http.ResponseWriter, r *http.Request) {
+	session := request.Session(r)
+	entry, c, err := s.undo.redo(r.Context(), session, s.allowUndo(r.Context()))
+	e := events.EventUndo{Session: session}
+	switch {
+	case errors.Is(err, errNothingToRedo):
+		e.Message = "Nothing to redo"
+	case errors.Is(err, errForbidden):
+		e.Message = "Can't redo, your role no longer allows editing"
+	case isUndoConflict(err):
+		e.Message = "Can't redo, the todo was changed in the meantime"
+	case request.IfErrInternal(w, err, ""):
+		return
+	default:
+		e.Message, e.CanUndo = entry.label, true
+		n := notifyTodoChange(r.Context(), c)
+		slog.Debug("notified todos changed", slog.Int("clients", n))
+	}
+	events.NotifyUndo(e)
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/server/request"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+// postWorkspaces creates a new workspace administrated by the user
+// and redirects to it.
+func (s *Server) postWorkspaces(w http.ResponseWriter, r *http.Request) {
+	var signals struct {
+		Name string `json:"workspaceName"`
+	}
+	err := datastar.ReadSignals(r, &signals)
+	if request.IfErrBadRequest(w, err, "bad signals") {
+		return
+	}
+
+	u := domain.UserFrom(r.Context())
+	id, err := s.workspaces.AddWorkspace(r.Context(), signals.Name, u.ID)
+	var errValid domain.ErrorValidationWorkspace
+	if errors.As(err, &errValid) {
+		if request.IfErrBadRequest(w, err, "invalid workspace name") {
+			return
+		}
+	}
+	if request.IfErrInternal(w, err, "") {
+		return
+	}
+	slog.Info("added workspace",
+		slog.Int64("workspace", id), slog.String("admin", u.Name))
+
+	if err := datastar.NewSSE(w, r).Redirect(fmt.Sprintf("/w/%d/", id)); err != nil {
+		slog.Error("redirecting to new workspace", slog.Any("err", err))
+	}
+}
@@ -17,9 +17,15 @@ import (
 func (s *Server) putTodo(w http.ResponseWriter, r *http.Request) {
 	var signals struct {
 		Signals
-		Title       string `json:"newTitle"`
-		Description string `json:"newDescription"`
-		Due         string `json:"newDue"`
+		Title       string  `json:"newTitle"`
+		Description string  `json:"newDescription"`
+		Due         string  `json:"newDue"`
+		Tags        string  `json:"newTags"`
+		Priority    string  `json:"newPriority"`
+		Checklist   string  `json:"newChecklist"`
+		Recurrence  string  `json:"newRecurrence"`
+		BlockedBy   string  `json:"newBlockedBy"`
+		Assignees   []int64 `json:"newAssignees"`
 	}
 	err := datastar.ReadSignals(r, &signals)
 	if request.IfErrBadRequest(w, err, "bad signals") {
@@ -28,32 +34,61 @@ func (s *Server) putTodo(w http.ResponseWriter, r *http.Request) {
 
 	var dueTime time.Time
 	if signals.Due != "" {
-		dueTime, err = time.Parse(timefmt.TimeFormat, signals.Due)
+		dueTime, err = time.ParseInLocation(
+			timefmt.TimeFormat, signals.Due, request.Location(r),
+		)
 		if request.IfErrBadRequest(w, err, "invalid due time") {
 			return
 		}
 	}
 
-	_, err = s.store.Add(
-		r.Context(), signals.Title, signals.Description, time.Now(), dueTime,
-	)
+	priority, err := domain.ParsePriority(signals.Priority)
+	if request.IfErrBadRequest(w, err, "invalid priority") {
+		return
+	}
+
+	var id int64
+	blockedBy, err := domain.ParseTodoIDs(signals.BlockedBy)
+	if err != nil {
+		err = domain.ErrorValidation{BlockedByInvalid: true}
+	} else if err = checkAssignees(r.Context(), signals.Assignees, nil); err == nil {
+		id, err = s.store.Add(r.Context(), domain.Todo{
+			Workspace:   workspaceID(r.Context()),
+			Title:       signals.Title,
+			Description: signals.Description,
+			Tags:        domain.ParseTags(signals.Tags),
+			Priority:    priority,
+			Checklist:   domain.ParseChecklist(signals.Checklist),
+			Recurrence:  signals.Recurrence,
+			BlockedBy:   blockedBy,
+			Assignees:   signals.Assignees,
+			Created:     time.Now(),
+			Due:         dueTime,
+		})
+	}
 	var errValid domain.ErrorValidation
 	if errors.As(err, &errValid) {
-		var msgTitle, msgDescription string
+		msg := template.DialogMessages{
+			Tags:       tagsValidationMessage(errValid),
+			Checklist:  checklistValidationMessage(errValid),
+			Recurrence: recurrenceValidationMessage(errValid),
+			BlockedBy:  blockedByValidationMessage(errValid),
+			Assignees:  assigneesValidationMessage(errValid),
+		}
 		if errValid.TitleEmpty {
-			msgTitle = "Title must not be empty"
+			msg.Title = "Title must not be empty"
 		}
 		if errValid.TitleTooLong {
-			msgTitle = "Title is too long"
+			msg.Title = "Title is too long"
 		}
 		if errValid.DescriptionTooLong {
-			msgDescription = "Description is too long"
+			msg.Description = "Description is too long"
 		}
 
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.Header().Set("datastar-selector", "#el_dialogNew") // target element
 
-		if err := template.PartDialogNew(true, msgTitle, msgDescription).
+		if err := template.PartDialogNew(true, msg).
 			Render(r.Context(), w); err != nil {
 			slog.Error("rendering part dialog new", slog.Any("err", err))
 		}
@@ -61,7 +96,11 @@ func (s *Server) putTodo(w http.ResponseWriter, r *http.Request) {
 	} else if request.IfErrInternal(w, err, "") {
 		return
 	}
+	t, err := s.store.Get(r.Context(), id)
+	if request.IfErrInternal(w, err, "") {
+		return
+	}
 
-	n := events.NotifyTodosChanged()
+	n := events.NotifyTodoCreated(r.Context(), t)
 	slog.Debug("notified todos changed", slog.Int("clients", n))
 }
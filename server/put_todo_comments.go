@@ -0,0 +1,51 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/events"
+	"github.com/romshark/todostar/server/request"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+func (s *Server) putTodoComments(w http.ResponseWriter, r *http.Request) {
+	var signals struct {
+		SelectedTodoID int64 `json:"selectedTodoID"`
+		Comment        struct {
+			Text string `json:"text"`
+		} `json:"comment"`
+	}
+	err := datastar.ReadSignals(r, &signals)
+	if request.IfErrBadRequest(w, err, "bad signals") {
+		return
+	}
+
+	r, ok := s.authorizeTodo(w, r, signals.SelectedTodoID, domain.RoleEditor)
+	if !ok {
+		return
+	}
+
+	_, err = s.store.AddComment(r.Context(), domain.Comment{
+		TodoID: signals.SelectedTodoID,
+		Author: domain.UserFrom(r.Context()).ID,
+		Text:   signals.Comment.Text,
+	})
+	var errValid domain.ErrorValidation
+	if errors.As(err, &errValid) {
+		s.patchComments(w, r, signals.SelectedTodoID, commentValidationMessage(errValid))
+		return
+	} else if ifErrWorkspace(w, r, err) {
+		return
+	}
+
+	n := events.NotifyCommentsChanged(workspaceID(r.Context()), signals.SelectedTodoID)
+	slog.Debug("notified comments changed", slog.Int("clients", n))
+
+	if sse, ok := s.patchComments(w, r, signals.SelectedTodoID, ""); ok {
+		sse.PatchSignals(map[string]any{"comment": map[string]any{"text": ""}},
+			"comment text")
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"slices"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/events"
+)
+
+// renderedList is the state of a list of todos last rendered to a client.
+// Changes are patched into it item by item as long as the todos
+// that remain in the list keep their order and new todos are appended,
+// otherwise the list is rendered anew, see diff.
+type renderedList struct {
+	// positional is true if items render their position in the list
+	// and the todo above them and need to be patched when those change.
+	positional bool
+	ids        []int64
+	versions   map[int64]int64
+	// blockers are the open blockers of each todo, see searchTodos.
+	blockers map[int64][]int64
+}
+
+func newRenderedList(
+	positional bool, todos []*domain.Todo, blockers map[int64][]int64,
+) *renderedList {
+	l := &renderedList{positional: positional}
+	l.set(todos, blockers)
+	return l
+}
+
+// set records todos with their blockers as rendered.
+func (l *renderedList) set(todos []*domain.Todo, blockers map[int64][]int64) {
+	l.ids = make([]int64, len(todos))
+	l.versions = make(map[int64]int64, len(todos))
+	for i, t := range todos {
+		l.ids[i] = t.ID
+		l.versions[t.ID] = t.Version
+	}
+	l.blockers = blockers
+}
+
+// diff returns the IDs of the rendered todos missing from todos
+// and the number of todos at the start of todos that were rendered already.
+// The todos after those are new and to be appended.
+// ok is false if todos must be rendered anew because the changes of e
+// are unknown, the remaining todos changed their order,
+// new todos are inserted in between or the list was or becomes empty.
+func (l *renderedList) diff(
+	e events.EventTodosChanged, todos []*domain.Todo,
+) (removed []int64, kept int, ok bool) {
+	if e.Unknown() || len(l.ids) == 0 || len(todos) == 0 {
+		return nil, 0, false
+	}
+	in := make(map[int64]bool, len(todos))
+	for _, t := range todos {
+		in[t.ID] = true
+	}
+	for _, id := range l.ids {
+		if !in[id] {
+			removed = append(removed, id)
+			continue
+		}
+		if todos[kept].ID != id {
+			return nil, 0, false
+		}
+		kept++
+	}
+	return removed, kept, true
+}
+
+// changed returns true if the rendered todo at index i of todos,
+// which was rendered before, has to be patched after the changes of e.
+func (l *renderedList) changed(
+	e events.EventTodosChanged, todos []*domain.Todo, i int, blockers []int64,
+) bool {
+	t := todos[i]
+	if slices.Contains(e.IDs, t.ID) || l.versions[t.ID] != t.Version ||
+		!slices.Equal(l.blockers[t.ID], blockers) {
+		return true
+	}
+	if !l.positional {
+		return false
+	}
+	// Kept todos can only move up when todos above them are removed.
+	prev := slices.Index(l.ids, t.ID)
+	return prev != i
+}
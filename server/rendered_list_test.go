@@ -0,0 +1,264 @@
+package server
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/events"
+	"github.com/romshark/todostar/server/request"
+	"github.com/stretchr/testify/require"
+)
+
+// testTodos returns todos ids at version 1.
+func testTodos(ids ...int64) []*domain.Todo {
+	todos := make([]*domain.Todo, len(ids))
+	for i, id := range ids {
+		todos[i] = &domain.Todo{ID: id, Version: 1}
+	}
+	return todos
+}
+
+func TestRenderedListDiff(t *testing.T) {
+	updated := events.EventTodosChanged{Kind: events.TodoUpdated, IDs: []int64{2}}
+	for _, td := range []struct {
+		name          string
+		rendered      []int64
+		e             events.EventTodosChanged
+		todos         []int64
+		expectRemoved []int64
+		expectKept    int
+		expectOK      bool
+	}{
+		{
+			name:       "unchanged",
+			rendered:   []int64{1, 2, 3},
+			e:          updated,
+			todos:      []int64{1, 2, 3},
+			expectKept: 3, expectOK: true,
+		},
+		{
+			name:       "appended",
+			rendered:   []int64{1, 2},
+			e:          updated,
+			todos:      []int64{1, 2, 3},
+			expectKept: 2, expectOK: true,
+		},
+		{
+			name:          "removed",
+			rendered:      []int64{1, 2, 3},
+			e:             updated,
+			todos:         []int64{1, 3},
+			expectRemoved: []int64{2},
+			expectKept:    2, expectOK: true,
+		},
+		{
+			name:          "removed and appended",
+			rendered:      []int64{1, 2, 3},
+			e:             updated,
+			todos:         []int64{2, 3, 4},
+			expectRemoved: []int64{1},
+			expectKept:    2, expectOK: true,
+		},
+		{
+			name:     "reordered",
+			rendered: []int64{1, 2, 3},
+			e:        updated,
+			todos:    []int64{1, 3, 2},
+		},
+		{
+			name:     "inserted",
+			rendered: []int64{1, 2},
+			e:        updated,
+			todos:    []int64{1, 3, 2},
+		},
+		{
+			name:     "unknown",
+			rendered: []int64{1, 2},
+			e:        events.EventTodosChanged{},
+			todos:    []int64{1, 2},
+		},
+		{
+			name:  "was empty",
+			e:     updated,
+			todos: []int64{1},
+		},
+		{
+			name:     "becomes empty",
+			rendered: []int64{1},
+			e:        updated,
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			l := newRenderedList(false, testTodos(td.rendered...), nil)
+			removed, kept, ok := l.diff(td.e, testTodos(td.todos...))
+			require.Equal(t, td.expectOK, ok)
+			require.Equal(t, td.expectRemoved, removed)
+			require.Equal(t, td.expectKept, kept)
+		})
+	}
+}
+
+func TestRenderedListChanged(t *testing.T) {
+	other := events.EventTodosChanged{Kind: events.TodoUpdated, IDs: []int64{9}}
+	for _, td := range []struct {
+		name       string
+		positional bool
+		e          events.EventTodosChanged
+		todos      []*domain.Todo
+		i          int
+		blockers   []int64
+		expect     bool
+	}{
+		{
+			name:  "untouched",
+			e:     other,
+			todos: testTodos(1, 2, 3),
+			i:     1,
+		},
+		{
+			name:   "in event",
+			e:      events.EventTodosChanged{Kind: events.TodoUpdated, IDs: []int64{2}},
+			todos:  testTodos(1, 2, 3),
+			i:      1,
+			expect: true,
+		},
+		{
+			name: "new version",
+			e:    other,
+			todos: []*domain.Todo{
+				{ID: 1, Version: 1}, {ID: 2, Version: 2}, {ID: 3, Version: 1},
+			},
+			i:      1,
+			expect: true,
+		},
+		{
+			name:     "blockers unchanged",
+			e:        other,
+			todos:    testTodos(1, 2, 3),
+			i:        2,
+			blockers: []int64{1},
+		},
+		{
+			name:   "blocker done",
+			e:      other,
+			todos:  testTodos(1, 2, 3),
+			i:      2,
+			expect: true,
+		},
+		{
+			name:  "moved up",
+			e:     other,
+			todos: testTodos(2, 3),
+			i:     0,
+		},
+		{
+			name:       "moved up positional",
+			positional: true,
+			e:          other,
+			todos:      testTodos(2, 3),
+			i:          0,
+			expect:     true,
+		},
+		{
+			name:       "kept position positional",
+			positional: true,
+			e:          other,
+			todos:      testTodos(1, 3),
+			i:          0,
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			l := newRenderedList(td.positional, testTodos(1, 2, 3),
+				map[int64][]int64{3: {1}})
+			require.Equal(t, td.expect, l.changed(td.e, td.todos, td.i, td.blockers))
+		})
+	}
+}
+
+func TestPatchTodos(t *testing.T) {
+	updated := events.EventTodosChanged{Kind: events.TodoUpdated, IDs: []int64{2}}
+	summary := []string{"patch todos-summary", "patch tag-facets"}
+	for _, td := range []struct {
+		name   string
+		e      events.EventTodosChanged
+		todos  []int64
+		expect []string
+	}{
+		{
+			name:   "updated",
+			e:      updated,
+			todos:  []int64{1, 2, 3},
+			expect: append([]string{"patch todo-2"}, summary...),
+		},
+		{
+			name:  "removed and appended",
+			e:     updated,
+			todos: []int64{2, 3, 4},
+			expect: append([]string{
+				"remove #todo-1",
+				// Positions of the todos moving up changed.
+				"patch todo-2", "patch todo-3",
+				"append #todos-list todo-4",
+			}, summary...),
+		},
+		{
+			name:   "reordered",
+			e:      updated,
+			todos:  []int64{3, 1, 2},
+			expect: []string{"patch todos"},
+		},
+		{
+			name:   "unknown",
+			e:      events.EventTodosChanged{},
+			todos:  []int64{1, 2, 3},
+			expect: []string{"patch todos"},
+		},
+		{
+			name:   "emptied",
+			e:      updated,
+			expect: []string{"patch todos"},
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			sse := request.SSE(w, httptest.NewRequestWithContext(
+				t.Context(), "GET", "/", nil))
+			l := newRenderedList(true, testTodos(1, 2, 3), nil)
+			todos := testTodos(td.todos...)
+			patchTodos(sse, l, td.e, todos, nil, nil)
+			require.Equal(t, td.expect, patches(w.Body.String()))
+
+			// The patched todos are rendered now.
+			_, kept, ok := l.diff(updated, todos)
+			require.Equal(t, len(todos) > 0, ok)
+			require.Equal(t, len(todos), kept)
+		})
+	}
+}
+
+var elementID = regexp.MustCompile(`^<[a-z]+ id="([^"]+)"`)
+
+// patches returns the Datastar element patches of the event stream body
+// as "<mode> [selector] [element ID]".
+func patches(body string) (p []string) {
+	for _, e := range strings.Split(body, "event: ")[1:] {
+		mode, fields, elements := "patch", []string{}, false
+		for _, line := range strings.Split(e, "\n") {
+			if m, ok := strings.CutPrefix(line, "data: mode "); ok {
+				mode = m
+			} else if s, ok := strings.CutPrefix(line, "data: selector "); ok {
+				fields = append(fields, s)
+			} else if el, ok := strings.CutPrefix(line, "data: elements "); ok && !elements {
+				elements = true // Only the first line has the root element.
+				if m := elementID.FindStringSubmatch(el); m != nil {
+					fields = append(fields, m[1])
+				}
+			}
+		}
+		p = append(p, strings.Join(append([]string{mode}, fields...), " "))
+	}
+	return p
+}
@@ -3,6 +3,7 @@ package request
 import (
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/a-h/templ"
 	"github.com/starfederation/datastar-go/datastar"
@@ -47,6 +48,20 @@ func ThemeIsDark(r *http.Request) bool {
 	return true
 }
 
+// Location reads the IANA time zone name of the user from the cookie "tz"
+// and returns time.Local if there is none or it's unknown.
+func Location(r *http.Request) *time.Location {
+	c, err := r.Cookie("tz")
+	if err != nil || c.Value == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(c.Value)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
 type SSEHandle struct {
 	sse *datastar.ServerSentEventGenerator
 }
@@ -67,5 +82,70 @@ func (h SSEHandle) Patch(
 	return true
 }
 
+// Remove removes the elements matching selector from the page.
+func (h SSEHandle) Remove(selector, name string) (ok bool) {
+	if err := h.sse.RemoveElement(selector); err != nil {
+		slog.Error("remove", slog.String("element", name), slog.Any("err", err))
+		return false
+	}
+	return true
+}
+
+// PatchSignals patches the signals on the page with signals
+// marshaled to JSON.
+func (h SSEHandle) PatchSignals(signals any, name string) (ok bool) {
+	if err := h.sse.MarshalAndPatchSignals(signals); err != nil {
+		slog.Error("patch signals", slog.String("signals", name), slog.Any("err", err))
+		return false
+	}
+	return true
+}
+
+// Redirect navigates the page to url.
+func (h SSEHandle) Redirect(url string) (ok bool) {
+	if err := h.sse.Redirect(url); err != nil {
+		slog.Error("redirect", slog.String("url", url), slog.Any("err", err))
+		return false
+	}
+	return true
+}
+
 // Wait waits until the sse request is canceled.
 func (h SSEHandle) Wait() { <-h.sse.Context().Done() }
+
+const cookieSession = "session"
+
+// Session returns the session ID from the "session" cookie
+// or "" if there is none.
+func Session(r *http.Request) string {
+	c, err := r.Cookie(cookieSession)
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+// SetSession sets the "session" cookie to session id for maxAge.
+// The cookie is only sent over HTTPS unless insecure is true.
+func SetSession(w http.ResponseWriter, id string, maxAge time.Duration, insecure bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieSession,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   !insecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearSession removes the "session" cookie.
+func ClearSession(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieSession,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -2,14 +2,20 @@ package server
 
 import (
 	"embed"
+	"fmt"
 	"io/fs"
 	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/events"
 	"github.com/romshark/todostar/server/middleware"
+	"github.com/romshark/todostar/server/oidc"
+	"github.com/romshark/todostar/server/request"
+	"github.com/romshark/todostar/server/session"
 )
 
 // TODO: instead of doing `if request.IfErrInternal(w, err, "") { return }``
@@ -21,9 +27,55 @@ const SSEHeartBeatDur = 25 * time.Second
 //go:embed static/*
 var staticFS embed.FS
 
-func New(store *domain.Store, accessLog bool) *Server {
+// Config configures a Server.
+type Config struct {
+	// AccessLog enables access logs.
+	AccessLog bool
+
+	// UndoDeleteWindow is how long moving todos to the trash can be undone.
+	UndoDeleteWindow time.Duration
+
+	// TrashRetention is how long todos are kept in the trash
+	// before they're deleted permanently. Zero means forever.
+	TrashRetention time.Duration
+
+	// SessionTTL is how long login sessions last without activity.
+	SessionTTL time.Duration
+
+	// InsecureCookies allows sending the session cookie over plain HTTP.
+	// Browsers treat localhost as secure so it's only required
+	// when serving other hosts without TLS.
+	InsecureCookies bool
+
+	// OIDC enables single sign-on through an OpenID Connect provider
+	// if not nil. Users are provisioned on their first login.
+	OIDC *oidc.Provider
+
+	// DisablePasswordLogin only allows logging in through OIDC.
+	DisablePasswordLogin bool
+
+	// RefreshWindow is the window within which changes to todos are merged
+	// into a single refresh of the views, see events.OnTodosChanged.
+	RefreshWindow time.Duration
+}
+
+func New(
+	store domain.Store, users domain.UserStore, workspaces domain.WorkspaceStore,
+	blobs domain.BlobStore, conf Config,
+) *Server {
 	s := &Server{
-		store: store,
+		store:            store,
+		users:            users,
+		workspaces:       workspaces,
+		blobs:            blobs,
+		sessions:         session.New(conf.SessionTTL),
+		insecureCookies:  conf.InsecureCookies,
+		oidc:             conf.OIDC,
+		passwordLogin:    !conf.DisablePasswordLogin,
+		undo:             newUndoStacks(),
+		undoDeleteWindow: conf.UndoDeleteWindow,
+		trashRetention:   conf.TrashRetention,
+		refreshWindow:    conf.RefreshWindow,
 	}
 	m := http.NewServeMux()
 
@@ -47,15 +99,21 @@ func New(store *domain.Store, accessLog bool) *Server {
 		getStatic = middleware.Brotli(getStatic, 9)
 	}
 
-	newHandler := func(pattern string, h http.HandlerFunc) {
-		handler := http.Handler(h)
-		handler = middleware.Brotli(handler, 9)
-		if accessLog {
+	newPublicHandler := func(pattern string, h http.Handler) {
+		handler := middleware.Brotli(h, 9)
+		if conf.AccessLog {
 			handler = middleware.AccessLog(h)
 		}
 		m.Handle(pattern, handler)
 	}
 
+	// newHandler registers h for logged in users only.
+	newHandler := func(pattern string, h http.HandlerFunc) {
+		newPublicHandler(pattern, middleware.Auth(
+			withLocation(h), s.sessions, s.users, s.insecureCookies,
+		))
+	}
+
 	// Assets
 	m.Handle("GET /static/", http.StripPrefix("/static/", getStatic))
 
@@ -63,28 +121,101 @@ func New(store *domain.Store, accessLog bool) *Server {
 	m.HandleFunc("GET /livez/{$}", s.getLivez)
 	m.HandleFunc("GET /readyz/{$}", s.getReadyz)
 
+	// Monitoring
+	newHandler("GET /metrics/{$}", s.getMetrics)
+
+	// Authentication
+	newPublicHandler("GET /login/{$}", http.HandlerFunc(s.getLogin))
+	if s.passwordLogin {
+		newPublicHandler("POST /login/{$}", http.HandlerFunc(s.postLogin))
+	}
+	if s.oidc != nil {
+		newPublicHandler("GET /login/oidc/{$}", http.HandlerFunc(s.getLoginOIDC))
+		newPublicHandler("GET /login/oidc/callback/{$}",
+			http.HandlerFunc(s.getLoginOIDCCallback))
+	}
+	newHandler("POST /logout/{$}", s.postLogout)
+
+	// newFileHandler registers h for logged in users only like newHandler
+	// but without compression since files are served with their length
+	// and most of them are compressed already.
+	newFileHandler := func(pattern string, h http.HandlerFunc) {
+		handler := middleware.Auth(h, s.sessions, s.users, s.insecureCookies)
+		if conf.AccessLog {
+			handler = middleware.AccessLog(handler)
+		}
+		m.Handle(pattern, handler)
+	}
+
+	// newWorkspaceHandler registers h for members of the workspace
+	// in the path having at least role min.
+	newWorkspaceHandler := func(pattern string, min domain.Role, h http.HandlerFunc) {
+		newHandler(pattern, s.withWorkspace(min, h))
+	}
+
 	// Pages
-	newHandler("GET /", s.getIndex)
-	newHandler("GET /archive/{$}", s.getArchive)
+	newHandler("GET /{$}", s.getRoot)
+	newWorkspaceHandler("GET /w/{workspace}/{$}", domain.RoleViewer, s.getIndex)
+	newWorkspaceHandler("GET /w/{workspace}/archive/{$}", domain.RoleViewer, s.getArchive)
+	newWorkspaceHandler("GET /w/{workspace}/trash/{$}", domain.RoleViewer, s.getTrash)
+	newWorkspaceHandler("GET /w/{workspace}/members/{$}", domain.RoleViewer, s.getMembers)
 
 	// Fragments
-	newHandler("POST /form/new/{$}", s.postFormNew)
-	newHandler("POST /form/edit/{$}", s.postFormEdit)
+	newWorkspaceHandler("POST /w/{workspace}/form/new/{$}", domain.RoleEditor, s.postFormNew)
+	newWorkspaceHandler("POST /w/{workspace}/form/edit/{$}", domain.RoleEditor, s.postFormEdit)
+	newHandler("GET /todo/history/{$}", s.getTodoHistory)
+	newHandler("GET /todo/comments/{$}", s.getTodoComments)
+
+	// Files
+	newFileHandler("GET /todo/{todo}/attachments/{hash}/{$}", s.getTodoAttachments)
 
 	// Actions
+	newHandler("POST /workspaces/{$}", s.postWorkspaces)
+	newWorkspaceHandler("POST /w/{workspace}/members/{$}", domain.RoleAdmin, s.postMembers)
+	newWorkspaceHandler("PUT /w/{workspace}/todo/{$}", domain.RoleEditor, s.putTodo)
+	newWorkspaceHandler("DELETE /w/{workspace}/trash/{$}", domain.RoleAdmin, s.deleteTrash)
 	newHandler("DELETE /todo/{$}", s.deleteTodo)
-	newHandler("PUT /todo/{$}", s.putTodo)
 	newHandler("POST /todo/{$}", s.postTodo)
+	newHandler("POST /todo/move/{$}", s.postTodoMove)
+	newHandler("POST /todo/checklist/{$}", s.postTodoChecklist)
+	newHandler("POST /todo/skip/{$}", s.postTodoSkip)
+	newHandler("PUT /todo/comments/{$}", s.putTodoComments)
+	newHandler("POST /todo/comments/{$}", s.postTodoComments)
+	newHandler("DELETE /todo/comments/{$}", s.deleteTodoComments)
+	newHandler("POST /todo/{todo}/attachments/{$}", s.postTodoAttachments)
+	newHandler("DELETE /todo/{todo}/attachments/{hash}/{$}", s.deleteTodoAttachments)
+	newHandler("POST /trash/restore/{$}", s.postTrashRestore)
+	newHandler("POST /undo/{$}", s.postUndo)
+	newHandler("POST /redo/{$}", s.postRedo)
 
 	s.mux = m
 	return s
 }
 
+// withLocation computes due dates of recurring todos
+// in the time zone of the user for all store mutations made by h.
+func withLocation(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h(w, r.WithContext(domain.WithLocation(r.Context(), request.Location(r))))
+	}
+}
+
 func isDevMode() bool { return os.Getenv("TEMPL_DEV_MODE") != "" }
 
 type Server struct {
-	mux   *http.ServeMux
-	store *domain.Store
+	mux              *http.ServeMux
+	store            domain.Store
+	users            domain.UserStore
+	workspaces       domain.WorkspaceStore
+	blobs            domain.BlobStore
+	sessions         *session.Store
+	insecureCookies  bool
+	oidc             *oidc.Provider
+	passwordLogin    bool
+	undo             *undoStacks
+	undoDeleteWindow time.Duration
+	trashRetention   time.Duration
+	refreshWindow    time.Duration
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -99,8 +230,146 @@ func (s *Server) getLivez(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte("ok"))
 }
 
+// getMetrics serves the counters of events.Metrics
+// in the Prometheus text format.
+func (s *Server) getMetrics(w http.ResponseWriter, r *http.Request) {
+	m := events.Metrics()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, c := range []struct {
+		name, help string
+		value      int64
+	}{
+		{"todostar_todo_events_notified_total", "Changes to todos notified to views.", m.Notified},
+		{"todostar_todo_events_merged_total", "Changes to todos merged into earlier ones.", m.Merged},
+		{"todostar_todo_events_ignored_total", "Changes to todos ignored by views of other workspaces.", m.Ignored},
+		{"todostar_todo_refreshes_total", "Refreshes of views caused by changes to todos.", m.Delivered},
+	} {
+		_, _ = fmt.Fprintf(w, "# HELP %[1]s %[2]s\n# TYPE %[1]s counter\n%[1]s %[3]d\n",
+			c.name, c.help, c.value)
+	}
+}
+
 type Signals struct {
-	Search struct {
-		Term string `json:"term,omitempty"`
-	} `json:"search,omitempty"`
+	Search SearchSignals `json:"search,omitempty"`
+}
+
+type SearchSignals struct {
+	Term        string         `json:"term,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	ExcludeTags []string       `json:"excludeTags,omitempty"`
+	Sort        domain.SortKey `json:"sort,omitempty"`
+	SortDesc    bool           `json:"sortDesc,omitempty"`
+	HideBlocked bool           `json:"hideBlocked,omitempty"`
+	// Assignee is "me", "none" for unassigned todos,
+	// the ID of a user or "" for todos assigned to anyone.
+	Assignee string `json:"assignee,omitempty"`
+}
+
+// SortKey returns the chosen sort key or domain.SortDefault if it's unknown.
+func (s SearchSignals) SortKey() domain.SortKey {
+	if !s.Sort.Valid() {
+		return domain.SortDefault
+	}
+	return s.Sort
+}
+
+// AssigneeFilter returns the user to select the todos of
+// where me is the ID of the user searching,
+// and whether to only select unassigned todos.
+func (s SearchSignals) AssigneeFilter(me int64) (assignee int64, unassigned bool) {
+	switch s.Assignee {
+	case "me":
+		return me, false
+	case "none":
+		return 0, true
+	}
+	id, _ := strconv.ParseInt(s.Assignee, 10, 64)
+	return id, false
+}
+
+// assigneesValidationMessage returns the message for invalid assignees
+// or "" if the assignees are valid.
+func assigneesValidationMessage(v domain.ErrorValidation) string {
+	if v.AssigneesInvalid {
+		return fmt.Sprintf("At most %d members of the workspace can be assigned",
+			domain.AssigneesMaxCount)
+	}
+	return ""
+}
+
+// attachmentValidationMessage returns the message for an invalid attachment
+// or "" if the attachment is valid.
+func attachmentValidationMessage(v domain.ErrorValidation) string {
+	switch {
+	case v.AttachmentTooLarge:
+		return fmt.Sprintf("Files must be at most %d MiB large",
+			domain.AttachmentMaxSize>>20)
+	case v.AttachmentTypeInvalid:
+		return "Only images, text, PDF, zip and gzip files can be attached"
+	case v.AttachmentsTooMany:
+		return fmt.Sprintf("At most %d files can be attached",
+			domain.AttachmentsMaxCount)
+	case v.AttachmentInvalid:
+		return "The file can't be attached"
+	}
+	return ""
+}
+
+// commentValidationMessage returns the message for an invalid comment
+// or "" if the comment is valid.
+func commentValidationMessage(v domain.ErrorValidation) string {
+	switch {
+	case v.CommentEmpty:
+		return "Comment must not be empty"
+	case v.CommentTooLong:
+		return fmt.Sprintf("Comments must be at most %d characters long",
+			domain.CommentMaxLength)
+	}
+	return ""
+}
+
+// checklistValidationMessage returns the message for an invalid checklist
+// or "" if the checklist is valid.
+func checklistValidationMessage(v domain.ErrorValidation) string {
+	switch {
+	case v.ChecklistTooLong:
+		return fmt.Sprintf("At most %d items are allowed", domain.ChecklistMaxItems)
+	case v.ChecklistItemInvalid:
+		return fmt.Sprintf("Items must be at most %d characters long",
+			domain.ChecklistItemMaxLength)
+	}
+	return ""
+}
+
+// recurrenceValidationMessage returns the message for an invalid recurrence
+// rule or "" if the rule is valid.
+func recurrenceValidationMessage(v domain.ErrorValidation) string {
+	if v.RecurrenceInvalid {
+		return "Repeat must be a daily, weekly or monthly RRULE " +
+			"like FREQ=WEEKLY;BYDAY=MO,FR"
+	}
+	return ""
+}
+
+// blockedByValidationMessage returns the message for invalid blockers
+// or "" if the blockers are valid.
+func blockedByValidationMessage(v domain.ErrorValidation) string {
+	if v.BlockedByInvalid {
+		return fmt.Sprintf("At most %d active todos like #3, #5 are allowed",
+			domain.BlockersMaxCount)
+	}
+	return ""
+}
+
+// tagsValidationMessage returns the message for invalid tags or ""
+// if the tags are valid.
+func tagsValidationMessage(v domain.ErrorValidation) string {
+	switch {
+	case v.TagsTooMany:
+		return fmt.Sprintf("At most %d tags are allowed", domain.TagsMaxCount)
+	case v.TagInvalid:
+		return fmt.Sprintf("Tags must be at most %d characters long "+
+			"and consist of letters, digits and -_./:+#", domain.TagMaxLength)
+	}
+	return ""
 }
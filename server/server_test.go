@@ -0,0 +1,54 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/stretchr/testify/require"
+)
+
+// testServer is a server with a single user
+// who is the admin of a single workspace.
+type testServer struct {
+	*Server
+	user, workspace int64
+	// session is the ID of the login session of user.
+	session string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	users := domain.NewUsers()
+	user, err := users.AddUser(t.Context(), domain.User{Name: "alice"}, "password1")
+	require.NoError(t, err)
+	workspaces := domain.NewWorkspaces()
+	workspace, err := workspaces.AddWorkspace(t.Context(), "Home", user)
+	require.NoError(t, err)
+	s := New(domain.New(), users, workspaces, domain.NewBlobs(), Config{
+		UndoDeleteWindow: time.Minute,
+		SessionTTL:       time.Hour,
+	})
+	return &testServer{
+		Server: s, user: user, workspace: workspace,
+		session: s.sessions.Start(user),
+	}
+}
+
+// do sends a Datastar request with signals as JSON body
+// in the session of s and returns the response.
+func (s *testServer) do(
+	t *testing.T, method, path, signals string,
+) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequestWithContext(
+		t.Context(), method, path, bytes.NewBufferString(signals))
+	r.Header.Set("Datastar-Request", "true")
+	r.AddCookie(&http.Cookie{Name: "session", Value: s.session})
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
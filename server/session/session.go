@@ -0,0 +1,74 @@
+// Package session provides the server-side store of login sessions.
+package session
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// Store keeps login sessions in memory.
+// Sessions expire after being inactive for the TTL of the store.
+type Store struct {
+	lock     sync.Mutex
+	ttl      time.Duration
+	sessions map[string]*session
+}
+
+type session struct {
+	userID  int64
+	expires time.Time
+}
+
+// New creates a new session store with sessions expiring
+// after being inactive for ttl.
+func New(ttl time.Duration) *Store {
+	return &Store{ttl: ttl, sessions: make(map[string]*session)}
+}
+
+// TTL returns how long sessions last without activity.
+func (s *Store) TTL() time.Duration { return s.ttl }
+
+// Start starts a new session for user userID and returns its ID.
+// Expired sessions are dropped.
+func (s *Store) Start(userID int64) (id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	for id, ss := range s.sessions {
+		if now.After(ss.expires) {
+			delete(s.sessions, id)
+		}
+	}
+	id = rand.Text()
+	s.sessions[id] = &session{userID: userID, expires: now.Add(s.ttl)}
+	return id
+}
+
+// Get returns the user of session id and extends the session.
+// Returns ok=false if there's no such session or it expired.
+func (s *Store) Get(id string) (userID int64, ok bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ss := s.sessions[id]
+	if ss == nil {
+		return 0, false
+	}
+	now := time.Now()
+	if now.After(ss.expires) {
+		delete(s.sessions, id)
+		return 0, false
+	}
+	ss.expires = now.Add(s.ttl)
+	return ss.userID, true
+}
+
+// End ends session id. No-op if there's no such session.
+func (s *Store) End(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.sessions, id)
+}
@@ -1,22 +1,393 @@
 package template
 
 import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/romshark/todostar/domain"
 )
 
+type ctxKeyWorkspaces struct{}
+
+// WithWorkspaces returns a copy of ctx carrying the workspaces
+// the user is a member of offered by the workspace switcher.
+func WithWorkspaces(ctx context.Context, l []*domain.Workspace) context.Context {
+	return context.WithValue(ctx, ctxKeyWorkspaces{}, l)
+}
+
+func workspacesFrom(ctx context.Context) []*domain.Workspace {
+	l, _ := ctx.Value(ctxKeyWorkspaces{}).([]*domain.Workspace)
+	return l
+}
+
+type ctxKeyMembers struct{}
+
+// WithMembers returns a copy of ctx carrying the members
+// of the workspace being viewed, see domain.WithWorkspace.
+func WithMembers(ctx context.Context, l []*domain.User) context.Context {
+	return context.WithValue(ctx, ctxKeyMembers{}, l)
+}
+
+func membersFrom(ctx context.Context) []*domain.User {
+	l, _ := ctx.Value(ctxKeyMembers{}).([]*domain.User)
+	return l
+}
+
+// member returns the member of the workspace being viewed with ID id
+// or nil if there's no such member.
+func member(ctx context.Context, id int64) *domain.User {
+	for _, u := range membersFrom(ctx) {
+		if u.ID == id {
+			return u
+		}
+	}
+	return nil
+}
+
+// initials returns the upper case initials of at most the first two words
+// of the name of u.
+func initials(u *domain.User) string {
+	var s []rune
+	for w := range strings.FieldsSeq(u.DisplayNameOrName()) {
+		if len(s) == 2 {
+			break
+		}
+		r, _ := utf8.DecodeRuneInString(w)
+		s = append(s, unicode.ToUpper(r))
+	}
+	return string(s)
+}
+
+// assigneeNames returns the comma separated names of the members with the
+// given ids. Former members are listed by ID.
+func assigneeNames(ctx context.Context, ids []int64) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		if u := member(ctx, id); u != nil {
+			s[i] = u.DisplayNameOrName()
+		} else {
+			s[i] = "#" + strconv.FormatInt(id, 10)
+		}
+	}
+	return strings.Join(s, ", ")
+}
+
+// idsJSON formats ids as a JSON array.
+func idsJSON(ids []int64) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.FormatInt(id, 10)
+	}
+	return "[" + strings.Join(s, ",") + "]"
+}
+
+// workspacePath returns path p in the workspace being viewed.
+func workspacePath(ctx context.Context, p string) string {
+	if ws := domain.WorkspaceFrom(ctx); ws != nil {
+		return fmt.Sprintf("/w/%d%s", ws.ID, p)
+	}
+	return p
+}
+
+// workspaceAction returns the Datastar action sending a request with method
+// to path p in the workspace being viewed, like "@get('/w/1/archive/')".
+func workspaceAction(ctx context.Context, method, p string) string {
+	return fmt.Sprintf("@%s('%s')", method, workspacePath(ctx, p))
+}
+
+// role returns the role of the user in the workspace being viewed.
+func role(ctx context.Context) domain.Role {
+	ws, u := domain.WorkspaceFrom(ctx), domain.UserFrom(ctx)
+	if ws == nil || u == nil {
+		return domain.RoleNone
+	}
+	return ws.Role(u.ID)
+}
+
+// canEdit returns true if the user may change the todos
+// of the workspace being viewed.
+func canEdit(ctx context.Context) bool { return role(ctx) >= domain.RoleEditor }
+
+// isAdmin returns true if the user administrates the workspace being viewed.
+func isAdmin(ctx context.Context) bool { return role(ctx) == domain.RoleAdmin }
+
+// roleLabel returns the user-facing name of r.
+func roleLabel(r domain.Role) string {
+	switch r {
+	case domain.RoleViewer:
+		return "Viewer"
+	case domain.RoleEditor:
+		return "Editor"
+	case domain.RoleAdmin:
+		return "Admin"
+	}
+	return "Remove"
+}
+
+// DialogMessages are the validation messages shown by the inputs of the
+// new and edit dialogs, empty if the input is valid.
+type DialogMessages struct {
+	Title, Description, Tags, Checklist, Recurrence, BlockedBy, Assignees string
+}
+
+// IsErr returns true if any of the inputs is invalid.
+func (m DialogMessages) IsErr() bool { return m != DialogMessages{} }
+
 func dueDateOver(now, due time.Time) bool { return now.Unix() > due.Unix() }
 
-func percentDone(s []*domain.Todo) float64 {
+// percentDone returns the percentage of todos in s that are done.
+// If partial is true open todos count as partially done by their checklist.
+func percentDone(s []*domain.Todo, partial bool) float64 {
 	if len(s) == 0 {
 		return 0
 	}
-	var done int
+	var done float64
 	for _, t := range s {
-		if t.Status == domain.StatusDone {
+		switch {
+		case partial:
+			done += t.Progress()
+		case t.Status == domain.StatusDone:
+			done++
+		}
+	}
+	return done / float64(len(s)) * 100
+}
+
+// checklistDone returns the number of done items in the checklist of t.
+func checklistDone(t *domain.Todo) (done int) {
+	for _, item := range t.Checklist {
+		if item.Done {
 			done++
 		}
 	}
-	return float64(done) / float64(len(s)) * 100
+	return done
+}
+
+// priorityLabel returns the user-facing name of p.
+func priorityLabel(p domain.Priority) string {
+	switch p {
+	case domain.PriorityNone:
+		return "None"
+	case domain.PriorityLow:
+		return "Low"
+	case domain.PriorityMedium:
+		return "Medium"
+	case domain.PriorityHigh:
+		return "High"
+	case domain.PriorityUrgent:
+		return "Urgent"
+	}
+	return p.String()
+}
+
+// priorityVariant returns the wa-tag variant of p.
+func priorityVariant(p domain.Priority) string {
+	switch p {
+	case domain.PriorityUrgent:
+		return "danger"
+	case domain.PriorityHigh:
+		return "warning"
+	case domain.PriorityMedium:
+		return "brand"
+	}
+	return "neutral"
+}
+
+// recurrencePresets are the common rules offered by recurrenceInput.
+var recurrencePresets = []struct{ Label, Rule string }{
+	{"Daily", "FREQ=DAILY"},
+	{"Every weekday", "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR"},
+	{"Weekly", "FREQ=WEEKLY"},
+	{"Every two weeks", "FREQ=WEEKLY;INTERVAL=2"},
+	{"Monthly", "FREQ=MONTHLY"},
+	{"Last day of the month", "FREQ=MONTHLY;BYMONTHDAY=-1"},
+}
+
+// recurrenceLabel returns a short user-facing description of rule.
+func recurrenceLabel(rule string) string {
+	r, err := domain.ParseRecurrence(rule)
+	if err != nil {
+		return rule
+	}
+	var label string
+	switch r.Freq {
+	case domain.FrequencyDaily:
+		label = plural(r.Interval, "Daily", "day")
+	case domain.FrequencyWeekly:
+		label = plural(r.Interval, "Weekly", "week")
+		if len(r.Weekdays) > 0 {
+			days := make([]string, len(r.Weekdays))
+			for i, d := range r.Weekdays {
+				days[i] = d.String()[:3]
+			}
+			label += " on " + strings.Join(days, ", ")
+		}
+	case domain.FrequencyMonthly:
+		label = plural(r.Interval, "Monthly", "month")
+		switch r.MonthDay {
+		case 0:
+		case -1:
+			label += " on the last day"
+		default:
+			label += fmt.Sprintf(" on day %d", r.MonthDay)
+		}
+	}
+	switch {
+	case r.Count == 1:
+		label += ", last time"
+	case r.Count > 1:
+		label += fmt.Sprintf(", %d times left", r.Count)
+	case !r.Until.IsZero():
+		label += " until " + r.Until.Format("Jan _2 2006")
+	}
+	return label
+}
+
+func plural(interval int, once, unit string) string {
+	if interval == 1 {
+		return once
+	}
+	return fmt.Sprintf("Every %d %ss", interval, unit)
+}
+
+// sortLabel returns the user-facing name of k.
+func sortLabel(k domain.SortKey) string {
+	switch k {
+	case domain.SortManual:
+		return "Manual"
+	case domain.SortRelevance:
+		return "Relevance"
+	case domain.SortCreated:
+		return "Created"
+	case domain.SortDue:
+		return "Due"
+	case domain.SortTitle:
+		return "Title"
+	case domain.SortStatus:
+		return "Status"
+	case domain.SortPriority:
+		return "Priority"
+	}
+	return "Default"
+}
+
+// tagsStr formats tags as a comma separated list, see domain.ParseTags.
+func tagsStr(tags []string) string { return strings.Join(tags, ", ") }
+
+// attachmentURL returns the URL attachment a of todo id is served at.
+func attachmentURL(id int64, a domain.Attachment) string {
+	return fmt.Sprintf("/todo/%d/attachments/%s/", id, a.Hash)
+}
+
+// attachmentAccept returns the file types the attachment upload accepts.
+func attachmentAccept() string { return strings.Join(domain.AttachmentTypes, ",") }
+
+// fileSize formats n bytes in the largest binary unit they fill.
+func fileSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// loginURL returns the URL to log in at taking the user to next.
+func loginURL(next string) string {
+	if next == "" {
+		return "/login/"
+	}
+	return "/login/?" + url.Values{"next": {next}}.Encode()
+}
+
+// loginOIDCURL returns the URL to log in through single sign-on at
+// taking the user to next.
+func loginOIDCURL(next string) string {
+	if next == "" {
+		return "/login/oidc/"
+	}
+	return "/login/oidc/?" + url.Values{"next": {next}}.Encode()
+}
+
+func historyActor(actor string) string {
+	if actor == "" {
+		return "Someone"
+	}
+	return actor
+}
+
+// commentAuthor returns the name of the author of c.
+func commentAuthor(ctx context.Context, c *domain.Comment) string {
+	if u := member(ctx, c.Author); u != nil {
+		return u.DisplayNameOrName()
+	}
+	return "Former member"
+}
+
+// isAuthor returns true if the user wrote c and may still edit it.
+func isAuthor(ctx context.Context, c *domain.Comment) bool {
+	u := domain.UserFrom(ctx)
+	return u != nil && u.ID == c.Author && canEdit(ctx)
+}
+
+func historyMutation(m domain.Mutation) string {
+	switch m {
+	case domain.MutationAdd:
+		return "created this todo"
+	case domain.MutationEdit:
+		return "edited"
+	case domain.MutationArchive:
+		return "archived"
+	case domain.MutationTrash:
+		return "moved this todo to the trash"
+	case domain.MutationRestore:
+		return "restored this todo from the trash"
+	case domain.MutationMove:
+		return "moved this todo"
+	case domain.MutationDelete:
+		return "deleted"
+	}
+	return string(m)
+}
+
+func historyChange(ctx context.Context, c domain.FieldChange) string {
+	if c.Field == "Assignees" {
+		c.Old, c.New = historyAssignees(ctx, c.Old), historyAssignees(ctx, c.New)
+	}
+	switch {
+	case c.Field == "Description", c.Field == "Checklist":
+		// Descriptions and checklists are too long to be diffed inline.
+		return c.Field + " changed"
+	case c.Old == "":
+		return fmt.Sprintf("%s set to %q", c.Field, c.New)
+	case c.New == "":
+		return fmt.Sprintf("%s cleared", c.Field)
+	}
+	return fmt.Sprintf("%s: %q → %q", c.Field, c.Old, c.New)
+}
+
+// historyAssignees returns the names of the comma separated assignee IDs
+// of a domain.FieldChange.
+func historyAssignees(ctx context.Context, ids string) string {
+	if ids == "" {
+		return ""
+	}
+	var l []int64
+	for f := range strings.SplitSeq(ids, ",") {
+		id, _ := strconv.ParseInt(f, 10, 64)
+		l = append(l, id)
+	}
+	return assigneeNames(ctx, l)
+}
+
+// purgeIn returns how long until todo is permanently deleted from the trash.
+func purgeIn(now time.Time, todo *domain.Todo, retention time.Duration) time.Duration {
+	return max(todo.Trashed.Add(retention).Sub(now), 0)
 }
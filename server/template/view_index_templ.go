@@ -10,7 +10,10 @@ import templruntime "github.com/a-h/templ/runtime"
 
 import "github.com/romshark/todostar/domain"
 
-func ViewIndex(todos []*domain.Todo) templ.Component {
+// ViewIndex renders the index view, see PartTodos.
+func ViewIndex(
+	todos []*domain.Todo, tags []domain.TagCount, blockers map[int64][]int64,
+) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
@@ -31,34 +34,91 @@ func ViewIndex(todos []*domain.Todo) templ.Component {
 			templ_7745c5c3_Var1 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<div id=\"view\" class=\"grow\" data-signals=\"{search: {term:''}}\">")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<div id=\"view\" class=\"grow\" data-signals=\"{\n\t\t\tsearch: {term: '', tags: [], excludeTags: [], sort: '', sortDesc: false, hideBlocked: false, assignee: ''},\n\t\t\tcomment: {id: 0, text: '', editText: ''},\n\t\t\t_comments: {todo: 0, seq: 0},\n\t\t\t_dragID: 0,\n\t\t\t_dragIndex: 0,\n\t\t\t_progressPartial: false,\n\t\t}\">")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = PartDialogEdit(false, "", "").Render(ctx, templ_7745c5c3_Buffer)
+		templ_7745c5c3_Err = PartDialogEdit(false, DialogMessages{}, nil).Render(ctx, templ_7745c5c3_Buffer)
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = PartDialogNew(false, "", "").Render(ctx, templ_7745c5c3_Buffer)
+		templ_7745c5c3_Err = PartDialogNew(false, DialogMessages{}).Render(ctx, templ_7745c5c3_Buffer)
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "<div class=\"flex flex-row gap-4 mb-2\" data-on-load=\"@get('/')\" data-on-input__debounce.200ms=\"@get('/')\"><wa-input class=\"grow\" placeholder=\"Search\" data-bind=\"search.term\" with-clear></wa-input> <wa-button data-effect=\"el.appearance = $_themeisdark ? 'outlined' : ''\" data-on-click=\"el_dialogNew.open = true\"><wa-icon slot=\"start\" name=\"plus\"></wa-icon> New</wa-button></div>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "<div id=\"el_search\" class=\"flex flex-row gap-4 mb-2\" data-on-load=\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var2 string
+		templ_7745c5c3_Var2, templ_7745c5c3_Err = templ.JoinStringErrs(workspaceAction(ctx, "get", "/"))
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `server/template/view_index.templ`, Line: 28, Col: 50}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var2))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "\" data-on-input__debounce.200ms=\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var3 string
+		templ_7745c5c3_Var3, templ_7745c5c3_Err = templ.JoinStringErrs(workspaceAction(ctx, "get", "/"))
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `server/template/view_index.templ`, Line: 29, Col: 67}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var3))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "\" data-on-filter=\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var4 string
+		templ_7745c5c3_Var4, templ_7745c5c3_Err = templ.JoinStringErrs(workspaceAction(ctx, "get", "/"))
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `server/template/view_index.templ`, Line: 30, Col: 52}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var4))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "\"><wa-input class=\"grow\" placeholder=\"Search\" data-bind=\"search.term\" with-clear></wa-input>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = assigneeFilter().Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = sortControls().Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		if canEdit(ctx) {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "<wa-button data-effect=\"el.appearance = $_themeisdark ? 'outlined' : ''\" data-on-click=\"el_dialogNew.open = true\"><wa-icon slot=\"start\" name=\"plus\"></wa-icon> New</wa-button>")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, "</div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
 		if todos == nil {
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "  <p id=\"todos\" class=\"\n\t\t\t\t\tapp-anim-appear-delayed\n\t\t\t\t\tp-8 text-xl flex flex-row gap-4 justify-center items-center\n\t\t\t\t\"><wa-icon name=\"spinner\" class=\"animate-spin\"></wa-icon> loading todos...</p>")
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 8, "  <p id=\"todos\" class=\"\n\t\t\t\t\tapp-anim-appear-delayed\n\t\t\t\t\tp-8 text-xl flex flex-row gap-4 justify-center items-center\n\t\t\t\t\"><wa-icon name=\"spinner\" class=\"animate-spin\"></wa-icon> loading todos...</p>")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
 		} else {
-			templ_7745c5c3_Err = PartTodos(todos).Render(ctx, templ_7745c5c3_Buffer)
+			templ_7745c5c3_Err = PartTodos(todos, tags, blockers).Render(ctx, templ_7745c5c3_Buffer)
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "</div>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 9, "</div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -0,0 +1,405 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/events"
+	"github.com/romshark/todostar/pkg/broadcast"
+	"github.com/romshark/todostar/server/request"
+	"github.com/romshark/todostar/server/template"
+	"github.com/starfederation/datastar-go/datastar"
+)
+
+const (
+	// undoStackDepth is the maximum number of undoable changes per session.
+	undoStackDepth = 50
+
+	// undoSessionTTL is how long the undo stack of an inactive session is kept.
+	undoSessionTTL = 24 * time.Hour
+)
+
+var (
+	errNothingToUndo = errors.New("nothing to undo")
+	errNothingToRedo = errors.New("nothing to redo")
+)
+
+// undoEntry is a change that can be undone and redone.
+type undoEntry struct {
+	label string
+	// undo and redo return the todo before and after undoing or redoing.
+	undo, redo func(context.Context) (todoChange, error)
+	// workspace is the ID of the workspace of the changed todo.
+	workspace int64
+	// expires is the time after which the change can no longer be undone.
+	// Zero means never.
+	expires time.Time
+}
+
+func (e *undoEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
+
+type undoStack struct {
+	done, undone []*undoEntry
+	lastUsed     time.Time
+}
+
+// undoStacks keeps the undo and redo stacks of all sessions.
+type undoStacks struct {
+	lock     sync.Mutex
+	sessions map[string]*undoStack
+}
+
+func newUndoStacks() *undoStacks {
+	return &undoStacks{sessions: make(map[string]*undoStack)}
+}
+
+// stack returns the stack of session and drops the stacks of inactive sessions.
+func (u *undoStacks) stack(session string, now time.Time) *undoStack {
+	for id, s := range u.sessions {
+		if now.Sub(s.lastUsed) > undoSessionTTL {
+			delete(u.sessions, id)
+		}
+	}
+	s := u.sessions[session]
+	if s == nil {
+		s = new(undoStack)
+		u.sessions[session] = s
+	}
+	s.lastUsed = now
+	return s
+}
+
+// push adds e to the undo stack of session and clears its redo stack.
+// Changes made outside of a session aren't undoable.
+func (u *undoStacks) push(session string, e *undoEntry) {
+	if session == "" {
+		return
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	s := u.stack(session, time.Now())
+	s.done = append(s.done, e)
+	if len(s.done) > undoStackDepth {
+		s.done = s.done[len(s.done)-undoStackDepth:]
+	}
+	s.undone = nil
+}
+
+// undo undoes the last change of session if allow permits it
+// and returns the undone entry and the change of the todo.
+// Changes that fail to undo or aren't allowed are dropped.
+func (u *undoStacks) undo(
+	ctx context.Context, session string, allow func(*undoEntry) error,
+) (*undoEntry, todoChange, error) {
+	if session == "" {
+		return nil, todoChange{}, errNothingToUndo
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	s := u.stack(session, time.Now())
+	e := popUnexpired(&s.done)
+	if e == nil {
+		return nil, todoChange{}, errNothingToUndo
+	}
+	if err := allow(e); err != nil {
+		return e, todoChange{}, err
+	}
+	c, err := e.undo(ctx)
+	if err != nil {
+		return e, todoChange{}, err
+	}
+	s.undone = append(s.undone, e)
+	return e, c, nil
+}
+
+// redo redoes the last undone change of session if allow permits it
+// and returns the redone entry and the change of the todo.
+// Changes that fail to redo or aren't allowed are dropped.
+func (u *undoStacks) redo(
+	ctx context.Context, session string, allow func(*undoEntry) error,
+) (*undoEntry, todoChange, error) {
+	if session == "" {
+		return nil, todoChange{}, errNothingToRedo
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	s := u.stack(session, time.Now())
+	e := popUnexpired(&s.undone)
+	if e == nil {
+		return nil, todoChange{}, errNothingToRedo
+	}
+	if err := allow(e); err != nil {
+		return e, todoChange{}, err
+	}
+	c, err := e.redo(ctx)
+	if err != nil {
+		return e, todoChange{}, err
+	}
+	s.done = append(s.done, e)
+	return e, c, nil
+}
+
+// popUnexpired removes entries from the top of stack until it finds
+// one that isn't expired and returns it. Returns nil if there's none.
+func popUnexpired(stack *[]*undoEntry) *undoEntry {
+	now := time.Now()
+	for len(*stack) > 0 {
+		e := (*stack)[len(*stack)-1]
+		*stack = (*stack)[:len(*stack)-1]
+		if !e.expired(now) {
+			return e
+		}
+	}
+	return nil
+}
+
+// isUndoConflict returns true if err indicates that an undo or redo
+// failed because the todo was changed by someone else in the meantime,
+// including its blockers being archived or deleted.
+func isUndoConflict(err error) bool {
+	var errConflict domain.ErrConflict
+	var errValid domain.ErrorValidation
+	return errors.As(err, &errConflict) ||
+		errors.As(err, &errValid) ||
+		errors.Is(err, domain.ErrNotExists)
+}
+
+// pushUndo makes e undoable for the session of r
+// and offers the session to undo it.
+// e belongs to the workspace passed on in the context of r.
+func (s *Server) pushUndo(r *http.Request, e *undoEntry) {
+	session := request.Session(r)
+	e.workspace = workspaceID(r.Context())
+	s.undo.push(session, e)
+	if session != "" {
+		events.NotifyUndo(events.EventUndo{
+			Session: session, Message: e.label, CanUndo: true,
+		})
+	}
+}
+
+// allowUndo returns errForbidden if the user is no longer allowed
+// to edit the workspace of e.
+func (s *Server) allowUndo(ctx context.Context) func(*undoEntry) error {
+	return func(e *undoEntry) error {
+		return s.requireRole(ctx, e.workspace, domain.RoleEditor)
+	}
+}
+
+// subscribeUndo patches the toast offering to undo or redo changes
+// made by session until the subscription is closed.
+func (s *Server) subscribeUndo(
+	session string, sse request.SSEHandle,
+) broadcast.Subscription[events.EventUndo] {
+	return events.OnUndo(func(e events.EventUndo) {
+		if session == "" || e.Session != session {
+			return
+		}
+		sse.Patch(template.PartToast(e.Message, e.CanUndo, e.CanRedo), "part toast",
+			datastar.WithModeReplace()) // Restart the dismiss timer.
+	})
+}
+
+// todoChange is a todo right before and after a change.
+type todoChange struct {
+	before, after *domain.Todo
+	// added is the todo added by the change, like the next occurrence
+	// of a completed recurring todo, or nil.
+	added *domain.Todo
+}
+
+// notifyTodoChange notifies about c including the todo it added.
+func notifyTodoChange(ctx context.Context, c todoChange) int {
+	n := events.NotifyTodoChanged(ctx, c.before, c.after)
+	if c.added != nil {
+		n += events.NotifyTodoCreated(ctx, c.added)
+	}
+	return n
+}
+
+// changeTodo calls change and returns todo id before and after it.
+func (s *Server) changeTodo(
+	ctx context.Context, id int64, change func(context.Context) error,
+) (c todoChange, err error) {
+	if c.before, err = s.store.Get(ctx, id); err != nil {
+		return todoChange{}, err
+	}
+	if err = change(ctx); err != nil {
+		return todoChange{}, err
+	}
+	if c.after, err = s.store.Get(ctx, id); err != nil {
+		return todoChange{}, err
+	}
+	return c, nil
+}
+
+// editTodo edits todo id like domain.Store.Edit and returns it
+// right before the edit and as committed after it
+// together with its next occurrence if the edit added one.
+func (s *Server) editTodo(
+	ctx context.Context, id, version int64, mutate func(*domain.Todo) error,
+) (c todoChange, err error) {
+	var next int64
+	err = s.store.Edit(domain.WithNextOccurrence(ctx, &next), id, version,
+		func(t *domain.Todo) error {
+			c.before = t.Clone()
+			return mutate(t)
+		})
+	if err != nil {
+		return todoChange{}, err
+	}
+	if c.after, err = s.store.Get(ctx, id); err != nil {
+		return todoChange{}, err
+	}
+	if next != 0 {
+		if c.added, err = s.store.Get(ctx, next); err != nil {
+			return todoChange{}, err
+		}
+	}
+	return c, nil
+}
+
+// editUndo returns an undo entry for the edit of before into after.
+// Undo and redo fail with domain.ErrConflict if the todo
+// was changed by someone else in the meantime.
+func (s *Server) editUndo(label string, before, after domain.Todo) *undoEntry {
+	version := after.Version
+	revertTo := func(state domain.Todo) func(context.Context) (todoChange, error) {
+		return func(ctx context.Context) (todoChange, error) {
+			// Reverting to a done state completes recurring todos again.
+			c, err := s.editTodo(ctx, state.ID, version, func(t *domain.Todo) error {
+				*t = state
+				return nil
+			})
+			if err == nil {
+				version++
+			}
+			return c, err
+		}
+	}
+	return &undoEntry{label: label, undo: revertTo(before), redo: revertTo(after)}
+}
+
+// trashUndo returns an undo entry for moving todo id to the trash
+// that can be undone within s.undoDeleteWindow.
+func (s *Server) trashUndo(id int64) *undoEntry {
+	e := &undoEntry{
+		label:   "Todo moved to trash",
+		expires: time.Now().Add(s.undoDeleteWindow),
+	}
+	e.undo = func(ctx context.Context) (todoChange, error) {
+		c, err := s.changeTodo(ctx, id, func(ctx context.Context) error {
+			return s.store.Restore(ctx, id)
+		})
+		if err != nil {
+			return todoChange{}, err
+		}
+		e.expires = time.Time{} // Redo is possible at any time.
+		return c, nil
+	}
+	e.redo = func(ctx context.Context) (todoChange, error) {
+		c, err := s.changeTodo(ctx, id, func(ctx context.Context) error {
+			return s.store.Delete(ctx, id)
+		})
+		if err != nil {
+			return todoChange{}, err
+		}
+		e.expires = time.Now().Add(s.undoDeleteWindow)
+		return c, nil
+	}
+	return e
+}
+
+// restoreUndo returns an undo entry for restoring todo id from the trash.
+func (s *Server) restoreUndo(id int64) *undoEntry {
+	return &undoEntry{
+		label: "Todo restored from trash",
+		undo: func(ctx context.Context) (todoChange, error) {
+			return s.changeTodo(ctx, id, func(ctx context.Context) error {
+				return s.store.Delete(ctx, id)
+			})
+		},
+		redo: func(ctx context.Context) (todoChange, error) {
+			return s.changeTodo(ctx, id, func(ctx context.Context) error {
+				return s.store.Restore(ctx, id)
+			})
+		},
+	}
+}
+
+// blockedTodos returns the IDs of the todos in the workspace passed on in ctx
+// that are blocked by todo id.
+func (s *Server) blockedTodos(ctx context.Context, id int64) ([]int64, error) {
+	todos, err := s.store.Search(ctx, domain.SearchFilters{Workspace: workspaceID(ctx)})
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for _, t := range todos {
+		if slices.Contains(t.BlockedBy, id) {
+			ids = append(ids, t.ID)
+		}
+	}
+	return ids, nil
+}
+
+// reblockUndo returns e undoing which also blocks the todos with the given
+// ids by todo blocker again. Archiving todo blocker or moving it to the trash
+// removes it from the blockers of ids, see domain.Store.Archive.
+func (s *Server) reblockUndo(e *undoEntry, blocker int64, ids []int64) *undoEntry {
+	if len(ids) == 0 {
+		return e
+	}
+	undo := e.undo
+	e.undo = func(ctx context.Context) (todoChange, error) {
+		c, err := undo(ctx)
+		if err != nil {
+			return todoChange{}, err
+		}
+		return c, s.reblock(ctx, blocker, ids)
+	}
+	return e
+}
+
+// errUnchanged aborts an edit that wouldn't change the todo.
+var errUnchanged = errors.New("unchanged")
+
+// reblock adds blocker to the blockers of the todos with the given ids.
+// Todos that were archived, deleted or would now form a cycle are skipped.
+func (s *Server) reblock(ctx context.Context, blocker int64, ids []int64) error {
+	for _, id := range ids {
+		var before *domain.Todo
+		err := s.store.Edit(ctx, id, 0, func(t *domain.Todo) error {
+			if t.Archived || t.InTrash() || slices.Contains(t.BlockedBy, blocker) {
+				return errUnchanged
+			}
+			before = t.Clone()
+			t.BlockedBy = append(t.BlockedBy, blocker)
+			return nil
+		})
+		switch {
+		case errors.Is(err, errUnchanged),
+			errors.Is(err, domain.ErrNotExists),
+			errors.Is(err, domain.ErrDependencyCycle):
+			continue
+		case err != nil:
+			return err
+		}
+		after, err := s.store.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		events.NotifyTodoChanged(ctx, before, after)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/stretchr/testify/require"
+)
+
+var errTestUndo = errors.New("failed")
+
+// testUndoEntry returns an entry labeled label that appends
+// "undo <label>" and "redo <label>" to log. Entries labeled "failing"
+// fail to undo and redo, entries labeled "expired" are expired.
+func testUndoEntry(label string, log *[]string) *undoEntry {
+	e := &undoEntry{
+		label: label,
+		undo: func(context.Context) (todoChange, error) {
+			*log = append(*log, "undo "+label)
+			if label == "failing" {
+				return todoChange{}, errTestUndo
+			}
+			return todoChange{}, nil
+		},
+		redo: func(context.Context) (todoChange, error) {
+			*log = append(*log, "redo "+label)
+			return todoChange{}, nil
+		},
+	}
+	if label == "expired" {
+		e.expires = time.Now().Add(-time.Second)
+	}
+	return e
+}
+
+func allowAll(*undoEntry) error { return nil }
+
+func TestUndoStacks(t *testing.T) {
+	errDenied := errors.New("denied")
+	for _, td := range []struct {
+		name string
+		// steps are "push <label>", "undo", "redo", "deny undo" and "deny redo".
+		steps  []string
+		expect []string
+		// expectErrs are the errors of the undos and redos in order.
+		expectErrs []error
+	}{
+		{
+			name:       "undo and redo in order",
+			steps:      []string{"push a", "push b", "undo", "undo", "redo", "redo"},
+			expect:     []string{"undo b", "undo a", "redo a", "redo b"},
+			expectErrs: []error{nil, nil, nil, nil},
+		},
+		{
+			name:       "nothing to undo",
+			steps:      []string{"undo", "redo"},
+			expectErrs: []error{errNothingToUndo, errNothingToRedo},
+		},
+		{
+			name:       "push clears redo",
+			steps:      []string{"push a", "undo", "push b", "redo", "undo", "undo"},
+			expect:     []string{"undo a", "undo b"},
+			expectErrs: []error{nil, errNothingToRedo, nil, errNothingToUndo},
+		},
+		{
+			name:       "failed undo is dropped",
+			steps:      []string{"push a", "push failing", "undo", "undo", "redo"},
+			expect:     []string{"undo failing", "undo a", "redo a"},
+			expectErrs: []error{errTestUndo, nil, nil},
+		},
+		{
+			name:       "denied undo is dropped",
+			steps:      []string{"push a", "push b", "deny undo", "undo", "redo"},
+			expect:     []string{"undo a", "redo a"},
+			expectErrs: []error{errDenied, nil, nil},
+		},
+		{
+			name:       "denied redo is dropped",
+			steps:      []string{"push a", "undo", "deny redo", "redo", "undo"},
+			expect:     []string{"undo a"},
+			expectErrs: []error{nil, errDenied, errNothingToRedo, errNothingToUndo},
+		},
+		{
+			name:       "expired",
+			steps:      []string{"push a", "push expired", "undo", "undo"},
+			expect:     []string{"undo a"},
+			expectErrs: []error{nil, errNothingToUndo},
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			u := newUndoStacks()
+			var log []string
+			var errs []error
+			deny := func(*undoEntry) error { return errDenied }
+			for _, step := range td.steps {
+				var err error
+				switch step {
+				case "undo":
+					_, _, err = u.undo(t.Context(), "s", allowAll)
+				case "redo":
+					_, _, err = u.redo(t.Context(), "s", allowAll)
+				case "deny undo":
+					_, _, err = u.undo(t.Context(), "s", deny)
+				case "deny redo":
+					_, _, err = u.redo(t.Context(), "s", deny)
+				default:
+					u.push("s", testUndoEntry(step[len("push "):], &log))
+					continue
+				}
+				errs = append(errs, err)
+			}
+			require.Equal(t, td.expect, log)
+			require.Equal(t, td.expectErrs, errs)
+		})
+	}
+}
+
+func TestUndoStacksDepth(t *testing.T) {
+	u := newUndoStacks()
+	var log []string
+	for i := range undoStackDepth + 1 {
+		u.push("s", testUndoEntry(fmt.Sprint(i), &log))
+	}
+	for {
+		if _, _, err := u.undo(t.Context(), "s", allowAll); err != nil {
+			require.ErrorIs(t, err, errNothingToUndo)
+			break
+		}
+	}
+	require.Len(t, log, undoStackDepth)
+	require.Equal(t, "undo 1", log[len(log)-1], "the oldest change was dropped")
+}
+
+func TestUndoStacksSessions(t *testing.T) {
+	u := newUndoStacks()
+	var log []string
+	u.push("", testUndoEntry("anonymous", &log))
+	u.push("a", testUndoEntry("a", &log))
+
+	_, _, err := u.undo(t.Context(), "", allowAll)
+	require.ErrorIs(t, err, errNothingToUndo)
+	_, _, err = u.undo(t.Context(), "b", allowAll)
+	require.ErrorIs(t, err, errNothingToUndo)
+	e, _, err := u.undo(t.Context(), "a", allowAll)
+	require.NoError(t, err)
+	require.Equal(t, "a", e.label)
+	require.Equal(t, []string{"undo a"}, log)
+}
+
+func TestUndoRestoresBlockers(t *testing.T) {
+	for _, td := range []struct {
+		name            string
+		method, signals string
+	}{
+		{"archive", http.MethodPost, `{"selectedTodoID":%d,"editArchived":true}`},
+		{"trash", http.MethodDelete, `{"selectedTodoID":%d}`},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			s := newTestServer(t)
+			blocker, err := s.store.Add(t.Context(), domain.Todo{
+				Workspace: s.workspace, Title: "Blocker",
+			})
+			require.NoError(t, err)
+			blocked, err := s.store.Add(t.Context(), domain.Todo{
+				Workspace: s.workspace, Title: "Blocked", BlockedBy: []int64{blocker},
+			})
+			require.NoError(t, err)
+
+			w := s.do(t, td.method, "/todo/", fmt.Sprintf(td.signals, blocker))
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			todo, err := s.store.Get(t.Context(), blocked)
+			require.NoError(t, err)
+			require.Empty(t, todo.BlockedBy)
+
+			w = s.do(t, http.MethodPost, "/undo/", `{}`)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			todo, err = s.store.Get(t.Context(), blocked)
+			require.NoError(t, err)
+			require.Equal(t, []int64{blocker}, todo.BlockedBy)
+
+			w = s.do(t, http.MethodPost, "/redo/", `{}`)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			todo, err = s.store.Get(t.Context(), blocked)
+			require.NoError(t, err)
+			require.Empty(t, todo.BlockedBy)
+		})
+	}
+}
+
+func TestUndoArchiveBlockerGone(t *testing.T) {
+	s := newTestServer(t)
+	blocker, err := s.store.Add(t.Context(), domain.Todo{
+		Workspace: s.workspace, Title: "Blocker",
+	})
+	require.NoError(t, err)
+	blocked, err := s.store.Add(t.Context(), domain.Todo{
+		Workspace: s.workspace, Title: "Blocked", BlockedBy: []int64{blocker},
+	})
+	require.NoError(t, err)
+
+	w := s.do(t, http.MethodPost, "/todo/",
+		fmt.Sprintf(`{"selectedTodoID":%d,"editArchived":true}`, blocked))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	// Someone else archives the blocker in the meantime.
+	require.NoError(t, s.store.Archive(t.Context(), blocker))
+
+	w = s.do(t, http.MethodPost, "/undo/", `{}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	todo, err := s.store.Get(t.Context(), blocked)
+	require.NoError(t, err)
+	require.True(t, todo.Archived, "not undone")
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/server/request"
+	"github.com/romshark/todostar/server/template"
+)
+
+// errForbidden is returned when the user's role in a workspace
+// doesn't allow an action.
+var errForbidden = errors.New("forbidden")
+
+// withWorkspace makes h available to members of the workspace
+// in the path value "workspace" having at least role min.
+// The workspace and all workspaces of the user are passed on
+// in the request context, see domain.WithWorkspace and template.WithWorkspaces.
+func (s *Server) withWorkspace(min domain.Role, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("workspace"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		ctx, err := s.enterWorkspace(r.Context(), id, min)
+		if !ifErrWorkspace(w, r, err) {
+			h(w, r.WithContext(ctx))
+		}
+	}
+}
+
+// authorizeTodo checks that the user has at least role min in the workspace
+// of todo id and returns r with the workspace passed on like withWorkspace.
+// Responds with an error and returns ok=false otherwise.
+func (s *Server) authorizeTodo(
+	w http.ResponseWriter, r *http.Request, id int64, min domain.Role,
+) (_ *http.Request, ok bool) {
+	t, err := s.store.Get(r.Context(), id)
+	if err == nil {
+		var ctx context.Context
+		if ctx, err = s.enterWorkspace(r.Context(), t.Workspace, min); err == nil {
+			return r.WithContext(ctx), true
+		}
+	}
+	ifErrWorkspace(w, r, err)
+	return r, false
+}
+
+// authorizeTodoPath is authorizeTodo for the todo in the path value "todo"
+// and also returns its ID.
+func (s *Server) authorizeTodoPath(
+	w http.ResponseWriter, r *http.Request, min domain.Role,
+) (_ *http.Request, id int64, ok bool) {
+	id, err := strconv.ParseInt(r.PathValue("todo"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return r, 0, false
+	}
+	r, ok = s.authorizeTodo(w, r, id, min)
+	return r, id, ok
+}
+
+// enterWorkspace returns a copy of ctx carrying workspace id and all
+// workspaces of the user. Returns domain.ErrNotExists if the user
+// isn't a member of the workspace and errForbidden if the role
+// of the user is lower than min.
+func (s *Server) enterWorkspace(
+	ctx context.Context, id int64, min domain.Role,
+) (context.Context, error) {
+	u := domain.UserFrom(ctx)
+	if u == nil {
+		return nil, errForbidden
+	}
+	ws, err := s.workspaces.GetWorkspace(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch role := ws.Role(u.ID); {
+	case role == domain.RoleNone:
+		// Don't reveal the existence of workspaces to non-members.
+		return nil, domain.ErrNotExists
+	case role < min:
+		return nil, errForbidden
+	}
+	all, err := s.workspaces.Workspaces(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	ctx = domain.WithWorkspace(ctx, ws)
+	members, err := s.members(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx = template.WithMembers(ctx, members)
+	return template.WithWorkspaces(ctx, all), nil
+}
+
+// checkAssignees returns domain.ErrorValidation if ids aren't valid
+// assignees or any of them not listed in prev isn't a member
+// of the workspace passed on in ctx.
+// Members keep their assignments when they leave the workspace.
+func checkAssignees(ctx context.Context, ids, prev []int64) error {
+	v := domain.ValidateAssignees(ids)
+	ws := domain.WorkspaceFrom(ctx)
+	for _, id := range ids {
+		if !slices.Contains(prev, id) && (ws == nil || ws.Role(id) == domain.RoleNone) {
+			v.AssigneesInvalid = true
+		}
+	}
+	if v.IsErr() {
+		return v
+	}
+	return nil
+}
+
+// checkBlockers returns domain.ErrorValidation if ids aren't valid blockers
+// or any of them isn't a todo of the workspace passed on in ctx
+// outside of the archive and the trash.
+func (s *Server) checkBlockers(ctx context.Context, ids []int64) error {
+	v := domain.ValidateBlockers(ids)
+	for _, id := range ids {
+		t, err := s.store.Get(ctx, id)
+		if errors.Is(err, domain.ErrNotExists) {
+			v.BlockedByInvalid = true
+			continue
+		} else if err != nil {
+			return err
+		}
+		if t.Workspace != workspaceID(ctx) || t.Archived || t.InTrash() {
+			v.BlockedByInvalid = true
+		}
+	}
+	if v.IsErr() {
+		return v
+	}
+	return nil
+}
+
+// requireRole returns errForbidden if the user has a role lower than min
+// in workspace id.
+func (s *Server) requireRole(ctx context.Context, id int64, min domain.Role) error {
+	_, err := s.enterWorkspace(ctx, id, min)
+	if errors.Is(err, domain.ErrNotExists) {
+		return errForbidden
+	}
+	return err
+}
+
+// stillMember returns true if the user passed on in ctx is still a member
+// of the workspace passed on in ctx. Live updates check it before every
+// patch since membership is only checked when their stream is opened.
+// Otherwise it redirects to the start page and ends the stream with leave.
+func (s *Server) stillMember(
+	ctx context.Context, sse request.SSEHandle, leave context.CancelFunc,
+) bool {
+	if ctx.Err() != nil {
+		return false // Left already.
+	}
+	err := s.requireRole(ctx, workspaceID(ctx), domain.RoleViewer)
+	if err == nil {
+		return true
+	}
+	if !errors.Is(err, errForbidden) {
+		slog.Error("checking membership", slog.Any("err", err))
+	}
+	sse.Redirect("/")
+	leave()
+	return false
+}
+
+// ifErrWorkspace responds with 404 for workspaces and todos that don't exist
+// and with 403 for errForbidden.
+func ifErrWorkspace(w http.ResponseWriter, r *http.Request, err error) (stop bool) {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, domain.ErrNotExists):
+		http.NotFound(w, r)
+		return true
+	case errors.Is(err, errForbidden):
+		http.Error(w, "Your role doesn't allow this", http.StatusForbidden)
+		return true
+	}
+	return request.IfErrInternal(w, err, "")
+}
+
+// workspaceID returns the ID of the workspace passed on by withWorkspace
+// or authorizeTodo.
+func workspaceID(ctx context.Context) int64 {
+	if ws := domain.WorkspaceFrom(ctx); ws != nil {
+		return ws.ID
+	}
+	return 0
+}
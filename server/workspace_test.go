@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/romshark/todostar/domain"
+	"github.com/romshark/todostar/events"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLiveUpdatesEndForRemovedMembers(t *testing.T) {
+	for _, path := range []string{"/w/%d/", "/w/%d/archive/", "/w/%d/trash/"} {
+		t.Run(path, func(t *testing.T) {
+			s := newTestServer(t)
+			bob, err := s.users.AddUser(t.Context(), domain.User{Name: "bob"}, "password2")
+			require.NoError(t, err)
+			require.NoError(t, s.workspaces.SetRole(
+				t.Context(), s.workspace, bob, domain.RoleViewer))
+
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+			ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+			defer cancel()
+			r, err := http.NewRequestWithContext(ctx, http.MethodGet,
+				srv.URL+fmt.Sprintf(path, s.workspace), nil)
+			require.NoError(t, err)
+			r.Header.Set("Datastar-Request", "true")
+			r.AddCookie(&http.Cookie{Name: "session", Value: s.sessions.Start(bob)})
+			resp, err := http.DefaultClient.Do(r)
+			require.NoError(t, err)
+			defer func() { _ = resp.Body.Close() }()
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			// Wait for the stream to subscribe.
+			buf := make([]byte, 1)
+			_, err = resp.Body.Read(buf)
+			require.NoError(t, err)
+			require.Eventually(t, func() bool {
+				return events.NotifyTodosChanged(s.workspace) > 0
+			}, time.Second, 10*time.Millisecond)
+
+			require.NoError(t, s.workspaces.SetRole(
+				t.Context(), s.workspace, bob, domain.RoleNone))
+			events.NotifyTodosChanged(s.workspace)
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err, "stream ended")
+			require.Contains(t, string(body), `window.location.href = "/"`)
+		})
+	}
+}
+
+func TestWithWorkspace(t *testing.T) {
+	s := newTestServer(t)
+	bob, err := s.users.AddUser(t.Context(), domain.User{Name: "bob"}, "password2")
+	require.NoError(t, err)
+	require.NoError(t, s.workspaces.SetRole(
+		t.Context(), s.workspace, bob, domain.RoleViewer))
+	carol, err := s.users.AddUser(t.Context(), domain.User{Name: "carol"}, "password3")
+	require.NoError(t, err)
+
+	h := s.withWorkspace(domain.RoleEditor, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, workspaceID(r.Context()))
+	})
+	for _, td := range []struct {
+		name       string
+		user       int64
+		workspace  string
+		expectCode int
+	}{
+		{"admin", s.user, fmt.Sprint(s.workspace), http.StatusOK},
+		{"role too low", bob, fmt.Sprint(s.workspace), http.StatusForbidden},
+		// Workspaces of others look like missing ones.
+		{"non-member", carol, fmt.Sprint(s.workspace), http.StatusNotFound},
+		{"missing", s.user, "999", http.StatusNotFound},
+		{"malformed", s.user, "home", http.StatusNotFound},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			u, err := s.users.GetUser(t.Context(), td.user)
+			require.NoError(t, err)
+			r := httptest.NewRequestWithContext(
+				domain.WithUser(t.Context(), u), http.MethodGet, "/", nil)
+			r.SetPathValue("workspace", td.workspace)
+			w := httptest.NewRecorder()
+			h(w, r)
+			require.Equal(t, td.expectCode, w.Code)
+			if td.expectCode == http.StatusOK {
+				require.Equal(t, fmt.Sprint(s.workspace), w.Body.String())
+			}
+		})
+	}
+}